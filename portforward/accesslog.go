@@ -0,0 +1,105 @@
+package portforward
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ===== Access log =====
+
+/*
+Operators audit who used which tunnel and when. The access log has an entry
+per local connection when it closed, written as a JSON object per line, so
+log shippers can parse it. Bytes in are sent by the client to the pod, bytes
+out are sent back to the client.
+*/
+
+// AccessLogEntry describes a closed local connection.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Client     string    `json:"client"`
+	Namespace  string    `json:"namespace"`
+	Target     string    `json:"target"`
+	Pod        string    `json:"pod"`
+	LocalPort  int       `json:"localPort,omitempty"`
+	Socket     string    `json:"socket,omitempty"`
+	RemotePort int       `json:"remotePort"`
+	// DurationMillis is the time the connection was open.
+	DurationMillis int64 `json:"durationMillis"`
+	BytesIn        int64 `json:"bytesIn"`
+	BytesOut       int64 `json:"bytesOut"`
+}
+
+// WithAccessLog writes an entry per closed local connection to the output.
+func WithAccessLog(output io.Writer) Option {
+	return func(o *options) {
+		o.accessLog = output
+	}
+}
+
+// accessLog writes the entries of a forward, one at a time.
+type accessLog struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func newAccessLog(output io.Writer) *accessLog {
+	if output == nil {
+		return nil
+	}
+
+	return &accessLog{encoder: json.NewEncoder(output)}
+}
+
+func (l *accessLog) write(entry AccessLogEntry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.encoder.Encode(entry)
+}
+
+// accessConn counts the bytes of a local connection.
+type accessConn struct {
+	net.Conn
+	bytesIn  int64
+	bytesOut int64
+}
+
+func (c *accessConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.bytesIn, int64(n))
+
+	return n, err
+}
+
+func (c *accessConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.bytesOut, int64(n))
+
+	return n, err
+}
+
+// logAccess writes the entry of the closed connection.
+func (t *tunnel) logAccess(conn *accessConn, pod string, port PortMapping, opened time.Time) {
+	entry := AccessLogEntry{
+		Time:           opened,
+		Client:         conn.RemoteAddr().String(),
+		Namespace:      t.namespace,
+		Target:         t.target,
+		Pod:            pod,
+		LocalPort:      port.Local,
+		Socket:         port.LocalSocket,
+		RemotePort:     port.Remote,
+		DurationMillis: time.Since(opened).Milliseconds(),
+		BytesIn:        atomic.LoadInt64(&conn.bytesIn),
+		BytesOut:       atomic.LoadInt64(&conn.bytesOut),
+	}
+
+	if err := t.accessLog.write(entry); err != nil {
+		t.reportError(err)
+	}
+}
@@ -0,0 +1,62 @@
+package portforward
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForwardWithAccessLog(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "audited-pod")
+	output := &logBuffer{}
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "audited-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"), WithAccessLog(output))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port := forwarder.Ports()[0].Local
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	assertEchoRoundTrip(t, conn)
+	conn.Close()
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return strings.Contains(output.String(), "\n") }) {
+		t.Fatalf("Expected an access log entry")
+	}
+
+	var entry AccessLogEntry
+	if err := json.Unmarshal([]byte(output.String()), &entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if entry.Client != conn.LocalAddr().String() {
+		t.Errorf("Expected the client %s but got %s", conn.LocalAddr(), entry.Client)
+	}
+
+	if entry.Pod != "audited-pod" || entry.Target != "audited-pod" || entry.Namespace != "default" {
+		t.Errorf("Unexpected target of the entry %+v", entry)
+	}
+
+	if entry.LocalPort != port || entry.RemotePort != 8080 {
+		t.Errorf("Expected the ports %d:8080 but got %d:%d", port, entry.LocalPort, entry.RemotePort)
+	}
+
+	if entry.BytesIn != 4 || entry.BytesOut != 4 {
+		t.Errorf("Expected 4 bytes in and out but got %d and %d", entry.BytesIn, entry.BytesOut)
+	}
+}
@@ -0,0 +1,75 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ===== Client allowlist =====
+
+/*
+Forwards bound to other addresses than localhost are reachable from other
+machines. An allowlist restricts the local connections to source networks,
+other clients are closed right after they were accepted and reported, before
+anything is sent to the pod. Connections to Unix sockets are not filtered.
+*/
+
+// WithAllowedClients only accepts local connections from the networks, like
+// "10.0.0.0/8" or single IPs like "192.168.1.20". Loopback clients must be
+// listed as well, e.g. "127.0.0.1" and "::1".
+func WithAllowedClients(networks ...string) Option {
+	return func(o *options) {
+		o.allowedClients = append(o.allowedClients, networks...)
+	}
+}
+
+// parseNetworks parses CIDRs and single IPs.
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(networks))
+
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid client address %q", network)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client network %q: %w", network, err)
+		}
+		parsed = append(parsed, ipNet)
+	}
+
+	return parsed, nil
+}
+
+// allowed reports whether the client of a local connection may use the
+// forward.
+func (t *tunnel) allowed(conn net.Conn) bool {
+	if len(t.allowedClients) == 0 {
+		return true
+	}
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+
+	for _, network := range t.allowedClients {
+		if network.Contains(addr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
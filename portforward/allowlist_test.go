@@ -0,0 +1,102 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestForwardAcceptsAllowedClients(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "allowed-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "allowed-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"), WithAllowedClients("10.0.0.0/8", "127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestForwardRejectsClientsOutsideAllowlist(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "denied-pod")
+
+	rejected := make(chan error, 1)
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "denied-pod", []PortMapping{{Remote: 8080}},
+		WithAddress("127.0.0.1"), WithAllowedClients("10.0.0.0/8"), WithErrorHandler(func(err error) {
+			select {
+			case rejected <- err:
+			default:
+			}
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+
+	// Assert
+	if err != io.EOF {
+		t.Errorf("Expected the connection to be closed but got %v", err)
+	}
+
+	select {
+	case <-rejected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Rejected client was not reported")
+	}
+
+	if server.streamCount("denied-pod") != 0 {
+		t.Errorf("Expected no streams to the pod but got %d", server.streamCount("denied-pod"))
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	// Act
+	networks, err := parseNetworks([]string{"192.168.1.20", "::1", "10.0.0.0/8"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"192.168.1.20/32", "::1/128", "10.0.0.0/8"}
+	for i, network := range networks {
+		if network.String() != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], network)
+		}
+	}
+}
+
+func TestParseNetworksWithInvalidNetwork(t *testing.T) {
+	for _, network := range []string{"localhost", "10.0.0.0/33"} {
+		// Act
+		_, err := parseNetworks([]string{network})
+
+		// Assert
+		if err == nil {
+			t.Errorf("Error should be returned for %q", network)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package portforward
+
+import (
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ===== Builtin credential providers =====
+
+/*
+Python users often have a kubeconfig that references an exec plugin
+(aws, kubelogin, ...) that is not installed on their machine. For the
+most common plugins the token is generated natively instead.
+*/
+
+// tokenSource creates a bearer token and reports when it expires.
+type tokenSource interface {
+	token() (string, time.Time, error)
+}
+
+// builtinProvider returns a token source that replaces the exec plugin
+// or nil when it does not handle the plugin.
+type builtinProvider func(execConfig *clientcmdapi.ExecConfig) (tokenSource, error)
+
+var builtinProviders = []builtinProvider{
+	newEKSTokenSource,
+	newAzureTokenSource,
+}
+
+// lookPath is replaced in tests.
+var lookPath = exec.LookPath
+
+// applyBuiltinCredentials replaces a missing exec plugin with a builtin provider.
+func applyBuiltinCredentials(config *rest.Config) error {
+	execConfig := config.ExecProvider
+	if execConfig == nil {
+		return nil
+	}
+
+	if _, err := lookPath(execConfig.Command); err == nil {
+		return nil
+	}
+
+	for _, provider := range builtinProviders {
+		source, err := provider(execConfig)
+		if err != nil {
+			return err
+		}
+
+		if source != nil {
+			useTokenSource(config, source)
+			return nil
+		}
+	}
+
+	// Let client-go report the missing executable.
+	return nil
+}
+
+// useTokenSource authenticates every request with tokens of the source.
+func useTokenSource(config *rest.Config, source tokenSource) {
+	cached := &cachedTokenSource{source: source}
+
+	config.ExecProvider = nil
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &bearerRoundTripper{source: cached, next: rt}
+	})
+}
+
+// expiryMargin renews tokens before they expire to compensate clock skew.
+const expiryMargin = time.Minute
+
+// cachedTokenSource reuses a token until it is about to expire.
+//
+// Long-lived forwards re-dial hours after the first token was issued. To not
+// depend on the token endpoint at that moment, tokens are renewed in the
+// background when 80% of their lifetime passed. Only tokens that were used
+// since the last renewal are renewed, so unused configs stop refreshing.
+type cachedTokenSource struct {
+	source tokenSource
+
+	mutex  sync.Mutex
+	value  string
+	expiry time.Time
+	used   bool
+	timer  *time.Timer
+}
+
+func (c *cachedTokenSource) token() (string, time.Time, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.used = true
+
+	if c.value != "" && time.Now().Add(expiryMargin).Before(c.expiry) {
+		return c.value, c.expiry, nil
+	}
+
+	value, expiry, err := c.source.token()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	c.store(value, expiry)
+
+	return value, expiry, nil
+}
+
+// store keeps the token and schedules its renewal. The mutex must be held.
+func (c *cachedTokenSource) store(value string, expiry time.Time) {
+	now := time.Now()
+
+	c.value, c.expiry, c.used = value, expiry, false
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	c.timer = time.AfterFunc(expiry.Sub(now)*8/10, c.renew)
+}
+
+// renew fetches a new token in the background before the current one expires.
+func (c *cachedTokenSource) renew() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.used {
+		c.timer = nil
+		return
+	}
+
+	value, expiry, err := c.source.token()
+	if err != nil {
+		// The current token stays valid, the next request tries again.
+		c.timer = nil
+		return
+	}
+
+	c.store(value, expiry)
+}
+
+// bearerRoundTripper sets the Authorization header of each request.
+type bearerRoundTripper struct {
+	source tokenSource
+	next   http.RoundTripper
+}
+
+func (b *bearerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, _, err := b.source.token()
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the original request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return b.next.RoundTrip(req)
+}
+
+// execArg returns the value of a flag like "--name value" or "--name=value".
+func execArg(args []string, names ...string) string {
+	for i, arg := range args {
+		for _, name := range names {
+			if arg == name && i+1 < len(args) {
+				return args[i+1]
+			}
+
+			if strings.HasPrefix(arg, name+"=") {
+				return strings.TrimPrefix(arg, name+"=")
+			}
+		}
+	}
+
+	return ""
+}
+
+// execEnv returns the value of a variable of the exec config or the process.
+// Like for the plugin process, the last definition wins.
+func execEnv(execConfig *clientcmdapi.ExecConfig, getenv func(string) string, name string) string {
+	for i := len(execConfig.Env) - 1; i >= 0; i-- {
+		if execConfig.Env[i].Name == name {
+			return execConfig.Env[i].Value
+		}
+	}
+
+	return getenv(name)
+}
@@ -0,0 +1,116 @@
+package portforward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ===== Azure workload identity tokens =====
+
+// Based on https://azure.github.io/azure-workload-identity/docs/
+
+const defaultAzureAuthorityHost = "https://login.microsoftonline.com/"
+
+// azureTokenTimeout limits the token exchange. It runs inside the requests to
+// the API server, an endpoint that does not answer must not hang them.
+const azureTokenTimeout = 30 * time.Second
+
+// azureTokenSource exchanges the federated service account token for an AAD token
+// like "kubelogin get-token --login workloadidentity".
+type azureTokenSource struct {
+	authorityHost      string
+	tenantID           string
+	clientID           string
+	serverID           string
+	federatedTokenFile string
+	client             *http.Client
+}
+
+// newAzureTokenSource handles kubelogin in the workload identity login mode.
+func newAzureTokenSource(execConfig *clientcmdapi.ExecConfig) (tokenSource, error) {
+	if filepath.Base(execConfig.Command) != "kubelogin" {
+		return nil, nil
+	}
+
+	if execArg(execConfig.Args, "--login", "-l") != "workloadidentity" {
+		return nil, nil
+	}
+
+	source := &azureTokenSource{
+		authorityHost:      argOrEnv(execConfig, "--authority-host", "AZURE_AUTHORITY_HOST"),
+		tenantID:           argOrEnv(execConfig, "--tenant-id", "AZURE_TENANT_ID"),
+		clientID:           argOrEnv(execConfig, "--client-id", "AZURE_CLIENT_ID"),
+		serverID:           execArg(execConfig.Args, "--server-id"),
+		federatedTokenFile: argOrEnv(execConfig, "--federated-token-file", "AZURE_FEDERATED_TOKEN_FILE"),
+		client:             &http.Client{Timeout: azureTokenTimeout},
+	}
+
+	if source.authorityHost == "" {
+		source.authorityHost = defaultAzureAuthorityHost
+	}
+
+	if source.tenantID == "" || source.clientID == "" || source.serverID == "" || source.federatedTokenFile == "" {
+		return nil, fmt.Errorf("builtin Azure workload identity requires tenant id, client id, server id and federated token file")
+	}
+
+	return source, nil
+}
+
+func (a *azureTokenSource) token() (string, time.Time, error) {
+	// The projected token is rotated by the kubelet, so it is read on every exchange.
+	assertion, err := os.ReadFile(a.federatedTokenFile)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	form := url.Values{
+		"client_id":             {a.clientID},
+		"scope":                 {strings.TrimSuffix(a.serverID, "/") + "/.default"},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(a.authorityHost, "/"), a.tenantID)
+
+	now := time.Now()
+
+	resp, err := a.client.PostForm(tokenURL, form)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid response of Azure token endpoint: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token request to Azure failed with status %d: %s", resp.StatusCode, result.ErrorDescription)
+	}
+
+	return result.AccessToken, now.Add(time.Duration(result.ExpiresIn) * time.Second), nil
+}
+
+// argOrEnv prefers the flag of the plugin over the environment.
+func argOrEnv(execConfig *clientcmdapi.ExecConfig, arg, env string) string {
+	if value := execArg(execConfig.Args, arg); value != "" {
+		return value
+	}
+
+	return execEnv(execConfig, os.Getenv, env)
+}
@@ -0,0 +1,126 @@
+package portforward
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestAzureToken(t *testing.T) {
+	// Arrange
+	var form map[string]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_ = r.ParseForm()
+		form = map[string]string{
+			"client_id":        r.PostForm.Get("client_id"),
+			"scope":            r.PostForm.Get("scope"),
+			"client_assertion": r.PostForm.Get("client_assertion"),
+		}
+
+		_, _ = w.Write([]byte(`{"access_token": "aad-token", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("federated-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "kubelogin",
+		Args: []string{
+			"get-token", "--login", "workloadidentity", "--server-id", "6dae42f8-4368-4678-94ff-3960e28e3630",
+			"--authority-host", server.URL, "--tenant-id", "tenant", "--client-id", "client",
+			"--federated-token-file", tokenFile,
+		},
+	}
+
+	source, err := newAzureTokenSource(execConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	token, _, err := source.token()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if token != "aad-token" {
+		t.Errorf("Expected aad-token but got %s", token)
+	}
+
+	if form["client_id"] != "client" || form["client_assertion"] != "federated-token" ||
+		form["scope"] != "6dae42f8-4368-4678-94ff-3960e28e3630/.default" {
+		t.Errorf("Unexpected token request %v", form)
+	}
+}
+
+func TestNewAzureTokenSourceIgnoresOtherLoginModes(t *testing.T) {
+	// Arrange
+	execConfig := &clientcmdapi.ExecConfig{Command: "kubelogin", Args: []string{"get-token", "--login", "devicecode"}}
+
+	// Act
+	source, err := newAzureTokenSource(execConfig)
+
+	// Assert
+	if err != nil || source != nil {
+		t.Errorf("Expected no token source but got %v, %v", source, err)
+	}
+}
+
+func TestAzureTokenWithStalledEndpoint(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("federated-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "kubelogin",
+		Args: []string{
+			"get-token", "--login", "workloadidentity", "--server-id", "6dae42f8-4368-4678-94ff-3960e28e3630",
+			"--authority-host", server.URL, "--tenant-id", "tenant", "--client-id", "client",
+			"--federated-token-file", tokenFile,
+		},
+	}
+
+	source, err := newAzureTokenSource(execConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	source.(*azureTokenSource).client.Timeout = 100 * time.Millisecond
+
+	// Act
+	start := time.Now()
+	_, _, err = source.token()
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned when the token endpoint does not answer")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Token request should time out but took %s", elapsed)
+	}
+}
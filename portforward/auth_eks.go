@@ -0,0 +1,342 @@
+package portforward
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ===== AWS EKS tokens =====
+
+// Based on https://github.com/kubernetes-sigs/aws-iam-authenticator#api-authorization-from-outside-a-cluster
+
+const (
+	eksTokenPrefix   = "k8s-aws-v1."
+	eksClusterHeader = "x-k8s-aws-id"
+	// EKS accepts the presigned URL for 15 minutes.
+	eksTokenLifetime = 15 * time.Minute
+)
+
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// eksTokenSource presigns a GetCallerIdentity request like "aws eks get-token".
+type eksTokenSource struct {
+	clusterName string
+	region      string
+	// credentials are loaded again for every token, the sessions in the
+	// environment and the credentials file are rotated.
+	credentials func() (awsCredentials, error)
+	now         func() time.Time
+}
+
+// newEKSTokenSource handles "aws eks get-token" and "aws-iam-authenticator token".
+func newEKSTokenSource(execConfig *clientcmdapi.ExecConfig) (tokenSource, error) {
+	var clusterName string
+
+	switch filepath.Base(execConfig.Command) {
+	case "aws":
+		if !containsArgs(execConfig.Args, "eks", "get-token") {
+			return nil, nil
+		}
+		clusterName = execArg(execConfig.Args, "--cluster-name", "--cluster-id")
+	case "aws-iam-authenticator":
+		if !containsArgs(execConfig.Args, "token") {
+			return nil, nil
+		}
+		clusterName = execArg(execConfig.Args, "-i", "--cluster-id")
+	default:
+		return nil, nil
+	}
+
+	if clusterName == "" {
+		return nil, fmt.Errorf("builtin EKS authentication requires a cluster name")
+	}
+
+	if execArg(execConfig.Args, "--role-arn", "-r") != "" {
+		return nil, fmt.Errorf("builtin EKS authentication does not support --role-arn, please install %s", execConfig.Command)
+	}
+
+	region := execArg(execConfig.Args, "--region")
+	if region == "" {
+		region = execEnv(execConfig, os.Getenv, "AWS_REGION")
+	}
+	if region == "" {
+		region = execEnv(execConfig, os.Getenv, "AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	profile := execArg(execConfig.Args, "--profile")
+	explicitProfile := profile != ""
+	if !explicitProfile {
+		profile = execEnv(execConfig, os.Getenv, "AWS_PROFILE")
+	}
+
+	credentials := func() (awsCredentials, error) {
+		return loadAWSCredentials(execConfig, profile, explicitProfile)
+	}
+
+	// Missing credentials fail the config instead of the first request.
+	if _, err := credentials(); err != nil {
+		return nil, err
+	}
+
+	return &eksTokenSource{clusterName: clusterName, region: region, credentials: credentials, now: time.Now}, nil
+}
+
+func (e *eksTokenSource) token() (string, time.Time, error) {
+	credentials, err := e.credentials()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := e.now().UTC()
+
+	presigned := presignGetCallerIdentity(credentials, e.region, e.clusterName, now)
+	token := eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned))
+
+	return token, now.Add(eksTokenLifetime), nil
+}
+
+// presignGetCallerIdentity creates a AWS Signature Version 4 presigned URL.
+func presignGetCallerIdentity(credentials awsCredentials, region, clusterName string, now time.Time) string {
+	host := fmt.Sprintf("sts.%s.amazonaws.com", region)
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/sts/aws4_request", date, region)
+
+	query := map[string]string{
+		"Action":              "GetCallerIdentity",
+		"Version":             "2011-06-15",
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    credentials.accessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       "60",
+		"X-Amz-SignedHeaders": "host;" + eksClusterHeader,
+	}
+	if credentials.sessionToken != "" {
+		query["X-Amz-Security-Token"] = credentials.sessionToken
+	}
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalHeaders := fmt.Sprintf("host:%s\n%s:%s\n", host, eksClusterHeader, clusterName)
+	emptyPayloadHash := sha256Hex("")
+
+	canonicalRequest := strings.Join([]string{
+		"GET", "/", canonicalQuery, canonicalHeaders, "host;" + eksClusterHeader, emptyPayloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "sts")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf("https://%s/?%s&X-Amz-Signature=%s", host, canonicalQuery, signature)
+}
+
+// canonicalQueryString sorts and RFC 3986 encodes the parameters.
+func canonicalQueryString(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, awsEscape(key)+"="+awsEscape(query[key]))
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func sha256Hex(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// loadAWSCredentials reads the credentials from the environment or the shared credentials file.
+// Like the aws CLI, an explicit --profile wins over the environment credentials while AWS_PROFILE does not.
+func loadAWSCredentials(execConfig *clientcmdapi.ExecConfig, profile string, explicitProfile bool) (awsCredentials, error) {
+	credentials := awsCredentials{
+		accessKeyID:     execEnv(execConfig, os.Getenv, "AWS_ACCESS_KEY_ID"),
+		secretAccessKey: execEnv(execConfig, os.Getenv, "AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    execEnv(execConfig, os.Getenv, "AWS_SESSION_TOKEN"),
+	}
+
+	if !explicitProfile && credentials.accessKeyID != "" && credentials.secretAccessKey != "" {
+		return credentials, nil
+	}
+
+	if profile == "" {
+		profile = "default"
+	}
+
+	// Assumed roles, SSO and credential processes are configured in the config file
+	// and are only resolved by the aws CLI, so fail loudly instead of signing with other credentials.
+	configPath, err := awsFilePath(execConfig, "AWS_CONFIG_FILE", "config")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = profile
+	}
+
+	config, err := readAWSProfile(configPath, configSection)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return awsCredentials{}, err
+	}
+
+	if err := checkAWSProfile(config, profile, configPath, execConfig.Command); err != nil {
+		return awsCredentials{}, err
+	}
+
+	path, err := awsFilePath(execConfig, "AWS_SHARED_CREDENTIALS_FILE", "credentials")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	values, err := readAWSProfile(path, profile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials found for builtin EKS authentication: %w", err)
+	}
+
+	if err := checkAWSProfile(values, profile, path, execConfig.Command); err != nil {
+		return awsCredentials{}, err
+	}
+
+	credentials = awsCredentials{
+		accessKeyID:     values["aws_access_key_id"],
+		secretAccessKey: values["aws_secret_access_key"],
+		sessionToken:    values["aws_session_token"],
+	}
+
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("profile %q in %s has no AWS credentials", profile, path)
+	}
+
+	return credentials, nil
+}
+
+// awsFilePath returns the file named by the environment variable or the file in ~/.aws.
+func awsFilePath(execConfig *clientcmdapi.ExecConfig, env, name string) (string, error) {
+	if path := execEnv(execConfig, os.Getenv, env); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".aws", name), nil
+}
+
+// checkAWSProfile rejects profiles whose credentials only the aws CLI can resolve.
+func checkAWSProfile(values map[string]string, profile, path, command string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "role_arn" || key == "credential_process" || key == "web_identity_token_file" || strings.HasPrefix(key, "sso_") {
+			return fmt.Errorf("profile %q in %s uses %s, which builtin EKS authentication does not support, please install %s", profile, path, key, command)
+		}
+	}
+
+	return nil
+}
+
+// readAWSProfile parses a section of the ini formatted shared credentials or config file.
+func readAWSProfile(path, section string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	current := ""
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		if current != section {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// containsArgs reports whether all values are part of the arguments.
+func containsArgs(args []string, values ...string) bool {
+	for _, value := range values {
+		found := false
+		for _, arg := range args {
+			if arg == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
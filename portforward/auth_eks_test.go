@@ -0,0 +1,254 @@
+package portforward
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestNewEKSTokenSourceFromAWSCLI(t *testing.T) {
+	// Arrange
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "aws",
+		Args:    []string{"--region", "eu-central-1", "eks", "get-token", "--cluster-name", "dev"},
+		Env: []clientcmdapi.ExecEnvVar{
+			{Name: "AWS_ACCESS_KEY_ID", Value: "AKIDEXAMPLE"},
+			{Name: "AWS_SECRET_ACCESS_KEY", Value: "secret"},
+		},
+	}
+
+	// Act
+	source, err := newEKSTokenSource(execConfig)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	eks := source.(*eksTokenSource)
+	credentials, err := eks.credentials()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if eks.clusterName != "dev" || eks.region != "eu-central-1" || credentials.accessKeyID != "AKIDEXAMPLE" {
+		t.Errorf("Unexpected token source %+v with %+v", eks, credentials)
+	}
+}
+
+func TestNewEKSTokenSourceIgnoresOtherPlugins(t *testing.T) {
+	// Arrange
+	execConfig := &clientcmdapi.ExecConfig{Command: "kubelogin", Args: []string{"get-token"}}
+
+	// Act
+	source, err := newEKSTokenSource(execConfig)
+
+	// Assert
+	if err != nil || source != nil {
+		t.Errorf("Expected no token source but got %v, %v", source, err)
+	}
+}
+
+func TestEKSToken(t *testing.T) {
+	// Arrange
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	source := &eksTokenSource{
+		clusterName: "dev",
+		region:      "eu-central-1",
+		credentials: func() (awsCredentials, error) {
+			return awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "secret", sessionToken: "session"}, nil
+		},
+		now: func() time.Time { return now },
+	}
+
+	// Act
+	token, expiry, err := source.token()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !expiry.Equal(now.Add(15 * time.Minute)) {
+		t.Errorf("Unexpected expiry %v", expiry)
+	}
+
+	if !strings.HasPrefix(token, "k8s-aws-v1.") {
+		t.Fatalf("Token has no EKS prefix: %s", token)
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, "k8s-aws-v1."))
+	if err != nil {
+		t.Fatalf("Token is not base64 encoded: %v", err)
+	}
+
+	presigned, err := url.Parse(string(decoded))
+	if err != nil {
+		t.Fatalf("Token does not contain an URL: %v", err)
+	}
+
+	query := presigned.Query()
+
+	if presigned.Host != "sts.eu-central-1.amazonaws.com" {
+		t.Errorf("Unexpected STS host %s", presigned.Host)
+	}
+
+	if query.Get("X-Amz-Credential") != "AKIDEXAMPLE/20210801/eu-central-1/sts/aws4_request" {
+		t.Errorf("Unexpected credential scope %s", query.Get("X-Amz-Credential"))
+	}
+
+	if query.Get("X-Amz-Security-Token") != "session" {
+		t.Errorf("Session token is missing")
+	}
+
+	if len(query.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("Unexpected signature %s", query.Get("X-Amz-Signature"))
+	}
+}
+
+func TestEKSTokenUsesRotatedSession(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeSession := func(session string) {
+		content := "[default]\naws_access_key_id = AKIDEXAMPLE\naws_secret_access_key = secret\naws_session_token = " + session + "\n"
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSession("first-session")
+
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "aws",
+		Args:    []string{"eks", "get-token", "--cluster-name", "dev", "--profile", "default"},
+		Env: []clientcmdapi.ExecEnvVar{
+			{Name: "AWS_CONFIG_FILE", Value: filepath.Join(filepath.Dir(path), "config")},
+			{Name: "AWS_SHARED_CREDENTIALS_FILE", Value: path},
+		},
+	}
+
+	source, err := newEKSTokenSource(execConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	writeSession("rotated-session")
+	token, _, err := source.token()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, "k8s-aws-v1."))
+	if err != nil {
+		t.Fatalf("Token is not base64 encoded: %v", err)
+	}
+
+	presigned, err := url.Parse(string(decoded))
+	if err != nil {
+		t.Fatalf("Token does not contain an URL: %v", err)
+	}
+
+	if session := presigned.Query().Get("X-Amz-Security-Token"); session != "rotated-session" {
+		t.Errorf("Expected the rotated session but got %s", session)
+	}
+}
+
+func TestReadAWSProfile(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials")
+	content := "[default]\naws_access_key_id = DEFAULT\naws_secret_access_key = default-secret\n\n" +
+		"[dev]\naws_access_key_id = DEV\naws_secret_access_key = dev-secret\naws_session_token = dev-session\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	values, err := readAWSProfile(path, "dev")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(values) != 3 || values["aws_access_key_id"] != "DEV" || values["aws_session_token"] != "dev-session" {
+		t.Errorf("Unexpected profile %v", values)
+	}
+}
+
+func TestLoadAWSCredentialsPrefersProfileArgument(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	path := filepath.Join(dir, "credentials")
+	content := "[dev]\naws_access_key_id = DEV\naws_secret_access_key = dev-secret\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "aws",
+		Args:    []string{"eks", "get-token", "--cluster-name", "dev", "--profile", "dev"},
+		Env: []clientcmdapi.ExecEnvVar{
+			{Name: "AWS_ACCESS_KEY_ID", Value: "AKIDEXAMPLE"},
+			{Name: "AWS_SECRET_ACCESS_KEY", Value: "secret"},
+			{Name: "AWS_CONFIG_FILE", Value: filepath.Join(dir, "config")},
+			{Name: "AWS_SHARED_CREDENTIALS_FILE", Value: path},
+		},
+	}
+
+	// Act
+	source, err := newEKSTokenSource(execConfig)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	credentials, err := source.(*eksTokenSource).credentials()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if credentials.accessKeyID != "DEV" {
+		t.Errorf("Expected the credentials of profile dev but got %+v", credentials)
+	}
+}
+
+func TestLoadAWSCredentialsRejectsUnsupportedProfiles(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	config := "[profile admin]\nrole_arn = arn:aws:iam::123456789012:role/admin\nsource_profile = default\n\n" +
+		"[profile sso]\nsso_start_url = https://example.awsapps.com/start\n\n" +
+		"[profile process]\ncredential_process = /usr/local/bin/credentials\n"
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := "[default]\naws_access_key_id = DEFAULT\naws_secret_access_key = default-secret\n"
+	if err := os.WriteFile(filepath.Join(dir, "credentials"), []byte(credentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "aws",
+		Env: []clientcmdapi.ExecEnvVar{
+			{Name: "AWS_CONFIG_FILE", Value: filepath.Join(dir, "config")},
+			{Name: "AWS_SHARED_CREDENTIALS_FILE", Value: filepath.Join(dir, "credentials")},
+		},
+	}
+
+	for profile, key := range map[string]string{"admin": "role_arn", "sso": "sso_start_url", "process": "credential_process"} {
+		// Act
+		_, err := loadAWSCredentials(execConfig, profile, true)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected an error about %s for profile %s but got %v", key, profile, err)
+		}
+	}
+}
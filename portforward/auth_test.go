@@ -0,0 +1,164 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+type countingTokenSource struct {
+	mutex    sync.Mutex
+	calls    int
+	lifetime time.Duration
+}
+
+func (c *countingTokenSource) token() (string, time.Time, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.calls++
+	return fmt.Sprintf("token-%d", c.calls), time.Now().Add(c.lifetime), nil
+}
+
+func (c *countingTokenSource) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.calls
+}
+
+func TestCachedTokenSourceReusesValidToken(t *testing.T) {
+	// Arrange
+	source := &countingTokenSource{lifetime: time.Hour}
+	cached := &cachedTokenSource{source: source}
+
+	// Act
+	_, _, _ = cached.token()
+	_, _, _ = cached.token()
+
+	// Assert
+	if source.count() != 1 {
+		t.Errorf("Expected one token request but got %d", source.count())
+	}
+}
+
+func TestCachedTokenSourceRenewsExpiringToken(t *testing.T) {
+	// Arrange
+	source := &countingTokenSource{lifetime: time.Second}
+	cached := &cachedTokenSource{source: source}
+
+	// Act
+	_, _, _ = cached.token()
+	_, _, _ = cached.token()
+
+	// Assert
+	if source.count() != 2 {
+		t.Errorf("Expected two token requests but got %d", source.count())
+	}
+}
+
+func TestCachedTokenSourceRenewsUsedToken(t *testing.T) {
+	// Arrange
+	source := &countingTokenSource{lifetime: time.Hour}
+	cached := &cachedTokenSource{source: source}
+
+	_, _, _ = cached.token()
+	_, _, _ = cached.token()
+
+	// Act
+	cached.renew()
+
+	// Assert
+	token, _, _ := cached.token()
+	if source.count() != 2 || token != "token-2" {
+		t.Errorf("Expected the used token to be renewed but got %s after %d calls", token, source.count())
+	}
+}
+
+func TestCachedTokenSourceSkipsRenewalOfUnusedToken(t *testing.T) {
+	// Arrange
+	source := &countingTokenSource{lifetime: time.Hour}
+	cached := &cachedTokenSource{source: source}
+
+	_, _, _ = cached.token()
+
+	// Act
+	cached.renew()
+
+	// Assert
+	if source.count() != 1 {
+		t.Errorf("Unused tokens should not be renewed")
+	}
+}
+
+func TestApplyBuiltinCredentialsKeepsInstalledPlugin(t *testing.T) {
+	// Arrange
+	original := lookPath
+	lookPath = func(string) (string, error) { return "/usr/bin/aws", nil }
+	defer func() { lookPath = original }()
+
+	config := &rest.Config{ExecProvider: &clientcmdapi.ExecConfig{Command: "aws", Args: []string{"eks", "get-token", "--cluster-name", "dev"}}}
+
+	// Act
+	err := applyBuiltinCredentials(config)
+
+	// Assert
+	if err != nil || config.ExecProvider == nil {
+		t.Errorf("Exec plugin should be kept when it is installed")
+	}
+}
+
+func TestApplyBuiltinCredentialsReplacesMissingPlugin(t *testing.T) {
+	// Arrange
+	original := lookPath
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	defer func() { lookPath = original }()
+
+	config := &rest.Config{ExecProvider: &clientcmdapi.ExecConfig{
+		Command: "aws",
+		Args:    []string{"eks", "get-token", "--cluster-name", "dev"},
+		Env: []clientcmdapi.ExecEnvVar{
+			{Name: "AWS_ACCESS_KEY_ID", Value: "AKIDEXAMPLE"},
+			{Name: "AWS_SECRET_ACCESS_KEY", Value: "secret"},
+		},
+	}}
+
+	// Act
+	err := applyBuiltinCredentials(config)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.ExecProvider != nil || config.WrapTransport == nil {
+		t.Fatalf("Exec plugin should be replaced by the builtin provider")
+	}
+
+	var authorization string
+	rt := config.WrapTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		authorization = req.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(authorization) <= len("Bearer k8s-aws-v1.") {
+		t.Errorf("Expected an EKS bearer token but got %q", authorization)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
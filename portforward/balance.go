@@ -0,0 +1,244 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// ===== Pod selection =====
+
+/*
+Services and workloads are backed by several pods. By default a forward picks
+the most recently created ready pod. Forwards of this process can spread over
+the pods instead, the load of a pod is the number of tunnels and open local
+connections to it. Other processes are not known.
+
+A balanced forward connects to every ready pod and rotates the local
+connections over them like a service in the cluster. A lost connection to a
+pod other than the first is dropped from the rotation until the forward
+reconnects.
+
+Stateful backends misbehave when the pod flips between connections, so a
+forward reconnects to its pod as long as it is ready. The strategy only
+picks the first pod and the pods after the pinned pod went away.
+*/
+
+// PodStrategy picks the pod of a forward among the ready pods of its target.
+type PodStrategy int
+
+const (
+	// NewestPod picks the most recently created ready pod.
+	NewestPod PodStrategy = iota
+	// LeastLoadedPod picks the ready pod with the fewest tunnels and open
+	// connections of this process.
+	LeastLoadedPod
+)
+
+// WithPodStrategy sets how the pod of a service or workload is picked when
+// the forward connects.
+func WithPodStrategy(strategy PodStrategy) Option {
+	return func(o *options) {
+		o.podStrategy = strategy
+	}
+}
+
+// WithLoadBalancing connects to every ready pod of a service or workload and
+// sends each local connection to the next pod.
+func WithLoadBalancing() Option {
+	return func(o *options) {
+		o.balance = true
+	}
+}
+
+// WithoutStickyPod picks the pod with the strategy on every reconnect
+// instead of reusing the ready pod of the forward.
+func WithoutStickyPod() Option {
+	return func(o *options) {
+		o.noStickyPod = true
+	}
+}
+
+// podPicker picks one of the candidates of a target, newest first.
+type podPicker func(candidates []resolvedTarget) resolvedTarget
+
+func (s PodStrategy) picker() podPicker {
+	if s == LeastLoadedPod {
+		return leastLoaded
+	}
+
+	return newest
+}
+
+// picker returns the picker for connecting to the target, it prefers the
+// pod of the forward while it is a ready candidate.
+func (t *tunnel) picker(target string) podPicker {
+	fallback := t.options.podStrategy.picker()
+	if t.options.noStickyPod {
+		return fallback
+	}
+
+	t.mutex.Lock()
+	pinned, current := t.pod, t.retargeted
+	t.mutex.Unlock()
+
+	if current == "" {
+		current = t.target
+	}
+	if current != target {
+		// Retargeted, the pod of the old target is not pinned.
+		pinned = ""
+	}
+
+	return func(candidates []resolvedTarget) resolvedTarget {
+		for _, candidate := range candidates {
+			if candidate.pod.Name == pinned {
+				return candidate
+			}
+		}
+
+		return fallback(candidates)
+	}
+}
+
+func newest(candidates []resolvedTarget) resolvedTarget {
+	return candidates[0]
+}
+
+func leastLoaded(candidates []resolvedTarget) resolvedTarget {
+	loads.Lock()
+	defer loads.Unlock()
+
+	picked := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if loads.counts[podKey(candidate.pod.Namespace, candidate.pod.Name)] < loads.counts[podKey(picked.pod.Namespace, picked.pod.Name)] {
+			picked = candidate
+		}
+	}
+
+	return picked
+}
+
+// loads counts the tunnels and open connections of every pod.
+var loads = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: map[string]int{}}
+
+func addLoad(namespace, pod string, delta int) {
+	if pod == "" {
+		return
+	}
+
+	loads.Lock()
+	defer loads.Unlock()
+
+	key := podKey(namespace, pod)
+	loads.counts[key] += delta
+	if loads.counts[key] <= 0 {
+		delete(loads.counts, key)
+	}
+}
+
+func podKey(namespace, pod string) string {
+	return fmt.Sprintf("%s/%s", namespace, pod)
+}
+
+// connectExtras connects to the ready pods of the target other than the
+// primary pod. Pods that cannot be reached are left out.
+func (t *tunnel) connectExtras(parent context.Context, target, primary string) []backend {
+	restConfig, clientset := t.config.client()
+
+	ctx, cancel := t.config.requestContextFrom(parent)
+	defer cancel()
+
+	candidates, err := resolveTargets(ctx, clientset, t.namespace, target)
+	if err != nil {
+		t.reportError(fmt.Errorf("balancing %s/%s: %w", t.namespace, target, err))
+		return nil
+	}
+
+	var extras []backend
+	for _, candidate := range candidates {
+		if candidate.pod.Name == primary {
+			continue
+		}
+
+		extra, err := t.connectBackend(parent, restConfig, candidate)
+		if err != nil {
+			t.reportError(fmt.Errorf("balancing %s/%s to pod %s: %w", t.namespace, target, candidate.pod.Name, err))
+			continue
+		}
+
+		extras = append(extras, extra)
+	}
+
+	return extras
+}
+
+func (t *tunnel) connectBackend(ctx context.Context, restConfig *rest.Config, candidate resolvedTarget) (backend, error) {
+	remotes, err := resolvePorts(candidate, t.requestedPorts())
+	if err != nil {
+		return backend{}, err
+	}
+
+	if err := t.checkDeclaredPorts(candidate.pod, remotes); err != nil {
+		return backend{}, err
+	}
+
+	dialer, err := newDialer(restConfig, t.namespace, candidate.pod.Name, &t.config.options)
+	if err != nil {
+		return backend{}, err
+	}
+
+	conn, err := dialPod(ctx, dialer, t.config.options.dialTimeout)
+	if err != nil {
+		return backend{}, err
+	}
+
+	return backend{conn: conn, pod: candidate.pod.Name, remotes: remotes}, nil
+}
+
+// replaceExtras closes or retires the current extra connections and rotates
+// over the new ones. The mutex must be held.
+func (t *tunnel) replaceExtras(extras []backend, drain bool) {
+	for _, extra := range t.extras {
+		if drain {
+			t.retire(extra.conn)
+		} else {
+			extra.conn.Close()
+		}
+		addLoad(t.namespace, extra.pod, -1)
+	}
+
+	t.extras = extras
+	for _, extra := range extras {
+		addLoad(t.namespace, extra.pod, 1)
+		go t.dropWhenClosed(extra)
+	}
+}
+
+// dropWhenClosed removes the extra connection from the rotation when it is
+// lost.
+func (t *tunnel) dropWhenClosed(extra backend) {
+	<-extra.conn.CloseChan()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i, other := range t.extras {
+		if other.conn == extra.conn {
+			t.extras = append(t.extras[:i:i], t.extras[i+1:]...)
+			addLoad(t.namespace, extra.pod, -1)
+			return
+		}
+	}
+}
+
+func closeBackends(backends []backend) {
+	for _, b := range backends {
+		b.conn.Close()
+	}
+}
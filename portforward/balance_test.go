@@ -0,0 +1,238 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLeastLoadedPicksPodWithFewestLoad(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	candidates := []resolvedTarget{
+		{pod: newTestPod("busy", nil, true, now)},
+		{pod: newTestPod("idle", nil, true, now.Add(-time.Hour))},
+	}
+	addLoad("default", "busy", 2)
+	defer addLoad("default", "busy", -2)
+
+	// Act
+	picked := leastLoaded(candidates)
+
+	// Assert
+	if picked.pod.Name != "idle" {
+		t.Errorf("Expected the idle pod but got %s", picked.pod.Name)
+	}
+
+	if newest(candidates).pod.Name != "busy" {
+		t.Errorf("Newest strategy should pick the first candidate")
+	}
+}
+
+func TestForwardsSpreadOverPods(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "spread-1", "spread-2")
+	ctx := context.Background()
+	ports := []PortMapping{{Remote: 8080}}
+
+	// Both pods match the selector.
+	for _, name := range []string{"spread-1", "spread-2"} {
+		pod, _ := config.clientset.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+		pod.Labels["group"] = "spread"
+		_, _ = config.clientset.CoreV1().Pods("default").Update(ctx, pod, metav1.UpdateOptions{})
+	}
+
+	// Act
+	first, err := NewForwarder(ctx, config, "default", "selector/group=spread", ports, WithPodStrategy(LeastLoadedPod))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer first.Stop()
+	if err := first.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, err := NewForwarder(ctx, config, "default", "selector/group=spread", ports, WithPodStrategy(LeastLoadedPod))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer second.Stop()
+	if err := second.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	if first.tunnel.podName() == second.tunnel.podName() {
+		t.Errorf("Forwards should use different pods but both use %s", first.tunnel.podName())
+	}
+}
+
+func TestLoadBalancingRotatesOverPods(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "balanced-1", "balanced-2")
+	ctx := context.Background()
+
+	for _, name := range []string{"balanced-1", "balanced-2"} {
+		pod, _ := server.config.clientset.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+		pod.Labels["group"] = "balanced"
+		_, _ = server.config.clientset.CoreV1().Pods("default").Update(ctx, pod, metav1.UpdateOptions{})
+	}
+
+	forwarder, err := NewForwarder(ctx, server.config, "default", "selector/group=balanced", []PortMapping{{Remote: 8080}}, WithLoadBalancing())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	for i := 0; i < 4; i++ {
+		assertEcho(t, forwarder.Ports()[0].Local)
+	}
+
+	// Assert
+	for _, name := range []string{"balanced-1", "balanced-2"} {
+		if count := server.streamCount(name); count != 2 {
+			t.Errorf("Expected 2 connections to %s but got %d", name, count)
+		}
+	}
+}
+
+func TestLoadBalancingDropsLostPod(t *testing.T) {
+	// Arrange
+	tunnel := newTunnel(context.Background(), nil, "default", "deploy/web", nil, newOptions(nil))
+	primary, extra := newFakeConnection(), newFakeConnection()
+	tunnel.conn, tunnel.pod = primary, "web-1"
+
+	tunnel.mutex.Lock()
+	tunnel.replaceExtras([]backend{{conn: extra, pod: "web-2"}}, false)
+	tunnel.mutex.Unlock()
+
+	// Act
+	extra.Close()
+
+	// Assert
+	dropped := waitFor(5*time.Second, func() bool {
+		tunnel.mutex.Lock()
+		defer tunnel.mutex.Unlock()
+		return len(tunnel.extras) == 0
+	})
+	if !dropped {
+		t.Fatalf("Lost connection should be dropped from the rotation")
+	}
+
+	for i := 0; i < 3; i++ {
+		if current, ok := tunnel.connection(); !ok || current.pod != "web-1" {
+			t.Errorf("Expected the primary pod but got %v", current.pod)
+		}
+	}
+}
+
+func TestPickerPrefersPinnedPod(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	candidates := []resolvedTarget{
+		{pod: newTestPod("web-2", nil, true, now)},
+		{pod: newTestPod("web-1", nil, true, now.Add(-time.Hour))},
+	}
+
+	tunnel := newTunnel(context.Background(), nil, "default", "deploy/web", nil, newOptions(nil))
+	tunnel.pod = "web-1"
+
+	// Act
+	picked := tunnel.picker("deploy/web")(candidates)
+
+	// Assert
+	if picked.pod.Name != "web-1" {
+		t.Errorf("Expected the pinned pod web-1 but got %s", picked.pod.Name)
+	}
+}
+
+func TestPickerWithoutPinnedCandidate(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	candidates := []resolvedTarget{
+		{pod: newTestPod("web-3", nil, true, now)},
+		{pod: newTestPod("web-2", nil, true, now.Add(-time.Hour))},
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		pod  string
+	}{
+		{"pinned pod is gone", nil, "web-1"},
+		{"without sticky pod", []Option{WithoutStickyPod()}, "web-2"},
+	}
+
+	for _, c := range cases {
+		tunnel := newTunnel(context.Background(), nil, "default", "deploy/web", nil, newOptions(c.opts))
+		tunnel.pod = c.pod
+
+		// Act
+		picked := tunnel.picker("deploy/web")(candidates)
+
+		// Assert
+		if picked.pod.Name != "web-3" {
+			t.Errorf("%s: expected the newest pod web-3 but got %s", c.name, picked.pod.Name)
+		}
+	}
+}
+
+func TestPickerAfterRetarget(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	candidates := []resolvedTarget{
+		{pod: newTestPod("canary-1", nil, true, now)},
+		{pod: newTestPod("web-1", nil, true, now.Add(-time.Hour))},
+	}
+
+	tunnel := newTunnel(context.Background(), nil, "default", "deploy/web", nil, newOptions(nil))
+	tunnel.pod = "web-1"
+
+	// Act
+	picked := tunnel.picker("selector/app=web")(candidates)
+
+	// Assert
+	if picked.pod.Name != "canary-1" {
+		t.Errorf("Expected the newest pod of the new target but got %s", picked.pod.Name)
+	}
+}
+
+func TestForwardReconnectsToPinnedPod(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	ctx := context.Background()
+	clientset := server.config.clientset
+
+	_, _ = clientset.CoreV1().Pods("default").Create(ctx, newTestPod("sticky-1", map[string]string{"group": "sticky"}, true, time.Now().Add(-time.Hour)), metav1.CreateOptions{})
+
+	forwarder, err := NewForwarder(ctx, server.config, "default", "selector/group=sticky", []PortMapping{{Remote: 8080}}, WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, _ = clientset.CoreV1().Pods("default").Create(ctx, newTestPod("sticky-2", map[string]string{"group": "sticky"}, true, time.Now()), metav1.CreateOptions{})
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	if !waitFor(10*time.Second, func() bool { return server.dialCount() == 2 }) {
+		t.Fatalf("Forward did not reconnect")
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	if pod := forwarder.tunnel.podName(); pod != "sticky-1" {
+		t.Errorf("Expected the pinned pod sticky-1 but got %s", pod)
+	}
+}
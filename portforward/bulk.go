@@ -0,0 +1,61 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ===== Bulk forwarding =====
+
+/*
+Tooling often starts many forwards at once. They are set up in parallel and a
+failed forward does not keep the others from starting, every forward is
+managed in the registry like with ForwardPorts.
+*/
+
+// ForwardSpec describes a forward of ForwardAll.
+type ForwardSpec struct {
+	Namespace string
+	Target    string
+	Ports     []PortMapping
+	Options   []Option
+}
+
+// ForwardResult is the outcome of a ForwardSpec.
+type ForwardResult struct {
+	Spec ForwardSpec
+	// Ports are the bound mappings of a successful forward.
+	Ports []PortMapping
+	Err   error
+}
+
+// ForwardAll starts the forwards in parallel and returns a result for every
+// spec in the same order. The error aggregates the errors of the failed
+// forwards, the others keep running.
+func ForwardAll(ctx context.Context, config *Config, specs []ForwardSpec) ([]ForwardResult, error) {
+	results := make([]ForwardResult, len(specs))
+
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func(i int, spec ForwardSpec) {
+			defer wg.Done()
+
+			ports, err := ForwardWithContext(ctx, config, spec.Namespace, spec.Target, spec.Ports, spec.Options...)
+			results[i] = ForwardResult{Spec: spec, Ports: ports, Err: err}
+		}(i, spec)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("forwarding %s/%s: %w", result.Spec.Namespace, result.Spec.Target, result.Err))
+		}
+	}
+
+	return results, utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,59 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+)
+
+func TestForwardAll(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "bulk-pod-1", "bulk-pod-2")
+
+	specs := []ForwardSpec{
+		{Namespace: "default", Target: "bulk-pod-1", Ports: []PortMapping{{Remote: 8080}}},
+		{Namespace: "default", Target: "missing-bulk-pod", Ports: []PortMapping{{Remote: 8080}}},
+		{Namespace: "default", Target: "bulk-pod-2", Ports: []PortMapping{{Remote: 8080}}},
+	}
+	defer StopForwarding("default", "bulk-pod-1")
+	defer StopForwarding("default", "bulk-pod-2")
+
+	// Act
+	results, err := ForwardAll(context.Background(), config, specs)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for the missing pod")
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results but got %d", len(results))
+	}
+
+	if results[1].Err == nil {
+		t.Errorf("Missing pod should fail")
+	}
+
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil {
+			t.Fatalf("Unexpected error for %s: %v", results[i].Spec.Target, results[i].Err)
+		}
+		if results[i].Spec.Target != specs[i].Target {
+			t.Errorf("Expected result of %s but got %s", specs[i].Target, results[i].Spec.Target)
+		}
+		assertEcho(t, results[i].Ports[0].Local)
+	}
+}
+
+func TestForwardAllWithoutErrors(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "bulk-ok-pod")
+	defer StopForwarding("default", "bulk-ok-pod")
+
+	// Act
+	_, err := ForwardAll(context.Background(), config, []ForwardSpec{{Namespace: "default", Target: "bulk-ok-pod", Ports: []PortMapping{{Remote: 8080}}}})
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package portforward
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ===== Traffic capture =====
+
+/*
+Connection issues with forwarded databases or gRPC services are easiest to
+analyze in Wireshark. The forward does not see packets, only the bytes of the
+local connections, so the capture synthesizes a TCP connection per local
+connection: the handshake, a segment per read or write and the FINs at the
+end. The client is the local client, the server is the address the client
+connected to with the remote port, so Wireshark picks the dissector of the
+remote port. The file is a classic pcap file of raw IP packets.
+*/
+
+const (
+	pcapMagic    = 0xa1b2c3d4
+	pcapSnapLen  = 65535
+	pcapLinkRaw  = 101
+	captureChunk = 60000
+
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// WithCapture writes the traffic of the local connections to a pcap file,
+// an existing file is replaced.
+func WithCapture(path string) Option {
+	return func(o *options) {
+		o.capturePath = path
+	}
+}
+
+// capture is an open pcap file. Closing it waits for the open connections,
+// so their ends are recorded.
+type capture struct {
+	mutex   sync.Mutex
+	file    *os.File
+	conns   int
+	closing bool
+	closed  bool
+	// nextPort numbers the clients of Unix sockets.
+	nextPort uint16
+}
+
+func openCapture(path string) (*capture, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating capture file: %w", err)
+	}
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkRaw)
+
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("writing capture file: %w", err)
+	}
+
+	return &capture{file: file, nextPort: 40000}, nil
+}
+
+func (c *capture) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closing = true
+	if c.conns > 0 {
+		return nil
+	}
+
+	c.closed = true
+	return c.file.Close()
+}
+
+// release ends a connection and closes a closing file after the last one.
+func (c *capture) release() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conns--
+	if c.closing && c.conns == 0 && !c.closed {
+		c.closed = true
+		_ = c.file.Close()
+	}
+}
+
+// write adds a packet, packets after closing are dropped.
+func (c *capture) write(packet []byte) {
+	record := make([]byte, 16, 16+len(packet))
+	now := time.Now()
+	binary.LittleEndian.PutUint32(record[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+	record = append(record, packet...)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.closed {
+		_, _ = c.file.Write(record)
+	}
+}
+
+// endpoint is one side of a synthesized TCP connection.
+type endpoint struct {
+	ip   net.IP
+	port uint16
+	seq  uint32
+}
+
+// captureConn records the traffic of a local connection.
+type captureConn struct {
+	net.Conn
+	capture   *capture
+	mutex     sync.Mutex
+	client    endpoint
+	server    endpoint
+	closeOnce sync.Once
+}
+
+// captured records the local connection if the forward has a capture.
+func (t *tunnel) captured(local net.Conn, remotePort int) net.Conn {
+	if t.capture == nil {
+		return local
+	}
+
+	t.capture.mutex.Lock()
+	t.capture.conns++
+	t.capture.mutex.Unlock()
+
+	c := &captureConn{Conn: local, capture: t.capture}
+	c.client, c.server = t.capture.endpoints(local, remotePort)
+
+	c.segment(&c.client, &c.server, tcpSYN, nil)
+	c.segment(&c.server, &c.client, tcpSYN|tcpACK, nil)
+	c.segment(&c.client, &c.server, tcpACK, nil)
+
+	return c
+}
+
+// endpoints returns the client and the server of the local connection.
+func (c *capture) endpoints(local net.Conn, remotePort int) (endpoint, endpoint) {
+	client := endpoint{ip: net.IPv4(127, 0, 0, 1), seq: 1000}
+	server := endpoint{ip: net.IPv4(127, 0, 0, 1), port: uint16(remotePort), seq: 5000}
+
+	remote, remoteOk := local.RemoteAddr().(*net.TCPAddr)
+	own, ownOk := local.LocalAddr().(*net.TCPAddr)
+	if remoteOk && ownOk && (remote.IP.To4() == nil) == (own.IP.To4() == nil) {
+		client.ip, client.port = remote.IP, uint16(remote.Port)
+		server.ip = own.IP
+		return client, server
+	}
+
+	c.mutex.Lock()
+	client.port = c.nextPort
+	c.nextPort++
+	c.mutex.Unlock()
+
+	return client, server
+}
+
+func (c *captureConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.data(&c.client, &c.server, p[:n])
+
+	return n, err
+}
+
+func (c *captureConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.data(&c.server, &c.client, p[:n])
+
+	return n, err
+}
+
+func (c *captureConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.segment(&c.client, &c.server, tcpFIN|tcpACK, nil)
+		c.segment(&c.server, &c.client, tcpFIN|tcpACK, nil)
+		c.segment(&c.client, &c.server, tcpACK, nil)
+		c.capture.release()
+	})
+
+	return c.Conn.Close()
+}
+
+func (c *captureConn) data(from, to *endpoint, data []byte) {
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > captureChunk {
+			chunk = chunk[:captureChunk]
+		}
+		data = data[len(chunk):]
+
+		c.segment(from, to, tcpPSH|tcpACK, chunk)
+	}
+}
+
+// segment records a TCP segment and advances the sequence number of from.
+func (c *captureConn) segment(from, to *endpoint, flags byte, payload []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	tcp := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], from.port)
+	binary.BigEndian.PutUint16(tcp[2:], to.port)
+	binary.BigEndian.PutUint32(tcp[4:], from.seq)
+	if flags&tcpACK != 0 {
+		binary.BigEndian.PutUint32(tcp[8:], to.seq)
+	}
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+
+	from.seq += uint32(len(payload))
+	if flags&(tcpSYN|tcpFIN) != 0 {
+		from.seq++
+	}
+
+	c.capture.write(ipPacket(from.ip, to.ip, tcp))
+}
+
+// ipPacket wraps the TCP segment in an IPv4 or IPv6 packet with checksums.
+func ipPacket(source, destination net.IP, tcp []byte) []byte {
+	var header, pseudo []byte
+
+	if source.To4() != nil {
+		header = make([]byte, 20)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(20+len(tcp)))
+		header[8] = 64
+		header[9] = 6
+		copy(header[12:], source.To4())
+		copy(header[16:], destination.To4())
+		binary.BigEndian.PutUint16(header[10:], checksum(header))
+
+		pseudo = append(append([]byte{}, header[12:20]...), 0, 6, byte(len(tcp)>>8), byte(len(tcp)))
+	} else {
+		header = make([]byte, 40)
+		header[0] = 0x60
+		binary.BigEndian.PutUint16(header[4:], uint16(len(tcp)))
+		header[6] = 6
+		header[7] = 64
+		copy(header[8:], source.To16())
+		copy(header[24:], destination.To16())
+
+		pseudo = append(append([]byte{}, header[8:40]...), 0, 0, byte(len(tcp)>>8), byte(len(tcp)), 0, 0, 0, 6)
+	}
+
+	binary.BigEndian.PutUint16(tcp[16:], checksum(append(pseudo, tcp...)))
+
+	return append(header, tcp...)
+}
+
+// checksum is the internet checksum of RFC 1071.
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return ^uint16(sum)
+}
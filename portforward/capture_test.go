@@ -0,0 +1,111 @@
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// capturedPackets parses the packets of a pcap file.
+func capturedPackets(t *testing.T, path string) [][]byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != pcapMagic || binary.LittleEndian.Uint32(data[20:]) != pcapLinkRaw {
+		t.Fatalf("Expected a pcap header of raw IP packets")
+	}
+
+	var packets [][]byte
+	for rest := data[24:]; len(rest) >= 16; {
+		length := int(binary.LittleEndian.Uint32(rest[8:]))
+		packets = append(packets, rest[16:16+length])
+		rest = rest[16+length:]
+	}
+
+	return packets
+}
+
+func TestForwardWithCapture(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "capture-pod")
+	path := filepath.Join(t.TempDir(), "forward.pcap")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "capture-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"), WithCapture(path))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	assertEchoRoundTrip(t, conn)
+	conn.Close()
+	forwarder.Stop()
+	<-forwarder.done
+
+	// Assert
+	waitFor(5*time.Second, func() bool {
+		packets := capturedPackets(t, path)
+		// The client acknowledges the FIN of the server last.
+		return len(packets) > 1 && packets[len(packets)-2][33] == tcpFIN|tcpACK
+	})
+	packets := capturedPackets(t, path)
+
+	var flags []byte
+	var toPod, fromPod int
+	for _, packet := range packets {
+		if checksum(packet[:20]) != 0 {
+			t.Errorf("Invalid IP checksum")
+		}
+
+		tcp := packet[20:]
+		flags = append(flags, tcp[13])
+		if binary.BigEndian.Uint16(tcp[2:]) == 8080 && bytes.Equal(tcp[20:], []byte("ping")) {
+			toPod++
+		}
+		if binary.BigEndian.Uint16(tcp[0:]) == 8080 && bytes.Equal(tcp[20:], []byte("ping")) {
+			fromPod++
+		}
+	}
+
+	if len(flags) < 3 || flags[0] != tcpSYN || flags[1] != tcpSYN|tcpACK || flags[2] != tcpACK {
+		t.Errorf("Expected a TCP handshake but got the flags %v", flags)
+	}
+
+	if toPod != 1 || fromPod != 1 {
+		t.Errorf("Expected the ping in both directions but got %d to and %d from the pod", toPod, fromPod)
+	}
+
+	if last := flags[len(flags)-1]; last != tcpACK {
+		t.Errorf("Expected the connection to be closed but the last flags are %v", last)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	// Arrange
+	header := []byte{0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7}
+
+	// Act
+	sum := checksum(header)
+
+	// Assert
+	if sum != 0xb861 {
+		t.Errorf("Expected checksum 0xb861 but got %#x", sum)
+	}
+}
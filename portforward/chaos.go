@@ -0,0 +1,151 @@
+package portforward
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ===== Chaos mode =====
+
+/*
+Clients behind a forward should survive slow and flaky networks, e.g. their
+retries and timeouts. Chaos mode injects the faults into the local connections
+so they can be tested without external tools: every read from and write to a
+local client is delayed by the latency plus a random jitter and resets the
+connection with the reset rate. The faults are random, a seed repeats them.
+*/
+
+// errChaosReset is returned by the reads and writes of a connection that
+// chaos mode reset.
+var errChaosReset = errors.New("connection reset by chaos mode")
+
+// Chaos describes the faults that are injected into the local connections.
+type Chaos struct {
+	// Latency delays every read and write.
+	Latency time.Duration
+	// Jitter adds a random delay of up to the jitter.
+	Jitter time.Duration
+	// ResetRate is the probability between 0 and 1 that a read or write
+	// resets the connection.
+	ResetRate float64
+	// Seed makes the faults repeatable, zero seeds with the time.
+	Seed int64
+}
+
+// WithChaos injects latency, jitter and connection resets into the local
+// connections of the forward. It is meant for testing clients.
+func WithChaos(chaos Chaos) Option {
+	return func(o *options) {
+		o.chaos = &chaos
+	}
+}
+
+// chaosSource draws the faults of a forward, rand.Rand is not safe for
+// concurrent use.
+type chaosSource struct {
+	chaos Chaos
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newChaosSource(chaos *Chaos) *chaosSource {
+	if chaos == nil {
+		return nil
+	}
+
+	seed := chaos.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &chaosSource{chaos: *chaos, rand: rand.New(rand.NewSource(seed))}
+}
+
+// next returns the delay of the next read or write and whether it resets the
+// connection.
+func (s *chaosSource) next() (time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.chaos.ResetRate > 0 && s.rand.Float64() < s.chaos.ResetRate {
+		return 0, true
+	}
+
+	delay := s.chaos.Latency
+	if s.chaos.Jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.chaos.Jitter) + 1))
+	}
+
+	return delay, false
+}
+
+// chaosConn injects the faults into a local connection.
+type chaosConn struct {
+	net.Conn
+	source *chaosSource
+	// stopped ends the delays when the forward stops.
+	stopped <-chan struct{}
+}
+
+// chaotic injects the faults into the local connection in chaos mode.
+func (t *tunnel) chaotic(local net.Conn) net.Conn {
+	if t.chaos == nil {
+		return local
+	}
+
+	return &chaosConn{Conn: local, source: t.chaos, stopped: t.stopChan}
+}
+
+func (c *chaosConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if fault := c.inject(); fault != nil {
+			return 0, fault
+		}
+	}
+
+	return n, err
+}
+
+func (c *chaosConn) Write(p []byte) (int, error) {
+	if err := c.inject(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(p)
+}
+
+// inject delays the data or resets the connection.
+func (c *chaosConn) inject() error {
+	delay, reset := c.source.next()
+	if reset {
+		c.reset()
+		return errChaosReset
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-c.stopped:
+			return errStopped
+		}
+	}
+
+	return nil
+}
+
+// reset closes the connection, TCP clients receive a RST instead of a FIN.
+func (c *chaosConn) reset() {
+	if tcp, ok := c.Conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+
+	c.Conn.Close()
+}
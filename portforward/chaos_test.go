@@ -0,0 +1,96 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestForwardWithChaosLatency(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "slow-chaos-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "slow-chaos-pod", []PortMapping{{Remote: 8080}}, WithChaos(Chaos{Latency: 100 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	start := time.Now()
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	// Assert
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected the latency of the read and the write but took %s", elapsed)
+	}
+}
+
+func TestForwardWithChaosResets(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "reset-chaos-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "reset-chaos-pod", []PortMapping{{Remote: 8080}}, WithChaos(Chaos{ResetRate: 1}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	_, _ = conn.Write([]byte("ping"))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 4))
+
+	// Assert
+	if err == nil {
+		t.Errorf("Connection should be reset")
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Errorf("Connection should be reset instead of timing out")
+	}
+}
+
+func TestChaosSourceIsRepeatable(t *testing.T) {
+	// Arrange
+	chaos := Chaos{Latency: 10 * time.Millisecond, Jitter: 50 * time.Millisecond, ResetRate: 0.3, Seed: 42}
+	first, second := newChaosSource(&chaos), newChaosSource(&chaos)
+
+	for i := 0; i < 100; i++ {
+		// Act
+		delay, reset := first.next()
+		otherDelay, otherReset := second.next()
+
+		// Assert
+		if delay != otherDelay || reset != otherReset {
+			t.Fatalf("Faults of the same seed differ at %d", i)
+		}
+
+		if !reset && (delay < chaos.Latency || delay > chaos.Latency+chaos.Jitter) {
+			t.Fatalf("Delay %s is outside of the latency and the jitter", delay)
+		}
+	}
+}
+
+func TestChaosSourceWithoutChaos(t *testing.T) {
+	// Act
+	source := newChaosSource(nil)
+
+	// Assert
+	if source != nil {
+		t.Errorf("No chaos source should be created without chaos")
+	}
+}
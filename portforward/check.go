@@ -0,0 +1,106 @@
+package portforward
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterDiagnostics is the result of a connectivity check against the API server.
+type ClusterDiagnostics struct {
+	Host          string
+	ServerVersion string
+	// Reachable reports whether the API server answered at all.
+	Reachable bool
+	// Authenticated reports whether the credentials were accepted.
+	Authenticated bool
+	// CanPortForward reports whether the user may port-forward to pods
+	// in the default namespace of the context.
+	CanPortForward bool
+}
+
+// CheckCluster verifies that the API server is reachable and the credentials are
+// valid. The diagnostics are also returned when the check fails to tell at
+// which step it failed.
+func CheckCluster(configPath, kubeContext string) (*ClusterDiagnostics, error) {
+	config, err := LoadConfig(configPath, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkCluster(config)
+}
+
+func checkCluster(config *Config) (*ClusterDiagnostics, error) {
+	restConfig, clientset := config.client()
+
+	diagnostics := &ClusterDiagnostics{Host: restConfig.Host}
+
+	// REACHABILITY
+	// The version endpoint is usually readable without any credentials.
+	versionCtx, cancelVersion := config.requestContext()
+	version, err := serverVersion(versionCtx, clientset)
+	cancelVersion()
+	if err != nil {
+		return diagnostics, fmt.Errorf("API server %s is not reachable: %w", diagnostics.Host, err)
+	}
+
+	diagnostics.Reachable = true
+	diagnostics.ServerVersion = version.GitVersion
+
+	// CREDENTIALS
+	// Every authenticated user may review its own permissions.
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   config.defaultNamespace(),
+				Verb:        "create",
+				Resource:    "pods",
+				Subresource: "portforward",
+			},
+		},
+	}
+
+	ctx, cancel := config.requestContext()
+	defer cancel()
+
+	review, err = clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if apierrors.IsUnauthorized(err) {
+		return diagnostics, fmt.Errorf("credentials were rejected by API server %s: %w", diagnostics.Host, err)
+	} else if err != nil {
+		return diagnostics, err
+	}
+
+	diagnostics.Authenticated = true
+	diagnostics.CanPortForward = review.Status.Allowed
+
+	return diagnostics, nil
+}
+
+// serverVersion reads the version endpoint within the context, ServerVersion
+// of the discovery client takes no context.
+func serverVersion(ctx context.Context, clientset kubernetes.Interface) (*version.Info, error) {
+	client := clientset.Discovery().RESTClient()
+	if client == nil {
+		// Fake discovery clients have no REST client.
+		return clientset.Discovery().ServerVersion()
+	}
+
+	body, err := client.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &version.Info{}
+	if err := json.Unmarshal(body, info); err != nil {
+		return nil, fmt.Errorf("invalid version of the API server: %w", err)
+	}
+
+	return info, nil
+}
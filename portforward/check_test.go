@@ -0,0 +1,124 @@
+package portforward
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckCluster(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset()
+	config := &Config{restConfig: &rest.Config{Host: "https://example.com"}, clientset: clientset, namespace: "default"}
+
+	// Act
+	diagnostics, err := checkCluster(config)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !diagnostics.Reachable || !diagnostics.Authenticated {
+		t.Errorf("Expected a reachable and authenticated cluster but got %+v", diagnostics)
+	}
+}
+
+func TestCheckClusterWithRejectedCredentials(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewUnauthorized("token expired")
+	})
+	config := &Config{restConfig: &rest.Config{Host: "https://example.com"}, clientset: clientset, namespace: "default"}
+
+	// Act
+	diagnostics, err := checkCluster(config)
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned when the credentials are rejected")
+	}
+
+	var statusErr *apierrors.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Errorf("Expected the API error to be wrapped but got %v", err)
+	}
+
+	if !diagnostics.Reachable || diagnostics.Authenticated {
+		t.Errorf("Expected a reachable but unauthenticated cluster but got %+v", diagnostics)
+	}
+}
+
+// newCheckedConfig returns a config with a real clientset for the handler.
+func newCheckedConfig(t *testing.T, handler http.HandlerFunc, options configOptions) *Config {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	restConfig := &rest.Config{Host: server.URL}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return &Config{restConfig: restConfig, clientset: clientset, namespace: "default", options: options}
+}
+
+func TestCheckClusterReadsServerVersion(t *testing.T) {
+	// Arrange
+	config := newCheckedConfig(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"gitVersion": "v1.21.2"}`))
+	}, configOptions{})
+
+	// Act
+	diagnostics, err := checkCluster(config)
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned for the rejected review")
+	}
+
+	if !diagnostics.Reachable || diagnostics.ServerVersion != "v1.21.2" {
+		t.Errorf("Expected a reachable cluster with its version but got %+v", diagnostics)
+	}
+}
+
+func TestCheckClusterWithStalledAPIServer(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	config := newCheckedConfig(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, configOptions{requestTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { close(release) })
+
+	// Act
+	started := time.Now()
+	diagnostics, err := checkCluster(config)
+
+	// Assert
+	if err == nil || diagnostics.Reachable {
+		t.Errorf("Expected an unreachable cluster but got %+v, %v", diagnostics, err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Check should time out but took %s", elapsed)
+	}
+}
@@ -0,0 +1,464 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
+)
+
+// ===== Reusable config =====
+
+// Config is a resolved kubeconfig that can be shared by several forwards.
+// Loading it once avoids re-parsing the kubeconfig and re-running exec
+// plugins for every single forward.
+type Config struct {
+	source  configSource
+	options configOptions
+
+	mutex      sync.RWMutex
+	restConfig *rest.Config
+	clientset  kubernetes.Interface
+	namespace  string
+	// loaded is the unmodified result of the kubeconfig to detect changes.
+	loaded *rest.Config
+
+	watcher
+}
+
+// ConfigOption customizes how a Config is loaded.
+type ConfigOption func(*configOptions)
+
+type configOptions struct {
+	userAgent      string
+	tlsServerName  string
+	requestTimeout time.Duration
+	dialTimeout    time.Duration
+	reloadInterval time.Duration
+	execEnv        map[string]string
+	nonInteractive bool
+	cluster        string
+	dial           DialContextFunc
+	hostAliases    map[string]string
+	resolver       *net.Resolver
+	wrappers       []transport.WrapperFunc
+	websocket      bool
+	keepAlive      time.Duration
+	pingPeriod     time.Duration
+}
+
+// apply customizes the loaded rest config.
+func (o *configOptions) apply(restConfig *rest.Config) {
+	if o.userAgent != "" {
+		restConfig.UserAgent = o.userAgent
+	}
+
+	if o.tlsServerName != "" {
+		restConfig.TLSClientConfig.ServerName = o.tlsServerName
+	}
+
+	if restConfig.ExecProvider != nil {
+		restConfig.ExecProvider = o.execConfig(restConfig.ExecProvider)
+	}
+
+	dial := o.dial
+	if len(o.hostAliases) > 0 || o.resolver != nil {
+		dial = resolvingDial(dial, o.hostAliases, o.resolver)
+	}
+
+	if o.keepAlive != 0 {
+		dial = keepAliveDial(dial, o.keepAlive)
+	}
+
+	if dial != nil {
+		restConfig.Dial = dial
+	}
+}
+
+// execConfig returns a copy of the exec plugin config with the options applied.
+func (o *configOptions) execConfig(original *clientcmdapi.ExecConfig) *clientcmdapi.ExecConfig {
+	execConfig := *original
+	execConfig.Env = append([]clientcmdapi.ExecEnvVar(nil), original.Env...)
+
+	names := make([]string, 0, len(o.execEnv))
+	for name := range o.execEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		execConfig.Env = append(execConfig.Env, clientcmdapi.ExecEnvVar{Name: name, Value: o.execEnv[name]})
+	}
+
+	// client-go fails instead of waiting for input when a plugin requires
+	// stdin that is not available.
+	if o.nonInteractive {
+		execConfig.StdinUnavailable = true
+		execConfig.StdinUnavailableMessage = "interactive exec plugins are disabled"
+	}
+
+	return &execConfig
+}
+
+// WithUserAgent sets the User-Agent of all API requests so cluster
+// audit logs can attribute the sessions to the calling tool.
+func WithUserAgent(userAgent string) ConfigOption {
+	return func(o *configOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithTLSServerName overrides the server name that is used to verify the
+// certificate of the API server. This allows clusters behind SNI-routing
+// load balancers without disabling the verification.
+func WithTLSServerName(serverName string) ConfigOption {
+	return func(o *configOptions) {
+		o.tlsServerName = serverName
+	}
+}
+
+// WithRequestTimeout limits the duration of each API request that is made
+// while setting up a forward. Without it, a wedged API server blocks forever.
+func WithRequestTimeout(timeout time.Duration) ConfigOption {
+	return func(o *configOptions) {
+		o.requestTimeout = timeout
+	}
+}
+
+// WithDialTimeout limits the upgrade of the connection to a pod, so a
+// half-broken kubelet fails the dial instead of hanging it. API requests are
+// limited by WithRequestTimeout.
+func WithDialTimeout(timeout time.Duration) ConfigOption {
+	return func(o *configOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithExecEnv passes additional environment variables to the exec credential
+// plugin of the kubeconfig. They take precedence over the variables that
+// are defined in the kubeconfig.
+func WithExecEnv(env map[string]string) ConfigOption {
+	return func(o *configOptions) {
+		o.execEnv = env
+	}
+}
+
+// WithNonInteractiveExec makes exec credential plugins that require user
+// input fail with an error instead of waiting for a prompt.
+func WithNonInteractiveExec() ConfigOption {
+	return func(o *configOptions) {
+		o.nonInteractive = true
+	}
+}
+
+// WithWrapTransport adds a middleware to the transport of all API requests,
+// including the SPDY upgrade of the forwards. It can be used multiple times
+// and the last wrapper is the outermost one.
+func WithWrapTransport(wrapper transport.WrapperFunc) ConfigOption {
+	return func(o *configOptions) {
+		o.wrappers = append(o.wrappers, wrapper)
+	}
+}
+
+// WithCluster selects the context whose cluster has the given name or server URL
+// when no context is passed explicitly. Context names often differ between
+// machines while the cluster names are stable.
+func WithCluster(nameOrServer string) ConfigOption {
+	return func(o *configOptions) {
+		o.cluster = nameOrServer
+	}
+}
+
+// LoadConfig resolves the kubeconfig once and returns a handle for ForwardWithConfig.
+// An empty configPath uses the default kubeconfig locations and an empty
+// kubeContext the current context.
+func LoadConfig(configPath, kubeContext string, opts ...ConfigOption) (*Config, error) {
+	return loadConfig(&kubeconfigSource{configPath: configPath, kubeContext: kubeContext}, opts)
+}
+
+// LoadConfigFiles works like LoadConfig but merges several kubeconfig files
+// with the precedence rules of kubectl: the first file that defines a value wins.
+func LoadConfigFiles(configPaths []string, kubeContext string, opts ...ConfigOption) (*Config, error) {
+	if len(configPaths) == 0 {
+		return nil, fmt.Errorf("at least one kubeconfig path is required")
+	}
+
+	return loadConfig(&kubeconfigSource{configPaths: configPaths, kubeContext: kubeContext}, opts)
+}
+
+func loadConfig(source configSource, opts []ConfigOption) (*Config, error) {
+	options := configOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.cluster != "" {
+		kubeconfig, ok := source.(*kubeconfigSource)
+		if !ok {
+			return nil, fmt.Errorf("selecting a context by cluster requires a kubeconfig")
+		}
+
+		if err := kubeconfig.selectCluster(options.cluster); err != nil {
+			return nil, err
+		}
+	}
+
+	config := &Config{source: source, options: options}
+
+	if _, err := config.load(); err != nil {
+		return nil, err
+	}
+
+	if options.reloadInterval > 0 {
+		config.startWatching(options.reloadInterval)
+	}
+
+	return config, nil
+}
+
+// load resolves the kubeconfig and reports whether it differs from the previous one.
+func (c *Config) load() (bool, error) {
+	clientConfig := c.source.clientConfig()
+
+	loaded, err := clientConfig.ClientConfig()
+	if err != nil {
+		return false, err
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return false, err
+	}
+
+	restConfig := rest.CopyConfig(loaded)
+
+	c.options.apply(restConfig)
+
+	if err := applyBuiltinCredentials(restConfig); err != nil {
+		return false, err
+	}
+
+	// Custom middlewares wrap the credentials, so they never see the tokens.
+	for _, wrapper := range c.options.wrappers {
+		restConfig.Wrap(wrapper)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	changed := c.loaded != nil && !sameConfig(c.loaded, loaded)
+
+	c.restConfig, c.clientset, c.namespace, c.loaded = restConfig, clientset, namespace, loaded
+
+	return changed, nil
+}
+
+// client returns the currently loaded rest config and clientset.
+func (c *Config) client() (*rest.Config, kubernetes.Interface) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.restConfig, c.clientset
+}
+
+// requestContext returns the context for a single API request.
+func (c *Config) requestContext() (context.Context, context.CancelFunc) {
+	return c.requestContextFrom(context.Background())
+}
+
+// requestContextFrom returns the context for a single API request that is
+// also cancelled with the parent.
+func (c *Config) requestContextFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	if c.options.requestTimeout > 0 {
+		return context.WithTimeout(parent, c.options.requestTimeout)
+	}
+
+	return context.WithCancel(parent)
+}
+
+// defaultNamespace returns the namespace of the selected context.
+func (c *Config) defaultNamespace() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.namespace == "" {
+		return "default"
+	}
+
+	return c.namespace
+}
+
+// configSource creates the client config of a Config.
+type configSource interface {
+	clientConfig() clientcmd.ClientConfig
+	// files returns the files that are watched for changes.
+	files() []string
+}
+
+// kubeconfigSource reads the config from kubeconfig files.
+type kubeconfigSource struct {
+	configPath string
+	// configPaths are merged when no single configPath is given.
+	configPaths []string
+	kubeContext string
+}
+
+func (k *kubeconfigSource) loadingRules() *clientcmd.ClientConfigLoadingRules {
+	rules := newLoadingRules(k.configPath)
+
+	if len(k.configPaths) > 0 {
+		rules.Precedence = k.configPaths
+	}
+
+	return rules
+}
+
+func (k *kubeconfigSource) clientConfig() clientcmd.ClientConfig {
+	return newClientConfig(k.loadingRules(), k.kubeContext)
+}
+
+// selectCluster sets the context that uses the cluster. The current context
+// is preferred when several contexts use the same cluster.
+func (k *kubeconfigSource) selectCluster(nameOrServer string) error {
+	if k.kubeContext != "" {
+		return nil
+	}
+
+	rawConfig, err := k.loadingRules().Load()
+	if err != nil {
+		return err
+	}
+
+	matches := func(contextName string) bool {
+		context, ok := rawConfig.Contexts[contextName]
+		if !ok {
+			return false
+		}
+
+		if context.Cluster == nameOrServer {
+			return true
+		}
+
+		cluster, ok := rawConfig.Clusters[context.Cluster]
+
+		return ok && strings.TrimSuffix(cluster.Server, "/") == strings.TrimSuffix(nameOrServer, "/")
+	}
+
+	if matches(rawConfig.CurrentContext) {
+		k.kubeContext = rawConfig.CurrentContext
+		return nil
+	}
+
+	names := make([]string, 0, len(rawConfig.Contexts))
+	for name := range rawConfig.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if matches(name) {
+			k.kubeContext = name
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no context uses cluster %q", nameOrServer)
+}
+
+func (k *kubeconfigSource) files() []string {
+	if k.configPath != "" {
+		return []string{k.configPath}
+	}
+
+	return k.loadingRules().GetLoadingPrecedence()
+}
+
+// ===== Kubeconfig inspection =====
+
+// ContextInfo describes a context defined in a kubeconfig.
+type ContextInfo struct {
+	Name      string
+	Cluster   string
+	Namespace string
+}
+
+// ListContexts returns the contexts of the kubeconfig sorted by name.
+// An empty configPath uses the default kubeconfig locations.
+func ListContexts(configPath string) ([]ContextInfo, error) {
+	rawConfig, err := newLoadingRules(configPath).Load()
+	if err != nil {
+		return nil, err
+	}
+
+	contexts := make([]ContextInfo, 0, len(rawConfig.Contexts))
+
+	for name, context := range rawConfig.Contexts {
+		contexts = append(contexts, ContextInfo{
+			Name:      name,
+			Cluster:   context.Cluster,
+			Namespace: context.Namespace,
+		})
+	}
+
+	sort.Slice(contexts, func(i, j int) bool { return contexts[i].Name < contexts[j].Name })
+
+	return contexts, nil
+}
+
+// CurrentContext returns the name and the default namespace of the context
+// that is used for forwarding. An empty kubeContext resolves the current
+// context of the kubeconfig.
+func CurrentContext(configPath, kubeContext string) (string, string, error) {
+	clientConfig := newClientConfig(newLoadingRules(configPath), kubeContext)
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	name := kubeContext
+	if name == "" {
+		name = rawConfig.CurrentContext
+	}
+
+	if _, ok := rawConfig.Contexts[name]; !ok && name != "" {
+		return "", "", fmt.Errorf("context %q does not exist in kubeconfig", name)
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return "", "", err
+	}
+
+	return name, namespace, nil
+}
+
+// newClientConfig resolves the kubeconfig with the given context as override.
+func newClientConfig(rules *clientcmd.ClientConfigLoadingRules, kubeContext string) clientcmd.ClientConfig {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// newLoadingRules uses the explicit path if given and otherwise
+// falls back to $KUBECONFIG and ~/.kube/config.
+func newLoadingRules(configPath string) *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = configPath
+
+	return rules
+}
@@ -0,0 +1,384 @@
+package portforward
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/transport"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://dev.example.com:6443
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+    namespace: team-a
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: prod-user
+users:
+- name: dev-user
+  user:
+    token: dev-token
+- name: prod-user
+  user:
+    token: prod-token
+`
+
+// writeKubeconfig stores the content in a temporary kubeconfig file.
+func writeKubeconfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Could not write kubeconfig: %v", err)
+	}
+
+	return path
+}
+
+func TestListContexts(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	contexts, err := ListContexts(path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []ContextInfo{
+		{Name: "dev", Cluster: "dev-cluster", Namespace: "team-a"},
+		{Name: "prod", Cluster: "prod-cluster", Namespace: ""},
+	}
+
+	if len(contexts) != len(expected) {
+		t.Fatalf("Expected %d contexts but got %d", len(expected), len(contexts))
+	}
+
+	for i := range expected {
+		if contexts[i] != expected[i] {
+			t.Errorf("Expected %v but got %v", expected[i], contexts[i])
+		}
+	}
+}
+
+func TestListContextsWithoutValidConfigPath(t *testing.T) {
+	// Act
+	_, err := ListContexts("foo/bar")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when a not valid config path is provided")
+	}
+}
+
+func TestCurrentContext(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	name, namespace, err := CurrentContext(path, "")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if name != "dev" || namespace != "team-a" {
+		t.Errorf("Expected dev/team-a but got %s/%s", name, namespace)
+	}
+}
+
+func TestCurrentContextWithOverride(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	name, namespace, err := CurrentContext(path, "prod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if name != "prod" || namespace != "default" {
+		t.Errorf("Expected prod/default but got %s/%s", name, namespace)
+	}
+}
+
+func TestCurrentContextWithUnknownContext(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	_, _, err := CurrentContext(path, "staging")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when the context does not exist")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	config, err := LoadConfig(path, "prod", WithUserAgent("myapp-portforward/1.2"))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.restConfig.Host != "https://prod.example.com" {
+		t.Errorf("Expected host of prod cluster but got %s", config.restConfig.Host)
+	}
+
+	if config.restConfig.UserAgent != "myapp-portforward/1.2" {
+		t.Errorf("Expected custom User-Agent but got %s", config.restConfig.UserAgent)
+	}
+}
+
+func TestLoadConfigWithTLSServerName(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	config, err := LoadConfig(path, "", WithTLSServerName("api.internal"))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if restConfig, _ := config.client(); restConfig.TLSClientConfig.ServerName != "api.internal" {
+		t.Errorf("Expected server name api.internal but got %s", restConfig.TLSClientConfig.ServerName)
+	}
+}
+
+func TestRequestContextWithTimeout(t *testing.T) {
+	// Arrange
+	config := &Config{options: configOptions{requestTimeout: time.Second}}
+
+	// Act
+	ctx, cancel := config.requestContext()
+	defer cancel()
+
+	// Assert
+	if _, ok := ctx.Deadline(); !ok {
+		t.Errorf("Request context should have a deadline")
+	}
+}
+
+func TestRequestContextWithoutTimeout(t *testing.T) {
+	// Arrange
+	config := &Config{}
+
+	// Act
+	ctx, cancel := config.requestContext()
+	defer cancel()
+
+	// Assert
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("Request context should not have a deadline")
+	}
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	// Arrange
+	clusters := writeKubeconfig(t, `apiVersion: v1
+kind: Config
+clusters:
+- name: staging-cluster
+  cluster:
+    server: https://staging.example.com
+`)
+	contexts := writeKubeconfig(t, `apiVersion: v1
+kind: Config
+current-context: staging
+contexts:
+- name: staging
+  context:
+    cluster: staging-cluster
+    user: staging-user
+users:
+- name: staging-user
+  user:
+    token: staging-token
+`)
+
+	// Act
+	config, err := LoadConfigFiles([]string{contexts, clusters}, "")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restConfig, _ := config.client()
+
+	if restConfig.Host != "https://staging.example.com" || restConfig.BearerToken != "staging-token" {
+		t.Errorf("Kubeconfig files were not merged: %+v", restConfig)
+	}
+}
+
+const testExecKubeconfig = `apiVersion: v1
+kind: Config
+current-context: exec
+clusters:
+- name: exec-cluster
+  cluster:
+    server: https://exec.example.com
+contexts:
+- name: exec
+  context:
+    cluster: exec-cluster
+    user: exec-user
+users:
+- name: exec-user
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: sh
+      args: ["-c", "echo token"]
+      env:
+      - name: PROFILE
+        value: kubeconfig
+`
+
+func TestLoadConfigWithExecOptions(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testExecKubeconfig)
+
+	// Act
+	config, err := LoadConfig(path, "", WithExecEnv(map[string]string{"PROFILE": "custom"}), WithNonInteractiveExec())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restConfig, _ := config.client()
+	execConfig := restConfig.ExecProvider
+
+	if value := execEnv(execConfig, func(string) string { return "" }, "PROFILE"); value != "custom" {
+		t.Errorf("Expected the passed environment to win but got %s", value)
+	}
+
+	if !execConfig.StdinUnavailable {
+		t.Errorf("Exec plugin should be marked as non-interactive")
+	}
+
+	if len(config.loaded.ExecProvider.Env) != 1 {
+		t.Errorf("Options should not modify the loaded config")
+	}
+}
+
+func TestLoadConfigWithCluster(t *testing.T) {
+	for _, cluster := range []string{"prod-cluster", "https://prod.example.com/"} {
+		// Arrange
+		path := writeKubeconfig(t, testKubeconfig)
+
+		// Act
+		config, err := LoadConfig(path, "", WithCluster(cluster))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if restConfig, _ := config.client(); restConfig.BearerToken != "prod-token" {
+			t.Errorf("Expected the prod context for %s", cluster)
+		}
+	}
+}
+
+func TestLoadConfigWithUnknownCluster(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	_, err := LoadConfig(path, "", WithCluster("staging-cluster"))
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when no context uses the cluster")
+	}
+}
+
+func TestDefaultNamespace(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	// Act
+	dev, errDev := LoadConfig(path, "dev")
+	prod, errProd := LoadConfig(path, "prod")
+
+	// Assert
+	if errDev != nil || errProd != nil {
+		t.Fatalf("Unexpected errors: %v, %v", errDev, errProd)
+	}
+
+	if namespace := dev.defaultNamespace(); namespace != "team-a" {
+		t.Errorf("Expected namespace of the context but got %s", namespace)
+	}
+
+	if namespace := prod.defaultNamespace(); namespace != "default" {
+		t.Errorf("Expected fallback to default but got %s", namespace)
+	}
+}
+
+func TestLoadConfigWithWrapTransport(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	var calls []string
+	wrapper := func(name string) transport.WrapperFunc {
+		return func(rt http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name)
+				return rt.RoundTrip(req)
+			})
+		}
+	}
+
+	// Act
+	config, err := LoadConfig(path, "", WithWrapTransport(wrapper("inner")), WithWrapTransport(wrapper("outer")))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restConfig, _ := config.client()
+	rt := restConfig.WrapTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "outer" || calls[1] != "inner" {
+		t.Errorf("Unexpected order of the wrappers: %v", calls)
+	}
+}
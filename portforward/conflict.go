@@ -0,0 +1,74 @@
+package portforward
+
+import (
+	"fmt"
+)
+
+// ===== Conflict policies =====
+
+/*
+Forward replaces a registered forward to the same namespace and target, so a
+script that runs twice does not leak listeners. Callers that expect to own the
+target fail or reuse the running forward instead. The check happens before
+anything is bound and again when the forward is registered, a racing forward
+that lost is stopped again.
+*/
+
+// ConflictPolicy decides what happens to a new forward when a forward to the
+// namespace and target is already registered.
+type ConflictPolicy int
+
+const (
+	// ConflictReplace stops the registered forwards, the default of Forward.
+	ConflictReplace ConflictPolicy = iota + 1
+	// ConflictFail returns ErrForwardExists.
+	ConflictFail
+	// ConflictKeep keeps the registered forward and returns its ports.
+	ConflictKeep
+
+	// conflictAdd keeps the registered forwards running next to the new one,
+	// the default of ForwardWithID.
+	conflictAdd
+)
+
+// WithConflictPolicy sets the policy for a registered forward to the same
+// namespace and target.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(o *options) {
+		o.conflictPolicy = policy
+	}
+}
+
+// conflicting returns the registered forward that the policy keeps instead of
+// starting a new one.
+func conflicting(namespace, target string, policy ConflictPolicy) *activeForward {
+	if policy != ConflictFail && policy != ConflictKeep {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s/%s", namespace, target)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	forwards := activeForwards[key]
+	if len(forwards) == 0 {
+		return nil
+	}
+
+	return forwards[len(forwards)-1]
+}
+
+// resolveConflict returns the result of a forward for the kept forward.
+func resolveConflict(existing *activeForward, policy ConflictPolicy) (*activeForward, []PortMapping, error) {
+	if policy == ConflictFail {
+		return nil, nil, fmt.Errorf("forward to %s/%s: %w", existing.namespace, existing.target, ErrForwardExists)
+	}
+
+	var ports []PortMapping
+	if existing.forwarder != nil {
+		ports = existing.forwarder.Ports()
+	}
+
+	return existing, ports, nil
+}
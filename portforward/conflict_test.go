@@ -0,0 +1,113 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestForwardReplacesByDefault(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "conflict-replace-pod")
+
+	first, err := ForwardWithContext(context.Background(), config, "default", "conflict-replace-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "conflict-replace-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	second, err := ForwardWithContext(context.Background(), config, "default", "conflict-replace-pod", []PortMapping{{Remote: 8080}}, WithConflictPolicy(ConflictReplace))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !waitForClosedPort(first[0].Local) {
+		t.Errorf("Replaced forward on port %d should be closed", first[0].Local)
+	}
+
+	assertEcho(t, second[0].Local)
+}
+
+func TestForwardWithConflictFail(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "conflict-fail-pod")
+
+	first, err := ForwardWithContext(context.Background(), server.config, "default", "conflict-fail-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "conflict-fail-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dials := server.dialCount()
+
+	// Act
+	_, err = ForwardWithContext(context.Background(), server.config, "default", "conflict-fail-pod", []PortMapping{{Remote: 8080}}, WithConflictPolicy(ConflictFail))
+
+	// Assert
+	if !errors.Is(err, ErrForwardExists) {
+		t.Errorf("Expected ErrForwardExists but got %v", err)
+	}
+
+	if server.dialCount() != dials {
+		t.Errorf("Expected no new connection to the pod but got %d", server.dialCount()-dials)
+	}
+
+	assertEcho(t, first[0].Local)
+}
+
+func TestForwardWithConflictKeep(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "conflict-keep-pod")
+
+	firstID, first, err := ForwardWithID(context.Background(), config, "default", "conflict-keep-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "conflict-keep-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	secondID, second, err := ForwardWithID(context.Background(), config, "default", "conflict-keep-pod", []PortMapping{{Remote: 8080}}, WithConflictPolicy(ConflictKeep))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if secondID != firstID {
+		t.Errorf("Expected the kept forward %s but got %s", firstID, secondID)
+	}
+
+	if len(second) != 1 || second[0] != first[0] {
+		t.Errorf("Expected the ports %v of the kept forward but got %v", first, second)
+	}
+
+	assertEcho(t, first[0].Local)
+}
+
+func TestRegisterWithConflictFailReturnsRegisteredForward(t *testing.T) {
+	// Arrange
+	existing := &activeForward{stopCh: make(chan struct{})}
+	_, _ = register("test_namespace", "conflict_pod", existing, ConflictReplace)
+	defer StopForwarding("test_namespace", "conflict_pod")
+
+	// Act
+	registered, err := register("test_namespace", "conflict_pod", &activeForward{stopCh: make(chan struct{})}, ConflictFail)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if registered != existing {
+		t.Errorf("Expected the registered forward to be returned")
+	}
+
+	select {
+	case <-existing.stopCh:
+		t.Errorf("Registered forward should not be stopped")
+	default:
+		// Success
+	}
+}
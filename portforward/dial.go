@@ -0,0 +1,261 @@
+package portforward
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// ===== Custom dialing of the API server =====
+
+/*
+The SPDY round tripper of client-go only accepts a *net.Dialer, which
+cannot route the traffic through SSH bastions or other tunnels. When a
+custom dial function is configured, the upgrade is done here instead.
+*/
+
+// DialContextFunc opens a connection to the API server, e.g. through a jump host.
+type DialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// WithDialContext routes all traffic to the API server through the dial
+// function, including the streams of the forwards.
+func WithDialContext(dial DialContextFunc) ConfigOption {
+	return func(o *configOptions) {
+		o.dial = dial
+	}
+}
+
+// WithHostAliases resolves the API server hostname with a static mapping of
+// hostnames to IPs, e.g. for split-horizon DNS. Certificates are still
+// verified against the hostname.
+func WithHostAliases(aliases map[string]string) ConfigOption {
+	return func(o *configOptions) {
+		o.hostAliases = aliases
+	}
+}
+
+// WithResolver resolves the API server hostname with a custom DNS resolver.
+func WithResolver(resolver *net.Resolver) ConfigOption {
+	return func(o *configOptions) {
+		o.resolver = resolver
+	}
+}
+
+// resolvingDial resolves the host before dialing with next.
+func resolvingDial(next DialContextFunc, aliases map[string]string, resolver *net.Resolver) DialContextFunc {
+	if next == nil {
+		next = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if ip, ok := aliases[host]; ok {
+			return next(ctx, network, net.JoinHostPort(ip, port))
+		}
+
+		if resolver == nil || net.ParseIP(host) != nil {
+			return next(ctx, network, address)
+		}
+
+		ips, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		// Try all addresses like the default dialer.
+		for _, ip := range ips {
+			var conn net.Conn
+			if conn, err = next(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
+
+// pingPeriod matches the SPDY round tripper of client-go.
+const pingPeriod = 5 * time.Second
+
+// WithPingPeriod sets how often the connections to pods are pinged, the
+// default is 5 seconds. The pings keep idle connections open through load
+// balancers and NAT gateways with short idle timeouts. A negative period
+// disables them.
+func WithPingPeriod(period time.Duration) ConfigOption {
+	return func(o *configOptions) {
+		o.pingPeriod = period
+	}
+}
+
+// pings returns the ping period of the connections to pods, 0 disables them.
+func (o *configOptions) pings() time.Duration {
+	switch {
+	case o.pingPeriod == 0:
+		return pingPeriod
+	case o.pingPeriod < 0:
+		return 0
+	default:
+		return o.pingPeriod
+	}
+}
+
+// roundTripperFor works like spdy.RoundTripperFor but honors the dial function
+// of the config and sends pings with the period.
+func roundTripperFor(config *rest.Config, pings time.Duration) (http.RoundTripper, spdy.Upgrader, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.Dial == nil {
+		proxy := http.ProxyFromEnvironment
+		if config.Proxy != nil {
+			proxy = config.Proxy
+		}
+
+		upgrader := httpspdy.NewRoundTripperWithConfig(httpspdy.RoundTripperConfig{
+			TLS:             tlsConfig,
+			FollowRedirects: true,
+			Proxier:         proxy,
+			PingPeriod:      pings,
+		})
+
+		wrapper, err := rest.HTTPWrappersForConfig(config, upgrader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return wrapper, upgrader, nil
+	}
+
+	upgrader := &dialUpgrader{dial: config.Dial, tlsConfig: tlsConfig, pings: pings}
+
+	wrapper, err := rest.HTTPWrappersForConfig(config, upgrader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return wrapper, upgrader, nil
+}
+
+// dialUpgrader upgrades a single connection to SPDY.
+type dialUpgrader struct {
+	dial      DialContextFunc
+	tlsConfig *tls.Config
+	conn      net.Conn
+	pings     time.Duration
+}
+
+func (d *dialUpgrader) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := d.dialServer(req)
+	if err != nil {
+		return nil, err
+	}
+
+	req = utilnet.CloneRequest(req)
+	req.Header.Add(httpstream.HeaderConnection, httpstream.HeaderUpgrade)
+	req.Header.Add(httpstream.HeaderUpgrade, httpspdy.HeaderSpdy31)
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Frames that were read together with the response must not get lost.
+	d.conn = &bufferedConn{Conn: conn, reader: reader}
+
+	return resp, nil
+}
+
+// dialServer opens the connection and does the TLS handshake for https.
+func (d *dialUpgrader) dialServer(req *http.Request) (net.Conn, error) {
+	address := req.URL.Host
+	if req.URL.Port() == "" {
+		port := "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(req.URL.Hostname(), port)
+	}
+
+	conn, err := d.dial(req.Context(), "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.Scheme != "https" {
+		return conn, nil
+	}
+
+	tlsConfig := d.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = req.URL.Hostname()
+	}
+
+	// The handshake also verifies the certificate against the server name.
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+func (d *dialUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	connection := strings.ToLower(resp.Header.Get(httpstream.HeaderConnection))
+	upgrade := strings.ToLower(resp.Header.Get(httpstream.HeaderUpgrade))
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.Contains(connection, strings.ToLower(httpstream.HeaderUpgrade)) ||
+		!strings.Contains(upgrade, strings.ToLower(httpspdy.HeaderSpdy31)) {
+		defer resp.Body.Close()
+		if d.conn != nil {
+			defer d.conn.Close()
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return nil, fmt.Errorf("unable to upgrade connection: %s", strings.TrimSpace(string(body)))
+	}
+
+	return httpspdy.NewClientConnectionWithPings(d.conn, d.pings)
+}
+
+// bufferedConn reads the bytes that were buffered while parsing the response first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
@@ -0,0 +1,152 @@
+package portforward
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport/spdy"
+)
+
+func TestRoundTripperForUsesDialContext(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := httpspdy.NewResponseUpgrader().UpgradeResponse(w, r, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+			return nil
+		})
+		if conn != nil {
+			<-conn.CloseChan()
+		}
+	}))
+	defer server.Close()
+
+	var dialed string
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		// The host of the kubeconfig is only reachable through the "bastion".
+		dialed = address
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	config := &rest.Config{Host: "http://api.cluster.internal:8080", Dial: dial}
+
+	// Act
+	roundTripper, upgrader, err := roundTripperFor(config, pingPeriod)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	serverURL, _ := url.Parse("http://api.cluster.internal:8080/api/v1/namespaces/ns/pods/pod/portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, serverURL)
+
+	conn, _, err := dialer.Dial("portforward.k8s.io")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	if dialed != "api.cluster.internal:8080" {
+		t.Errorf("Expected dial to the API server address but got %s", dialed)
+	}
+}
+
+func TestResolvingDialWithHostAliases(t *testing.T) {
+	// Arrange
+	var dialed string
+	next := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = address
+		return nil, nil
+	}
+
+	dial := resolvingDial(next, map[string]string{"api.cluster.internal": "10.0.0.1"}, nil)
+
+	// Act
+	_, err := dial(context.Background(), "tcp", "api.cluster.internal:6443")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if dialed != "10.0.0.1:6443" {
+		t.Errorf("Expected dial to the alias but got %s", dialed)
+	}
+}
+
+func TestResolvingDialKeepsUnknownHosts(t *testing.T) {
+	// Arrange
+	var dialed string
+	next := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = address
+		return nil, nil
+	}
+
+	dial := resolvingDial(next, map[string]string{"api.cluster.internal": "10.0.0.1"}, nil)
+
+	// Act
+	_, _ = dial(context.Background(), "tcp", "other.example.com:443")
+
+	// Assert
+	if dialed != "other.example.com:443" {
+		t.Errorf("Expected dial to the original address but got %s", dialed)
+	}
+}
+
+// countingConn counts the bytes written to the connection.
+type countingConn struct {
+	net.Conn
+	written *int64
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(c.written, int64(n))
+
+	return n, err
+}
+
+func TestIdleForwardSendsPings(t *testing.T) {
+	for period, expectPings := range map[time.Duration]bool{50 * time.Millisecond: true, -1: false} {
+		// Arrange
+		server := startFakeAPIServer(t, "idle-pod")
+
+		var written int64
+		server.config.restConfig.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, written: &written}, nil
+		}
+		WithPingPeriod(period)(&server.config.options)
+
+		forwarder, err := NewForwarder(context.Background(), server.config, "default", "idle-pod", []PortMapping{{Remote: 8080}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := forwarder.waitReady(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		before := atomic.LoadInt64(&written)
+
+		// Act
+		time.Sleep(300 * time.Millisecond)
+
+		// Assert
+		pinged := atomic.LoadInt64(&written) > before
+		if pinged != expectPings {
+			t.Errorf("Expected pings %v with the period %s but got %v", expectPings, period, pinged)
+		}
+
+		forwarder.Stop()
+	}
+}
@@ -0,0 +1,198 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// ===== In-process connections =====
+
+// DialPod opens a connection to the port of the target without a local
+// listener, e.g. to hand it to an HTTP or gRPC client. Targets and ports are
+// resolved like for forwards. Every connection upgrades its own connection to
+// the pod, closing it closes both.
+func (c *Config) DialPod(ctx context.Context, namespace, target string, port int) (net.Conn, error) {
+	if namespace == "" {
+		namespace = c.defaultNamespace()
+	}
+
+	dialer, pod, resolved, err := prepareForward(ctx, c, namespace, target, []PortMapping{{Remote: port}}, newest)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialPod(ctx, dialer, c.options.dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, errorChan, err := createStreams(conn, resolved[0].Remote, 0)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	podConn := &podConn{
+		conn:   conn,
+		stream: stream,
+		addr:   podAddr(fmt.Sprintf("%s/%s:%d", namespace, pod.Name, resolved[0].Remote)),
+	}
+
+	go podConn.watch(errorChan)
+
+	return podConn, nil
+}
+
+// podConn is a net.Conn over the data stream of its own connection to a pod.
+// The streams do not support deadlines, an expired deadline resets the stream
+// so that blocked reads and writes return os.ErrDeadlineExceeded. The
+// connection cannot be used afterwards.
+type podConn struct {
+	conn   httpstream.Connection
+	stream httpstream.Stream
+	addr   podAddr
+
+	mutex sync.Mutex
+	err   error
+	// readDeadline and writeDeadline expire the reads and writes.
+	readDeadline  deadline
+	writeDeadline deadline
+}
+
+// deadline is a deadline of one direction of a podConn.
+type deadline struct {
+	timer   *time.Timer
+	expired bool
+}
+
+// watch closes the connection when the pod reports an error, e.g. because
+// nothing listens on the port.
+func (c *podConn) watch(errorChan <-chan error) {
+	if err := <-errorChan; err != nil {
+		c.mutex.Lock()
+		c.err = err
+		c.mutex.Unlock()
+
+		c.conn.Close()
+	}
+}
+
+func (c *podConn) Read(b []byte) (int, error) {
+	if c.expired(&c.readDeadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	n, err := c.stream.Read(b)
+	if err != nil {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.readDeadline.expired {
+			return n, os.ErrDeadlineExceeded
+		}
+		if c.err != nil {
+			return n, c.err
+		}
+	}
+
+	return n, err
+}
+
+func (c *podConn) Write(b []byte) (int, error) {
+	if c.expired(&c.writeDeadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	n, err := c.stream.Write(b)
+	if err != nil && c.expired(&c.writeDeadline) {
+		return n, os.ErrDeadlineExceeded
+	}
+
+	return n, err
+}
+
+func (c *podConn) Close() error {
+	c.setDeadline(&c.readDeadline, time.Time{})
+	c.setDeadline(&c.writeDeadline, time.Time{})
+
+	return c.conn.Close()
+}
+
+func (c *podConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *podConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *podConn) SetDeadline(t time.Time) error {
+	c.setDeadline(&c.readDeadline, t)
+	c.setDeadline(&c.writeDeadline, t)
+	return nil
+}
+
+func (c *podConn) SetReadDeadline(t time.Time) error {
+	c.setDeadline(&c.readDeadline, t)
+	return nil
+}
+
+func (c *podConn) SetWriteDeadline(t time.Time) error {
+	c.setDeadline(&c.writeDeadline, t)
+	return nil
+}
+
+// setDeadline replaces the deadline, the zero time clears it. A deadline
+// that is not expired yet can still be moved.
+func (c *podConn) setDeadline(d *deadline, t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if d.expired {
+		return
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if t.IsZero() {
+		return
+	}
+	if !t.After(time.Now()) {
+		d.expired = true
+		go c.stream.Reset()
+		return
+	}
+
+	d.timer = time.AfterFunc(time.Until(t), func() {
+		c.mutex.Lock()
+		d.expired = true
+		c.mutex.Unlock()
+
+		c.stream.Reset()
+	})
+}
+
+func (c *podConn) expired(d *deadline) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return d.expired
+}
+
+// podAddr is the address "namespace/pod:port" of a pod connection.
+type podAddr string
+
+func (a podAddr) Network() string {
+	return "portforward"
+}
+
+func (a podAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,92 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDialPod(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "dial-pod")
+
+	// Act
+	conn, err := config.DialPod(context.Background(), "default", "dial-pod", 8080)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if conn.RemoteAddr().String() != "default/dial-pod:8080" {
+		t.Errorf("Unexpected remote address %s", conn.RemoteAddr())
+	}
+
+	assertEchoConn(t, conn)
+}
+
+func TestDialPodOfMissingPod(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	_, err := config.DialPod(context.Background(), "default", "missing-pod", 8080)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when the pod does not exist")
+	}
+}
+
+func TestDialPodReadDeadline(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "deadline-pod")
+
+	conn, err := config.DialPod(context.Background(), "default", "deadline-pod", 8080)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 4))
+
+	// Assert
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected os.ErrDeadlineExceeded but got %v", err)
+	}
+
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("Expected a timeout error but got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Read should return after the deadline but took %s", elapsed)
+	}
+}
+
+func TestDialPodPastDeadline(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "past-deadline-pod")
+
+	conn, err := config.DialPod(context.Background(), "default", "past-deadline-pod", 8080)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	_ = conn.SetDeadline(time.Now().Add(-time.Second))
+	_, readErr := conn.Read(make([]byte, 4))
+	_, writeErr := conn.Write([]byte("ping"))
+
+	// Assert
+	if !errors.Is(readErr, os.ErrDeadlineExceeded) || !errors.Is(writeErr, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected os.ErrDeadlineExceeded but got %v and %v", readErr, writeErr)
+	}
+}
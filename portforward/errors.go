@@ -0,0 +1,67 @@
+package portforward
+
+import (
+	"errors"
+)
+
+// ===== Errors =====
+
+/*
+Callers branch on the kind of a failure with errors.Is, e.g. the Python side
+maps the kinds to exception types. The errors of the API server stay wrapped,
+so apierrors.IsNotFound and the like keep working on the returned errors.
+*/
+
+var (
+	// ErrPodNotFound is returned when the pod of a target does not exist.
+	ErrPodNotFound = errors.New("pod not found")
+	// ErrServiceNotFound is returned when the service of a target does not exist.
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrNoReadyPod is returned when none of the pods of a target is ready.
+	ErrNoReadyPod = errors.New("no ready pod found")
+	// ErrPortForwardForbidden is returned when the user may not forward to the pod.
+	ErrPortForwardForbidden = errors.New("port forward forbidden")
+	// ErrUpgradeFailed is returned when the connection to the pod could not be
+	// upgraded to a stream connection.
+	ErrUpgradeFailed = errors.New("upgrading connection failed")
+	// ErrPortNotDeclared is returned by strict forwards when the pod declares
+	// container ports but not the remote port.
+	ErrPortNotDeclared = errors.New("port not declared by the pod")
+	// ErrUnknownHost is returned by the proxies for hosts that do not name a
+	// service or pod of the cluster.
+	ErrUnknownHost = errors.New("unknown cluster host")
+	// ErrLocalPortInUse is returned when a local port or socket is already used
+	// by another process.
+	ErrLocalPortInUse = errors.New("local port is already in use")
+	// ErrForwardExists is returned for a forward to a target that already has
+	// a registered forward when the conflict policy is ConflictFail.
+	ErrForwardExists = errors.New("forward already exists")
+	// ErrTooManyForwards is returned when the limit of SetMaxActiveForwards
+	// is reached.
+	ErrTooManyForwards = errors.New("too many active forwards")
+	// ErrNotReady is returned when the setup of a forward did not finish
+	// within its ready timeout.
+	ErrNotReady = errors.New("forward not ready in time")
+)
+
+// kindError adds the kind to an error and keeps its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
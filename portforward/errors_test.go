@@ -0,0 +1,102 @@
+package portforward
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestForwardToMissingPod(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	_, err := ForwardPorts(config, "default", "missing-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if !errors.Is(err, ErrPodNotFound) {
+		t.Errorf("Expected ErrPodNotFound but got %v", err)
+	}
+
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Expected the NotFound error of the API server to be kept but got %v", err)
+	}
+}
+
+func TestForwardToMissingService(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	_, err := ForwardPorts(config, "default", "svc/missing", []PortMapping{{Remote: 80}})
+
+	// Assert
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("Expected ErrServiceNotFound but got %v", err)
+	}
+}
+
+func TestForwardWithoutReadyPod(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	pod := newTestPod("unready-pod", map[string]string{"app": "unready"}, false, time.Now())
+	config.clientset = fake.NewSimpleClientset(pod)
+
+	// Act
+	_, err := ForwardPorts(config, "default", "selector/app=unready", []PortMapping{{Remote: 80}})
+
+	// Assert
+	if !errors.Is(err, ErrNoReadyPod) {
+		t.Errorf("Expected ErrNoReadyPod but got %v", err)
+	}
+}
+
+func TestForwardForbidden(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden","code":403,"message":"pods \"denied-pod\" is forbidden"}`))
+	}))
+	defer server.Close()
+
+	config := &Config{
+		restConfig: &rest.Config{Host: server.URL},
+		clientset:  fake.NewSimpleClientset(newTestPod("denied-pod", nil, true, time.Now())),
+	}
+
+	// Act
+	_, err := ForwardPorts(config, "default", "denied-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if !errors.Is(err, ErrPortForwardForbidden) {
+		t.Errorf("Expected ErrPortForwardForbidden but got %v", err)
+	}
+}
+
+func TestForwardWithFailedUpgrade(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upgrades are not supported", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		restConfig: &rest.Config{Host: server.URL},
+		clientset:  fake.NewSimpleClientset(newTestPod("proxied-pod", nil, true, time.Now())),
+	}
+
+	// Act
+	_, err := ForwardPorts(config, "default", "proxied-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if !errors.Is(err, ErrUpgradeFailed) || errors.Is(err, ErrPortForwardForbidden) {
+		t.Errorf("Expected ErrUpgradeFailed but got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ===== Forwarder =====
+
+/*
+A Forwarder is a forward owned by the caller. Forward and its variants manage
+their forwards in the global registry for the Python side, plain Go programs
+can keep the handle instead.
+*/
+
+// Forwarder is a running forward of local ports to a pod.
+type Forwarder struct {
+	tunnel *tunnel
+
+	ready     chan struct{}
+	errChan   chan error
+	done      chan struct{}
+	setupDone chan struct{}
+	setupErr  error
+
+	mutex   sync.Mutex
+	id      string
+	ports   []PortMapping
+	started time.Time
+}
+
+// NewForwarder starts a forward in the background. Ready is closed when the
+// forward is set up, Err delivers the error that failed or ended the forward.
+// Cancelling the context stops the forward.
+func NewForwarder(ctx context.Context, config *Config, namespace, target string, ports []PortMapping, opts ...Option) (*Forwarder, error) {
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("at least one port mapping is required")
+	}
+
+	if namespace == "" {
+		namespace = config.defaultNamespace()
+	}
+
+	f := &Forwarder{
+		tunnel:    newTunnel(ctx, config, namespace, target, ports, newOptions(opts)),
+		ready:     make(chan struct{}),
+		errChan:   make(chan error, 1),
+		done:      make(chan struct{}),
+		setupDone: make(chan struct{}),
+	}
+
+	go f.run()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Stop()
+		case <-f.done:
+		}
+	}()
+
+	return f, nil
+}
+
+func (f *Forwarder) run() {
+	err := f.forward()
+	if err != nil {
+		f.errChan <- err
+	}
+	close(f.errChan)
+	close(f.done)
+
+	if f.tunnel.options.onStop != nil {
+		f.tunnel.options.onStop(err)
+	}
+
+	f.notifyStopped(err)
+}
+
+// forward sets up the tunnel and runs it until the forward ends.
+func (f *Forwarder) forward() error {
+	bound, err := f.tunnel.start()
+	if err != nil {
+		f.setupErr = err
+		close(f.setupDone)
+		return err
+	}
+
+	f.mutex.Lock()
+	f.ports, f.started = bound, time.Now()
+	f.mutex.Unlock()
+
+	close(f.ready)
+	close(f.setupDone)
+
+	if f.tunnel.options.onReady != nil {
+		f.tunnel.options.onReady(bound)
+	}
+
+	f.tunnel.run()
+
+	f.tunnel.mutex.Lock()
+	defer f.tunnel.mutex.Unlock()
+
+	return f.tunnel.err
+}
+
+// waitReady blocks until the setup finished and returns its error.
+func (f *Forwarder) waitReady() error {
+	<-f.setupDone
+
+	return f.setupErr
+}
+
+// wait blocks until the forward ended and returns the error that failed or
+// ended it.
+func (f *Forwarder) wait() error {
+	<-f.done
+
+	f.tunnel.mutex.Lock()
+	defer f.tunnel.mutex.Unlock()
+
+	return f.tunnel.err
+}
+
+// Stop ends the forward and closes the local listeners.
+func (f *Forwarder) Stop() {
+	f.tunnel.stop(nil)
+}
+
+// Done is closed when the forward ended, its local listeners were closed and
+// its connections were handled.
+func (f *Forwarder) Done() <-chan struct{} {
+	return f.done
+}
+
+// Ready is closed when the local ports are bound and the pod is connected.
+func (f *Forwarder) Ready() <-chan struct{} {
+	return f.ready
+}
+
+// Err delivers the error that failed or ended the forward. It is closed when
+// the forward ended, a stopped forward closes it without an error.
+func (f *Forwarder) Err() <-chan error {
+	return f.errChan
+}
+
+// Ports returns the mappings with the bound local ports and the remote ports
+// of the pod. It is empty before the forward is ready.
+func (f *Forwarder) Ports() []PortMapping {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]PortMapping(nil), f.ports...)
+}
+
+// Metrics returns the traffic of the forward so far.
+func (f *Forwarder) Metrics() Metrics {
+	return f.tunnel.metrics.snapshot()
+}
+
+// status returns the pod, the ports and the start time of a ready forward.
+func (f *Forwarder) status() (string, []PortMapping, time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.tunnel.podName(), append([]PortMapping(nil), f.ports...), f.started
+}
@@ -0,0 +1,202 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewForwarder(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "handle-pod")
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "handle-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Assert
+	select {
+	case <-forwarder.Ready():
+	case err := <-forwarder.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Forwarder was not ready in time")
+	}
+
+	ports := forwarder.Ports()
+	if len(ports) != 1 || ports[0].Remote != 8080 || ports[0].Local == 0 {
+		t.Fatalf("Unexpected ports %v", ports)
+	}
+
+	assertEcho(t, ports[0].Local)
+}
+
+func TestForwarderStop(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stop-handle-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "stop-handle-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	forwarder.Stop()
+
+	// Assert
+	select {
+	case err, ok := <-forwarder.Err():
+		if ok {
+			t.Errorf("Stopped forwarder should not report an error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Err should be closed after stopping")
+	}
+
+	if !waitForClosedPort(forwarder.Ports()[0].Local) {
+		t.Errorf("Listener should be closed after stopping")
+	}
+}
+
+func TestForwarderDone(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "done-handle-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "done-handle-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	assertEchoRoundTrip(t, conn)
+
+	// Act
+	forwarder.Stop()
+
+	// Assert
+	select {
+	case <-forwarder.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Done should be closed after stopping")
+	}
+
+	if forwarder.tunnel.metrics.snapshot().OpenConnections != 0 {
+		t.Errorf("Expected no open connections after Done")
+	}
+}
+
+func TestForwarderReportsSetupError(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "missing-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	select {
+	case err := <-forwarder.Err():
+		if err == nil {
+			t.Errorf("Error should be reported for a missing pod")
+		}
+	case <-forwarder.Ready():
+		t.Errorf("Forwarder should not be ready for a missing pod")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No error was reported in time")
+	}
+}
+
+func TestForwarderReportsLostConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "lost-handle-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "lost-handle-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	select {
+	case err := <-forwarder.Err():
+		if err == nil {
+			t.Errorf("Error should be reported for a lost connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No error was reported in time")
+	}
+}
+
+func TestForwarderCallbacks(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "callback-pod")
+	events := make(chan string, 10)
+
+	opts := []Option{
+		WithOnReady(func(ports []PortMapping) { events <- "ready" }),
+		WithOnConnectionOpened(func(info ConnectionInfo) { events <- "opened" }),
+		WithOnConnectionClosed(func(info ConnectionInfo) { events <- "closed" }),
+		WithOnStop(func(err error) { events <- fmt.Sprintf("stop %v", err) }),
+	}
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "callback-pod", []PortMapping{{Remote: 8080}}, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	assertEcho(t, forwarder.Ports()[0].Local)
+	waitFor(5*time.Second, func() bool { return forwarder.Metrics().OpenConnections == 0 })
+	forwarder.Stop()
+
+	// Assert
+	for _, expected := range []string{"ready", "opened", "closed", "stop <nil>"} {
+		select {
+		case event := <-events:
+			if event != expected {
+				t.Errorf("Expected event %q but got %q", expected, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Event %q was not delivered", expected)
+		}
+	}
+}
+
+func TestForwarderCallsOnStopForSetupError(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	stopped := make(chan error, 1)
+
+	// Act
+	_, err := NewForwarder(context.Background(), config, "default", "missing-pod", []PortMapping{{Remote: 8080}}, WithOnStop(func(err error) { stopped <- err }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Errorf("Setup error should be passed to OnStop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnStop was not called")
+	}
+}
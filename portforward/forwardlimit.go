@@ -0,0 +1,59 @@
+package portforward
+
+import (
+	"fmt"
+)
+
+// ===== Forward limits =====
+
+/*
+Every registered forward holds a connection to the API server. Automation in
+a loop can open hundreds of them against a production cluster, a global limit
+fails further forwards with ErrTooManyForwards before anything is bound or
+dialed. Forwards replaced by the new forward do not count, plain Forwarders
+are not registered and not limited.
+*/
+
+// maxActiveForwards is the limit of registered forwards, zero is unlimited.
+var maxActiveForwards int
+
+// SetMaxActiveForwards limits the number of registered forwards, zero removes
+// the limit. Running forwards are kept when the limit is lowered.
+func SetMaxActiveForwards(limit int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	maxActiveForwards = limit
+}
+
+// checkForwardLimit fails a new forward to the target when the limit is
+// reached.
+func checkForwardLimit(namespace, target string, policy ConflictPolicy) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return exceedsForwardLimit(fmt.Sprintf("%s/%s", namespace, target), policy)
+}
+
+// exceedsForwardLimit is checkForwardLimit for the key, the caller holds the
+// mutex.
+func exceedsForwardLimit(key string, policy ConflictPolicy) error {
+	if maxActiveForwards <= 0 {
+		return nil
+	}
+
+	count := 0
+	for other, forwards := range activeForwards {
+		if other == key && policy == ConflictReplace {
+			// Replaced by the new forward.
+			continue
+		}
+		count += len(forwards)
+	}
+
+	if count >= maxActiveForwards {
+		return fmt.Errorf("forward to %s: limit of %d active forwards reached: %w", key, maxActiveForwards, ErrTooManyForwards)
+	}
+
+	return nil
+}
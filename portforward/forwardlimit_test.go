@@ -0,0 +1,62 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSetMaxActiveForwards(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "limited-pod", "excess-pod")
+	SetMaxActiveForwards(len(ListActiveForwards()) + 1)
+	defer SetMaxActiveForwards(0)
+
+	_, err := ForwardWithContext(context.Background(), server.config, "default", "limited-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "limited-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dials := server.dialCount()
+
+	// Act
+	_, err = ForwardWithContext(context.Background(), server.config, "default", "excess-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "excess-pod")
+
+	// Assert
+	if !errors.Is(err, ErrTooManyForwards) {
+		t.Errorf("Expected ErrTooManyForwards but got %v", err)
+	}
+
+	if server.dialCount() != dials {
+		t.Errorf("Expected no new connection to the pod but got %d", server.dialCount()-dials)
+	}
+}
+
+func TestSetMaxActiveForwardsAllowsReplacing(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "limited-replaced-pod")
+	SetMaxActiveForwards(len(ListActiveForwards()) + 1)
+	defer SetMaxActiveForwards(0)
+
+	_, err := ForwardWithContext(context.Background(), config, "default", "limited-replaced-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "limited-replaced-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	ports, err := ForwardWithContext(context.Background(), config, "default", "limited-replaced-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, ports[0].Local)
+
+	_, _, err = ForwardWithID(context.Background(), config, "default", "limited-replaced-pod", []PortMapping{{Remote: 8080}})
+	if !errors.Is(err, ErrTooManyForwards) {
+		t.Errorf("Expected ErrTooManyForwards for an additional forward but got %v", err)
+	}
+}
@@ -4,6 +4,11 @@ go 1.16
 
 require (
 	github.com/Azure/go-autorest/autorest/adal v0.9.13
+	golang.org/x/net v0.0.0-20210520170846-37e1c6afe023
+	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22
+	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
+	k8s.io/api v0.22.0
 	k8s.io/apimachinery v0.22.0
 	k8s.io/client-go v0.22.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,90 @@
+package portforward
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// ===== Health check =====
+
+/*
+Firewalls drop idle connections without closing them, the tunnel only notices
+when the next local connection fails. The health check opens a probe stream
+periodically, a connection that does not answer is replaced like after a
+reload while the listeners stay open. The probe is a lone error stream: its
+reply comes from the kubelet, but without a data stream the kubelet never
+connects to the application, so probes do not show up in its logs.
+*/
+
+// probeTimeout bounds the creation of the probe stream.
+const probeTimeout = 10 * time.Second
+
+// checkHealth probes the connection to the pod every interval until the
+// forward is stopped.
+func (t *tunnel) checkHealth() {
+	ticker := time.NewTicker(t.options.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		t.mutex.Lock()
+		conn, remotes := t.conn, t.remotes
+		t.mutex.Unlock()
+
+		select {
+		case <-conn.CloseChan():
+			// Lost connections are handled by run.
+			continue
+		default:
+		}
+
+		err := t.probe(conn, remotes[0].Remote)
+		if err == nil {
+			continue
+		}
+		t.reportError(fmt.Errorf("health check of %s/%s: %w", t.namespace, t.target, err))
+
+		if err := t.connect(t.ctx); err != nil {
+			t.reportError(fmt.Errorf("repairing %s/%s: %w", t.namespace, t.target, err))
+			// Lost like any other connection.
+			conn.Close()
+		}
+	}
+}
+
+// probe creates an error stream to the remote port and resets it again.
+func (t *tunnel) probe(conn httpstream.Connection, remote int) error {
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(remote))
+	headers.Set(corev1.PortForwardRequestIDHeader, strconv.Itoa(t.nextRequestID()))
+
+	result := make(chan error, 1)
+	go func() {
+		errorStream, err := createStream(conn, headers)
+		if err == nil {
+			errorStream.Reset()
+		}
+		result <- err
+	}()
+
+	timer := time.NewTimer(probeTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("probe timed out after %s", probeTimeout)
+	}
+}
@@ -0,0 +1,71 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckRepairsStaleConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "stale-pod")
+	errs := make(chan error, 10)
+	handler := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "stale-pod", []PortMapping{{Remote: 8080}}, WithHealthCheck(50*time.Millisecond), WithErrorHandler(handler))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	<-forwarder.Ready()
+
+	// Act
+	server.breakConnections()
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return server.dialCount() >= 2 }) {
+		t.Fatalf("Stale connection was not replaced")
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("Failed health check should be reported")
+		}
+	default:
+		t.Errorf("Failed health check should be reported")
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestHealthCheckKeepsHealthyConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "healthy-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "healthy-pod", []PortMapping{{Remote: 8080}}, WithHealthCheck(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	<-forwarder.Ready()
+
+	// Act
+	time.Sleep(300 * time.Millisecond)
+
+	// Assert
+	if dials := server.dialCount(); dials != 1 {
+		t.Errorf("Healthy connection should be kept but got %d dials", dials)
+	}
+
+	if streams := server.streamCount("healthy-pod"); streams != 0 {
+		t.Errorf("Probes should not connect to the application but opened %d data streams", streams)
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
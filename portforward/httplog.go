@@ -0,0 +1,241 @@
+package portforward
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ===== HTTP request logging =====
+
+/*
+When the forwarded protocol is HTTP/1.x, the requests of the local clients
+and the responses of the pod are parsed next to the data path and logged
+with their method, path, status and latency. The parsers read copies of the
+bytes and never block the data path, a parser that falls behind stops. A
+connection that does not speak HTTP, e.g. TLS, is forwarded as it is and no
+longer parsed. Upgraded connections like websockets end the parsing after
+the upgrade.
+*/
+
+const (
+	// maxPendingRequests bounds the pipelined requests waiting for responses.
+	maxPendingRequests = 100
+	// maxTapChunks bounds the copied reads or writes waiting for a parser.
+	maxTapChunks = 64
+)
+
+// HTTPRequestInfo describes a request through a forward.
+type HTTPRequestInfo struct {
+	Method string
+	Path   string
+	Status int
+	// Latency is the time from reading the request to the response header.
+	Latency time.Duration
+	// Client is the address of the local client.
+	Client net.Addr
+}
+
+// WithHTTPLogging logs the HTTP requests through the forward unless the log
+// level is LogSilent.
+func WithHTTPLogging() Option {
+	return func(o *options) {
+		o.httpLogging = true
+	}
+}
+
+// WithOnHTTPRequest is called for every HTTP request through the forward
+// when its response header was received.
+func WithOnHTTPRequest(callback func(HTTPRequestInfo)) Option {
+	return func(o *options) {
+		o.onHTTPRequest = callback
+	}
+}
+
+// pendingRequest is a parsed request waiting for its response.
+type pendingRequest struct {
+	request *http.Request
+	started time.Time
+}
+
+// httpConn parses the HTTP traffic of a local connection.
+type httpConn struct {
+	net.Conn
+	requests  *tap
+	responses *tap
+}
+
+// tap passes copies of the traffic to a parser without blocking.
+type tap struct {
+	mutex   sync.Mutex
+	chunks  chan []byte
+	stopped bool
+	// unread is the rest of the chunk that the parser reads.
+	unread []byte
+}
+
+func newTap() *tap {
+	return &tap{chunks: make(chan []byte, maxTapChunks)}
+}
+
+// feed copies the bytes to the parser, a parser that fell behind is stopped.
+func (t *tap) feed(p []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stopped {
+		return
+	}
+
+	select {
+	case t.chunks <- append([]byte(nil), p...):
+	default:
+		t.stopped = true
+		close(t.chunks)
+	}
+}
+
+func (t *tap) close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.stopped {
+		t.stopped = true
+		close(t.chunks)
+	}
+}
+
+// Read is used by the parser.
+func (t *tap) Read(p []byte) (int, error) {
+	if len(t.unread) == 0 {
+		chunk, ok := <-t.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		t.unread = chunk
+	}
+
+	n := copy(p, t.unread)
+	t.unread = t.unread[n:]
+
+	return n, nil
+}
+
+// httpLogged parses the HTTP traffic of the local connection if the forward
+// logs requests.
+func (t *tunnel) httpLogged(local net.Conn) net.Conn {
+	if !t.options.httpLogging && t.options.onHTTPRequest == nil {
+		return local
+	}
+
+	requests, responses := newTap(), newTap()
+	pending := make(chan pendingRequest, maxPendingRequests)
+
+	go parseRequests(requests, pending)
+	go t.parseResponses(responses, pending, local.RemoteAddr())
+
+	return &httpConn{Conn: local, requests: requests, responses: responses}
+}
+
+func (c *httpConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.requests.feed(p[:n])
+	}
+
+	return n, err
+}
+
+func (c *httpConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.responses.feed(p[:n])
+	}
+
+	return n, err
+}
+
+func (c *httpConn) Close() error {
+	c.requests.close()
+	c.responses.close()
+
+	return c.Conn.Close()
+}
+
+// parseRequests queues the requests of the client until the traffic is not
+// HTTP.
+func parseRequests(reader *tap, pending chan<- pendingRequest) {
+	defer close(pending)
+	defer reader.close()
+
+	buffered := bufio.NewReader(reader)
+	for {
+		request, err := http.ReadRequest(buffered)
+		if err != nil {
+			return
+		}
+
+		select {
+		case pending <- pendingRequest{request: request, started: time.Now()}:
+		default:
+			// The pod does not answer, stop parsing.
+			return
+		}
+
+		if _, err := io.Copy(ioutil.Discard, request.Body); err != nil {
+			return
+		}
+	}
+}
+
+// parseResponses matches the responses of the pod with the queued requests.
+func (t *tunnel) parseResponses(reader *tap, pending <-chan pendingRequest, client net.Addr) {
+	defer reader.close()
+
+	buffered := bufio.NewReader(reader)
+	for {
+		next, ok := <-pending
+		if !ok {
+			return
+		}
+
+		response, err := http.ReadResponse(buffered, next.request)
+		for err == nil && response.StatusCode >= 100 && response.StatusCode < 200 && response.StatusCode != http.StatusSwitchingProtocols {
+			// Interim responses like 100 Continue precede the final response.
+			response, err = http.ReadResponse(buffered, next.request)
+		}
+		if err != nil {
+			return
+		}
+
+		t.logRequest(HTTPRequestInfo{
+			Method:  next.request.Method,
+			Path:    next.request.URL.RequestURI(),
+			Status:  response.StatusCode,
+			Latency: time.Since(next.started),
+			Client:  client,
+		})
+
+		if response.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+
+		if _, err := io.Copy(ioutil.Discard, response.Body); err != nil {
+			return
+		}
+	}
+}
+
+func (t *tunnel) logRequest(info HTTPRequestInfo) {
+	if t.options.httpLogging && t.options.logLevel > LogSilent {
+		t.logger.Printf("%s %s %d %s", info.Method, info.Path, info.Status, info.Latency.Round(time.Millisecond))
+	}
+
+	if t.options.onHTTPRequest != nil {
+		t.options.onHTTPRequest(info)
+	}
+}
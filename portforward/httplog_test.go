@@ -0,0 +1,116 @@
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForwardLogsHTTPRequests(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "http-pod")
+
+	var mutex sync.Mutex
+	var requests []HTTPRequestInfo
+	output := &logBuffer{}
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "http-pod", []PortMapping{{Remote: httpTestPort}},
+		WithHTTPLogging(), WithLogOutput(output), WithOnHTTPRequest(func(info HTTPRequestInfo) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			requests = append(requests, info)
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	base := fmt.Sprintf("http://127.0.0.1:%d", forwarder.Ports()[0].Local)
+
+	// Act
+	for _, path := range []string{"/health?verbose=1", "/missing"} {
+		response, err := client.Post(base+path, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, _ = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+	}
+
+	// Assert
+	waitFor(5*time.Second, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(requests) == 2
+	})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests but got %v", requests)
+	}
+
+	if requests[0].Method != http.MethodPost || requests[0].Path != "/health?verbose=1" || requests[0].Status != http.StatusOK {
+		t.Errorf("Unexpected first request %+v", requests[0])
+	}
+
+	if requests[1].Path != "/missing" || requests[1].Status != http.StatusNotFound {
+		t.Errorf("Unexpected second request %+v", requests[1])
+	}
+
+	if !strings.Contains(output.String(), "POST /missing 404") {
+		t.Errorf("Expected the request in the log but got %q", output.String())
+	}
+}
+
+func TestForwardWithHTTPLoggingForwardsOtherProtocols(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "binary-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "binary-pod", []PortMapping{{Remote: 8080}}, WithHTTPLogging())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	data := bytes.Repeat([]byte{0x16, 0x03, 0x01}, 100000)
+	go func() {
+		_, _ = conn.Write(data)
+	}()
+
+	received := make([]byte, len(data))
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, err = io.ReadFull(conn, received)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Errorf("Expected the data to be forwarded unchanged")
+	}
+}
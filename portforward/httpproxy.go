@@ -0,0 +1,93 @@
+package portforward
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ===== HTTP CONNECT proxy =====
+
+/*
+Some tools only support HTTP proxies, e.g. through HTTPS_PROXY. The proxy
+only tunnels CONNECT requests, like "CONNECT web.shop.svc:443 HTTP/1.1", the
+hosts are resolved like for the SOCKS5 proxy, see proxy.go. Plain http
+requests through the proxy are answered with 405, the clients of https
+services and other protocols always tunnel.
+*/
+
+// ServeHTTPConnect runs an HTTP proxy on the local address, e.g.
+// "127.0.0.1:3128", that tunnels CONNECT requests to the services and pods of
+// the cluster. The proxy stops with the context or Stop.
+func ServeHTTPConnect(ctx context.Context, config *Config, address string, opts ...ProxyOption) (*Proxy, error) {
+	return startProxy(ctx, config, address, connectHandshake, opts)
+}
+
+// connectHandshake answers the CONNECT request of the client with the
+// connection to the pod.
+func connectHandshake(p *Proxy, client net.Conn) (net.Conn, error) {
+	if err := client.SetDeadline(time.Now().Add(proxyHandshakeTimeout)); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(client)
+	request, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading CONNECT request: %w", err)
+	}
+
+	if request.Method != http.MethodConnect {
+		connectReply(client, http.StatusMethodNotAllowed, "Allow: CONNECT\r\n")
+		return nil, fmt.Errorf("unsupported proxy request %s %s", request.Method, request.URL)
+	}
+
+	host, portText, err := net.SplitHostPort(request.Host)
+	if err != nil {
+		connectReply(client, http.StatusBadRequest, "")
+		return nil, fmt.Errorf("invalid CONNECT target %q: %w", request.Host, err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		connectReply(client, http.StatusBadRequest, "")
+		return nil, fmt.Errorf("invalid CONNECT port %q", portText)
+	}
+
+	// DIAL
+	upstream, err := p.dial(host, port)
+	if err != nil {
+		connectReply(client, http.StatusBadGateway, "")
+		return nil, err
+	}
+
+	connectReply(client, http.StatusOK, "")
+
+	// Clients may send the first bytes without waiting for the answer.
+	if reader.Buffered() > 0 {
+		buffered, _ := reader.Peek(reader.Buffered())
+		if _, err := upstream.Write(buffered); err != nil {
+			upstream.Close()
+			return nil, err
+		}
+	}
+
+	if err := client.SetDeadline(time.Time{}); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+
+	return upstream, nil
+}
+
+// connectReply answers a CONNECT request with the status and extra headers.
+func connectReply(client net.Conn, status int, headers string) {
+	length := ""
+	if status != http.StatusOK {
+		length = "Content-Length: 0\r\n"
+	}
+
+	_, _ = fmt.Fprintf(client, "HTTP/1.1 %d %s\r\n%s%s\r\n", status, http.StatusText(status), headers, length)
+}
@@ -0,0 +1,154 @@
+package portforward
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// httpConnect opens a tunnel through the proxy to the target.
+func httpConnect(t *testing.T, proxy *Proxy, target string) (net.Conn, int) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, response.StatusCode
+}
+
+func TestHTTPConnectProxyToService(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeHTTPConnect(context.Background(), server.config, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	// Act
+	conn, status := httpConnect(t, proxy, "web.default.svc.cluster.local:80")
+	defer conn.Close()
+
+	// Assert
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", status)
+	}
+
+	assertEchoRoundTrip(t, conn)
+
+	if server.streamCount("web-pod") == 0 {
+		t.Errorf("Expected a stream to web-pod")
+	}
+}
+
+func TestHTTPConnectProxyToUnknownService(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeHTTPConnect(context.Background(), server.config, "127.0.0.1:0", WithProxyErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	// Act
+	conn, status := httpConnect(t, proxy, "missing.default.svc:80")
+	conn.Close()
+
+	// Assert
+	if status != http.StatusBadGateway {
+		t.Errorf("Expected status 502 but got %d", status)
+	}
+}
+
+func TestHTTPConnectProxyRejectsPlainRequests(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeHTTPConnect(context.Background(), server.config, "127.0.0.1:0", WithProxyErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: func(*http.Request) (*url.URL, error) {
+			return url.Parse("http://" + proxy.Addr().String())
+		}},
+		Timeout: 10 * time.Second,
+	}
+
+	// Act
+	response, err := client.Get("http://web.default.svc/")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 but got %d", response.StatusCode)
+	}
+
+	if server.streamCount("web-pod") != 0 {
+		t.Errorf("Expected no streams to the pod but got %d", server.streamCount("web-pod"))
+	}
+}
+
+func TestHTTPConnectProxyLogsWithoutRuntimeErrorHandlers(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	var output logBuffer
+	errorLogger.SetOutput(&output)
+	defer errorLogger.SetOutput(os.Stderr)
+
+	var handled int32
+	handlers := utilruntime.ErrorHandlers
+	utilruntime.ErrorHandlers = []func(error){func(error) { atomic.AddInt32(&handled, 1) }}
+	defer func() { utilruntime.ErrorHandlers = handlers }()
+
+	proxy, err := ServeHTTPConnect(context.Background(), server.config, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	// Act
+	conn, _ := httpConnect(t, proxy, "missing.default.svc:80")
+	conn.Close()
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return strings.Contains(output.String(), "[proxy "+proxy.Addr().String()+"]") }) {
+		t.Errorf("Expected the error in the log but got %q", output.String())
+	}
+
+	if atomic.LoadInt32(&handled) != 0 {
+		t.Errorf("Runtime error handlers should not receive the errors of the proxy")
+	}
+}
@@ -0,0 +1,91 @@
+package portforward
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ===== Jump pods =====
+
+/*
+A jump pod reaches networks that are not reachable from here, e.g. another
+cluster or a private network. Every local connection runs a command in the
+jump pod that connects to the final host, its stdin and stdout carry the
+traffic:
+
+    local -> jump pod -> host:port
+
+The target of the forward is the jump pod and the remote ports are ports of
+the host. The command runs in the default container of the jump pod, its
+image must provide the command, nc by default.
+*/
+
+// WithJumpHost forwards to the remote ports of the host as reached from the
+// pod of the target. The command connects to the host and gets the host and
+// the port as its last arguments, by default "nc".
+func WithJumpHost(host string, command ...string) Option {
+	return func(o *options) {
+		o.jumpHost = host
+		o.jumpCommand = command
+	}
+}
+
+// jumpCommandFor returns the command that connects to the remote port.
+func (o options) jumpCommandFor(remote int) []string {
+	command := o.jumpCommand
+	if len(command) == 0 {
+		command = []string{"nc"}
+	}
+
+	return append(append([]string(nil), command...), o.jumpHost, strconv.Itoa(remote))
+}
+
+// handleJump copies data between the local connection and the command in the
+// jump pod.
+func (t *tunnel) handleJump(local net.Conn, pod string, remote int) error {
+	restConfig, _ := t.config.client()
+
+	execURL, err := podURL(restConfig, t.namespace, pod, "exec")
+	if err != nil {
+		return err
+	}
+
+	command := t.options.jumpCommandFor(remote)
+	query := execURL.Query()
+	for _, arg := range command {
+		query.Add("command", arg)
+	}
+	query.Set(corev1.ExecStdinParam, "true")
+	query.Set(corev1.ExecStdoutParam, "true")
+	query.Set(corev1.ExecStderrParam, "true")
+	execURL.RawQuery = query.Encode()
+
+	roundTripper, upgrader, err := roundTripperFor(restConfig, t.config.options.pings())
+	if err != nil {
+		return err
+	}
+
+	executor, err := remotecommand.NewSPDYExecutorForTransports(roundTripper, upgrader, http.MethodPost, execURL)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	err = executor.Stream(remotecommand.StreamOptions{
+		Stdin:  countingReader{local, &t.metrics.bytesSent},
+		Stdout: countingWriter{local, &t.metrics.bytesReceived},
+		Stderr: &stderr,
+	})
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%s: %w: %s", strings.Join(command, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return err
+}
@@ -0,0 +1,47 @@
+package portforward
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestForwardThroughJumpPod(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "jump-pod")
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "jump-pod", []PortMapping{{Remote: 5432}}, WithJumpHost("db.cluster-b.internal"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	expected := [][]string{{"nc", "db.cluster-b.internal", "5432"}}
+	if !reflect.DeepEqual(server.execCommands, expected) {
+		t.Errorf("Expected the commands %v but got %v", expected, server.execCommands)
+	}
+}
+
+func TestJumpCommandFor(t *testing.T) {
+	// Arrange
+	options := newOptions([]Option{WithJumpHost("10.0.0.5", "socat-connect", "-v")})
+
+	// Act
+	command := options.jumpCommandFor(80)
+
+	// Assert
+	expected := []string{"socat-connect", "-v", "10.0.0.5", "80"}
+	if !reflect.DeepEqual(command, expected) {
+		t.Errorf("Expected %v but got %v", expected, command)
+	}
+}
@@ -0,0 +1,74 @@
+package portforward
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ===== TCP keepalive =====
+
+/*
+Firewalls and NAT gateways drop TCP connections that were idle for a while,
+e.g. the pooled connections of a database client or the connection to the
+API server that carries the streams. Keepalive probes keep them alive. Go
+enables keepalive with a period of 15 seconds by default, the options change
+the period or disable it like the KeepAlive field of net.Dialer.
+*/
+
+// WithKeepAlive sets the keepalive period of the accepted local connections.
+// A negative period disables keepalive.
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = period
+	}
+}
+
+// WithTransportKeepAlive sets the keepalive period of the connections to the
+// API server, which carry the streams of the forwards. A negative period
+// disables keepalive.
+func WithTransportKeepAlive(period time.Duration) ConfigOption {
+	return func(o *configOptions) {
+		o.keepAlive = period
+	}
+}
+
+// keepAliveDial sets the keepalive period of the connections of next.
+func keepAliveDial(next DialContextFunc, period time.Duration) DialContextFunc {
+	if next == nil {
+		return (&net.Dialer{KeepAlive: period}).DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := next(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := setKeepAlive(conn, period); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// setKeepAlive sets the keepalive period of TCP connections, others are kept
+// as they are.
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if period < 0 {
+		return tcpConn.SetKeepAlive(false)
+	}
+
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+
+	return tcpConn.SetKeepAlivePeriod(period)
+}
@@ -0,0 +1,79 @@
+package portforward
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestForwardWithKeepAlive(t *testing.T) {
+	for _, period := range []time.Duration{time.Minute, -1} {
+		// Arrange
+		server := startFakeAPIServer(t, "db")
+
+		// Act
+		forwarder, err := NewForwarder(context.Background(), server.config, "default", "db", []PortMapping{{Remote: 5432}}, WithKeepAlive(period))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := forwarder.waitReady(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Assert
+		assertEcho(t, forwarder.Ports()[0].Local)
+		forwarder.Stop()
+	}
+}
+
+func TestTransportKeepAliveWrapsDial(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	dialed := false
+	options := configOptions{
+		dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = true
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}
+	WithTransportKeepAlive(time.Minute)(&options)
+
+	restConfig := &rest.Config{}
+
+	// Act
+	options.apply(restConfig)
+	conn, err := restConfig.Dial(context.Background(), "tcp", listener.Addr().String())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	if !dialed {
+		t.Errorf("Expected the custom dial function to be used")
+	}
+}
+
+func TestSetKeepAliveIgnoresOtherConnections(t *testing.T) {
+	// Arrange
+	conn, other := net.Pipe()
+	defer conn.Close()
+	defer other.Close()
+
+	// Act
+	err := setKeepAlive(conn, time.Minute)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ===== Connection limits =====
+
+/*
+Load tests against a forward can overwhelm a small pod. A limit caps the open
+local connections of a forward, further connections wait for a free slot up
+to a timeout or are closed right away. Waiting connections are accepted by
+the listener, so clients do not see refused connections while they wait.
+*/
+
+// WithMaxConnections limits the open local connections of the forward. Excess
+// connections wait up to wait for a slot, with zero wait they are closed.
+func WithMaxConnections(limit int, wait time.Duration) Option {
+	return func(o *options) {
+		o.maxConnections, o.connectionWait = limit, wait
+	}
+}
+
+// newSlots returns the slots of the connection limit or nil.
+func newSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+
+	return make(chan struct{}, limit)
+}
+
+// acquireSlot waits for a free slot of the connection limit and closes and
+// reports the connection when none became free.
+func (t *tunnel) acquireSlot(local net.Conn) bool {
+	if t.slots == nil {
+		return true
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if t.options.connectionWait > 0 {
+		timer := time.NewTimer(t.options.connectionWait)
+		defer timer.Stop()
+
+		select {
+		case t.slots <- struct{}{}:
+			return true
+		case <-timer.C:
+		case <-t.stopChan:
+			local.Close()
+			return false
+		}
+	}
+
+	local.Close()
+	t.reportError(fmt.Errorf("rejected connection from %s: limit of %d connections reached", local.RemoteAddr(), cap(t.slots)))
+	return false
+}
+
+func (t *tunnel) releaseSlot() {
+	if t.slots != nil {
+		<-t.slots
+	}
+}
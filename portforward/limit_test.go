@@ -0,0 +1,91 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestForwardRejectsConnectionsOverLimit(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "limited-pod")
+
+	rejected := make(chan error, 1)
+	forwarder, err := NewForwarder(context.Background(), config, "default", "limited-pod", []PortMapping{{Remote: 8080}},
+		WithAddress("127.0.0.1"), WithMaxConnections(1, 0), WithErrorHandler(func(err error) {
+			select {
+			case rejected <- err:
+			default:
+			}
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port := forwarder.Ports()[0].Local
+
+	first, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertEchoRoundTrip(t, first)
+
+	// Act
+	assertClosedByForward(t, port)
+
+	// Assert
+	select {
+	case <-rejected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Rejected connection was not reported")
+	}
+
+	first.Close()
+	if !waitFor(5*time.Second, func() bool { return forwarder.Metrics().OpenConnections == 0 }) {
+		t.Fatalf("Connection was not closed")
+	}
+
+	assertEcho(t, port)
+}
+
+func TestForwardQueuesConnectionsOverLimit(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "queued-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "queued-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"), WithMaxConnections(1, 10*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port := forwarder.Ports()[0].Local
+
+	first, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertEchoRoundTrip(t, first)
+
+	second, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer second.Close()
+
+	// Act
+	time.AfterFunc(200*time.Millisecond, func() { first.Close() })
+
+	// Assert
+	assertEchoRoundTrip(t, second)
+
+	if opened := forwarder.Metrics().Connections; opened != 2 {
+		t.Errorf("Expected 2 connections but got %d", opened)
+	}
+}
@@ -0,0 +1,100 @@
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// ===== Logging =====
+
+/*
+Every forward logs with its own logger, the lines start with a prefix of the
+namespace, the target and the ports by default so the output of concurrent
+forwards can be told apart. Errors are logged unless an error handler
+receives them, the other levels are opt-in.
+
+Proxies and reverse forwards log their errors to stderr in the same format.
+None of them go through the runtime.ErrorHandlers of client-go, they are shared
+with every client-go consumer of the process.
+*/
+
+// LogLevel selects which messages a forward logs.
+type LogLevel int
+
+const (
+	// LogSilent logs nothing.
+	LogSilent LogLevel = iota - 1
+	// LogError logs the errors while forwarding, it is the default.
+	LogError
+	// LogInfo also logs when the forward is ready, reconnected or stopped.
+	LogInfo
+	// LogDebug also logs every local connection.
+	LogDebug
+)
+
+// WithLogLevel sets which messages the forward logs.
+func WithLogLevel(level LogLevel) Option {
+	return func(o *options) {
+		o.logLevel = level
+	}
+}
+
+// WithLogPrefix starts the log lines of the forward with the prefix instead
+// of the namespace, the target and the ports.
+func WithLogPrefix(prefix string) Option {
+	return func(o *options) {
+		o.logPrefix = prefix
+	}
+}
+
+// WithLogOutput writes the log of the forward to the writer instead of stderr.
+func WithLogOutput(output io.Writer) Option {
+	return func(o *options) {
+		o.logOutput = output
+	}
+}
+
+// newLogger returns the logger of a forward.
+func newLogger(o options, namespace, target string) *log.Logger {
+	output := o.logOutput
+	if output == nil {
+		output = os.Stderr
+	}
+
+	prefix := o.logPrefix
+	if prefix == "" {
+		prefix = logPrefix(namespace, target, nil)
+	}
+
+	return log.New(output, prefix, log.LstdFlags)
+}
+
+// errorLogger logs the errors of proxies and reverse forwards without an
+// error handler.
+var errorLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+// logPrefix formats the default prefix like "[default/svc/web 8080:80] ".
+func logPrefix(namespace, target string, ports []PortMapping) string {
+	if len(ports) == 0 {
+		return fmt.Sprintf("[%s/%s] ", namespace, target)
+	}
+
+	mappings := make([]string, 0, len(ports))
+	for _, port := range ports {
+		mappings = append(mappings, port.String())
+	}
+
+	return fmt.Sprintf("[%s/%s %s] ", namespace, target, strings.Join(mappings, ","))
+}
+
+// logf logs the message when the level of the forward includes it.
+func (t *tunnel) logf(level LogLevel, format string, args ...interface{}) {
+	if t.options.logLevel < level {
+		return
+	}
+
+	t.logger.Printf(format, args...)
+}
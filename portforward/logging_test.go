@@ -0,0 +1,124 @@
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logBuffer collects the log of a forward.
+type logBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.String()
+}
+
+func TestForwardLogsWithPrefix(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "logged-pod")
+	var output logBuffer
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "logged-pod", []PortMapping{{Remote: 8080}}, WithLogLevel(LogDebug), WithLogOutput(&output))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+	localPort := forwarder.Ports()[0].Local
+
+	assertEcho(t, localPort)
+	forwarder.Stop()
+	<-forwarder.done
+
+	// Assert
+	prefix := fmt.Sprintf("[default/logged-pod %d:8080] ", localPort)
+	for _, message := range []string{"forwarding to pod logged-pod", "connection from 127.0.0.1", "stopped"} {
+		if !containsLine(output.String(), prefix, message) {
+			t.Errorf("Expected %q with the prefix %q in the log but got %q", message, prefix, output.String())
+		}
+	}
+}
+
+func TestForwardLogsErrorsByDefault(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "dropped-pod")
+	var output logBuffer
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "dropped-pod", []PortMapping{{Remote: 8080}}, WithLogPrefix("db: "), WithLogOutput(&output))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	server.dropConnections()
+	<-forwarder.done
+
+	// Assert
+	if !containsLine(output.String(), "db: ", "lost connection to pod") {
+		t.Errorf("Expected the error with the prefix in the log but got %q", output.String())
+	}
+	if containsLine(output.String(), "db: ", "stopped") {
+		t.Errorf("Expected no info messages in the log but got %q", output.String())
+	}
+}
+
+func TestForwardLogsNothingWhenSilent(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "silent-pod")
+	var output logBuffer
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "silent-pod", []PortMapping{{Remote: 8080}}, WithLogLevel(LogSilent), WithLogOutput(&output))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	forwarder.tunnel.reportError(fmt.Errorf("connection refused"))
+	forwarder.Stop()
+	<-forwarder.done
+
+	// Assert
+	if output.String() != "" {
+		t.Errorf("Expected no log but got %q", output.String())
+	}
+}
+
+func TestLogPrefix(t *testing.T) {
+	// Act
+	prefix := logPrefix("db", "svc/postgres", []PortMapping{{Local: 5432, Remote: 5432}, {Local: 9187, RemoteName: "metrics"}})
+
+	// Assert
+	if prefix != "[db/svc/postgres 5432:5432,9187:metrics] " {
+		t.Errorf("Unexpected prefix %q", prefix)
+	}
+}
+
+// containsLine reports whether a line of the log starts with the prefix and
+// contains the message.
+func containsLine(log, prefix, message string) bool {
+	for _, line := range strings.Split(log, "\n") {
+		if strings.HasPrefix(line, prefix) && strings.Contains(line, message) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package portforward
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ===== Metrics =====
+
+/*
+Every forward counts its traffic while it runs, tooling polls the counters to
+show whether a forward is in use. The counters are updated with atomics on the
+copy path and never reset, reconnects keep them.
+*/
+
+// Metrics is a snapshot of the traffic of a forward.
+type Metrics struct {
+	// BytesSent is the number of bytes sent from local connections to the pod.
+	BytesSent int64
+	// BytesReceived is the number of bytes received from the pod.
+	BytesReceived int64
+	// Connections is the number of accepted local connections.
+	Connections int64
+	// OpenConnections is the number of local connections that are open.
+	OpenConnections int64
+}
+
+// metrics are the counters of a running forward.
+type metrics struct {
+	bytesSent       int64
+	bytesReceived   int64
+	connections     int64
+	openConnections int64
+	// lastActive is the time in unix nanoseconds when a connection was last
+	// opened or closed.
+	lastActive int64
+}
+
+func (m *metrics) opened() {
+	atomic.AddInt64(&m.connections, 1)
+	atomic.AddInt64(&m.openConnections, 1)
+	m.active()
+}
+
+func (m *metrics) closed() {
+	m.active()
+	atomic.AddInt64(&m.openConnections, -1)
+}
+
+func (m *metrics) active() {
+	atomic.StoreInt64(&m.lastActive, time.Now().UnixNano())
+}
+
+// idle returns how long no local connection was open.
+func (m *metrics) idle() time.Duration {
+	if atomic.LoadInt64(&m.openConnections) > 0 {
+		return 0
+	}
+
+	return time.Since(time.Unix(0, atomic.LoadInt64(&m.lastActive)))
+}
+
+func (m *metrics) snapshot() Metrics {
+	return Metrics{
+		BytesSent:       atomic.LoadInt64(&m.bytesSent),
+		BytesReceived:   atomic.LoadInt64(&m.bytesReceived),
+		Connections:     atomic.LoadInt64(&m.connections),
+		OpenConnections: atomic.LoadInt64(&m.openConnections),
+	}
+}
+
+// countingWriter adds the written bytes to the counter.
+type countingWriter struct {
+	writer  io.Writer
+	counter *int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	atomic.AddInt64(w.counter, int64(n))
+
+	return n, err
+}
+
+// countingReader adds the read bytes to the counter.
+type countingReader struct {
+	reader  io.Reader
+	counter *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddInt64(r.counter, int64(n))
+
+	return n, err
+}
@@ -0,0 +1,55 @@
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestForwarderMetrics(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "metrics-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "metrics-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	<-forwarder.Ready()
+
+	// Act
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	// Assert
+	closed := waitFor(5*time.Second, func() bool {
+		return forwarder.Metrics().OpenConnections == 0
+	})
+	if !closed {
+		t.Fatalf("Connection should not be open after closing it")
+	}
+
+	metrics := forwarder.Metrics()
+	if metrics.Connections != 1 {
+		t.Errorf("Expected 1 connection but got %d", metrics.Connections)
+	}
+	if metrics.BytesSent != 4 || metrics.BytesReceived != 4 {
+		t.Errorf("Expected 4 bytes in each direction but got %d sent and %d received", metrics.BytesSent, metrics.BytesReceived)
+	}
+}
+
+func TestCountingWriter(t *testing.T) {
+	// Arrange
+	var buffer bytes.Buffer
+	var counter int64
+	writer := countingWriter{&buffer, &counter}
+
+	// Act
+	_, _ = writer.Write([]byte("abc"))
+	_, _ = writer.Write([]byte("de"))
+
+	// Assert
+	if counter != 5 || buffer.String() != "abcde" {
+		t.Errorf("Expected 5 counted bytes of abcde but got %d of %q", counter, buffer.String())
+	}
+}
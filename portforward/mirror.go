@@ -0,0 +1,190 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// ===== Traffic mirroring =====
+
+/*
+Comparing an old and a new version of a service is easiest with the same
+traffic. A mirrored forward connects to a shadow target next to its pod and
+sends a copy of everything the local clients send to the shadow at the same
+remote ports, the replies of the shadow are discarded. The shadow never slows
+down the forward: a shadow that does not keep up loses the copy of that local
+connection. A failed or lost shadow is reported and connected again with the
+next connection to the pod.
+*/
+
+// mirrorBacklog is the number of reads of a local connection that wait for
+// the shadow before its copy is dropped.
+const mirrorBacklog = 64
+
+// WithMirror sends a copy of the traffic of the local connections to the
+// newest ready pod of the shadow target in the namespace of the forward, e.g.
+// "deployment/web-canary". The responses of the shadow are discarded.
+func WithMirror(target string) Option {
+	return func(o *options) {
+		o.mirrorTarget = target
+	}
+}
+
+// connectMirror connects to the shadow pod, a shadow that cannot be reached
+// is reported and left out.
+func (t *tunnel) connectMirror(parent context.Context) backend {
+	restConfig, clientset := t.config.client()
+
+	ctx, cancel := t.config.requestContextFrom(parent)
+	candidate, err := resolveTarget(ctx, clientset, t.namespace, t.options.mirrorTarget)
+	cancel()
+	if err != nil {
+		t.reportError(fmt.Errorf("mirroring to %s/%s: %w", t.namespace, t.options.mirrorTarget, err))
+		return backend{}
+	}
+
+	mirror, err := t.connectBackend(parent, restConfig, candidate)
+	if err != nil {
+		t.reportError(fmt.Errorf("mirroring to pod %s of %s/%s: %w", candidate.pod.Name, t.namespace, t.options.mirrorTarget, err))
+		return backend{}
+	}
+
+	return mirror
+}
+
+// replaceMirror closes the current shadow connection. The mutex must be held.
+func (t *tunnel) replaceMirror(mirror backend) {
+	if t.mirror.conn != nil {
+		t.mirror.conn.Close()
+	}
+
+	t.mirror = mirror
+}
+
+// mirrored copies the data read from the local connection to the shadow pod.
+// The local connection is returned as is without a shadow.
+func (t *tunnel) mirrored(local net.Conn, index int) net.Conn {
+	t.mutex.Lock()
+	mirror := t.mirror
+	t.mutex.Unlock()
+
+	if mirror.conn == nil {
+		return local
+	}
+
+	remote := mirror.remotes[index].Remote
+	m := &mirrorConn{Conn: local, copies: make(chan []byte, mirrorBacklog)}
+	go func() {
+		// The streams are created here so a slow shadow cannot delay the
+		// local connection, the reads are queued in the meantime.
+		dataStream, errorChan, err := createStreams(mirror.conn, remote, t.nextRequestID())
+		if err != nil {
+			t.logf(LogDebug, "not mirroring connection from %s: %v", local.RemoteAddr(), err)
+			m.drop()
+			for range m.copies {
+			}
+			return
+		}
+
+		go func() {
+			// The replies of the shadow are discarded.
+			_, _ = io.Copy(ioutil.Discard, dataStream)
+		}()
+
+		failed := false
+		for data := range m.copies {
+			if _, err := dataStream.Write(data); err != nil {
+				failed = true
+				break
+			}
+		}
+		for range m.copies {
+		}
+
+		if failed || m.wasDropped() {
+			// The shadow did not get all data, it must not see a complete
+			// connection.
+			dataStream.Reset()
+			return
+		}
+
+		dataStream.Close()
+		if err := <-errorChan; err != nil {
+			t.logf(LogDebug, "mirroring connection from %s to %s: %v", local.RemoteAddr(), mirror.pod, err)
+		}
+	}()
+
+	return m
+}
+
+// mirrorConn queues a copy of every read for the shadow.
+type mirrorConn struct {
+	net.Conn
+
+	mutex   sync.Mutex
+	copies  chan []byte
+	dropped bool
+	closed  bool
+}
+
+func (c *mirrorConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.queue(append([]byte(nil), p[:n]...))
+	}
+
+	return n, err
+}
+
+// queue hands the data to the shadow, it drops the copy of the connection
+// instead of waiting for a slow shadow.
+func (c *mirrorConn) queue(data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.dropped || c.closed {
+		return
+	}
+
+	select {
+	case c.copies <- data:
+	default:
+		c.dropped = true
+		close(c.copies)
+	}
+}
+
+// drop gives up the copy of the connection.
+func (c *mirrorConn) drop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.dropped && !c.closed {
+		close(c.copies)
+	}
+	c.dropped = true
+}
+
+func (c *mirrorConn) wasDropped() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.dropped
+}
+
+func (c *mirrorConn) Close() error {
+	c.mutex.Lock()
+	if !c.closed {
+		c.closed = true
+		if !c.dropped {
+			close(c.copies)
+		}
+	}
+	c.mutex.Unlock()
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,119 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestForwardWithMirror(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "primary-pod", "shadow-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "primary-pod", []PortMapping{{Remote: 8080}}, WithMirror("shadow-pod"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return server.streamCount("shadow-pod") == 1 }) {
+		t.Errorf("Expected a mirrored stream to the shadow pod but got %d", server.streamCount("shadow-pod"))
+	}
+
+	if count := server.streamCount("primary-pod"); count != 1 {
+		t.Errorf("Expected one stream to the primary pod but got %d", count)
+	}
+}
+
+func TestForwardWithStalledMirror(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "fast-pod", "stalled-shadow-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "fast-pod", []PortMapping{{Remote: 8080}}, WithMirror("stalled-shadow-pod"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	server.mutex.Lock()
+	server.stalledStreams["stalled-shadow-pod"] = true
+	server.mutex.Unlock()
+
+	// Act & Assert
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestForwardWithUnknownMirror(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "unmirrored-pod")
+	errs := make(chan error, 1)
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "unmirrored-pod", []PortMapping{{Remote: 8080}},
+		WithMirror("missing-shadow-pod"), WithErrorHandler(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Act
+	err = forwarder.waitReady()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrPodNotFound) {
+			t.Errorf("Expected ErrPodNotFound for the shadow but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Missing shadow should be reported")
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestMirrorConnDropsSlowShadow(t *testing.T) {
+	// Arrange
+	client, local := net.Pipe()
+	defer client.Close()
+
+	m := &mirrorConn{Conn: local, copies: make(chan []byte, 1)}
+	defer m.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("first"))
+		_, _ = client.Write([]byte("second"))
+	}()
+
+	// Act
+	buffer := make([]byte, 16)
+	for i := 0; i < 2; i++ {
+		if _, err := m.Read(buffer); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Assert
+	if !m.wasDropped() {
+		t.Errorf("Copy should be dropped when the shadow does not keep up")
+	}
+
+	if data := <-m.copies; string(data) != "first" {
+		t.Errorf("Expected the first read to be queued but got %q", data)
+	}
+}
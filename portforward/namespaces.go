@@ -0,0 +1,46 @@
+package portforward
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ListNamespaces returns the names of all namespaces the configured user can see.
+func ListNamespaces(configPath, kubeContext string) ([]string, error) {
+	config, err := LoadConfig(configPath, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return ListNamespacesWithConfig(context.Background(), config)
+}
+
+// ListNamespacesWithConfig works like ListNamespaces with a loaded config, the
+// request ends with the context or the request timeout of the config.
+func ListNamespacesWithConfig(ctx context.Context, config *Config) ([]string, error) {
+	_, clientset := config.client()
+
+	ctx, cancel := config.requestContextFrom(ctx)
+	defer cancel()
+
+	return listNamespaces(ctx, clientset)
+}
+
+func listNamespaces(ctx context.Context, clientset kubernetes.Interface) ([]string, error) {
+	list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for _, namespace := range list.Items {
+		names = append(names, namespace.Name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
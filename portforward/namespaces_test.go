@@ -0,0 +1,52 @@
+package portforward
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestListNamespaces(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+	)
+
+	// Act
+	names, err := listNamespaces(context.Background(), clientset)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"default", "team-a", "team-b"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v but got %v", expected, names)
+	}
+}
+
+func TestListNamespacesWithConfig(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	config := &Config{restConfig: &rest.Config{Host: "https://example.com"}, clientset: clientset, namespace: "default"}
+
+	// Act
+	names, err := ListNamespacesWithConfig(context.Background(), config)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"team-a"}) {
+		t.Errorf("Expected [team-a] but got %v", names)
+	}
+}
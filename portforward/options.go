@@ -0,0 +1,290 @@
+package portforward
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// ===== Forward options =====
+
+// Option customizes a single forward.
+type Option func(*options)
+
+type options struct {
+	addresses    []string
+	reconnect    bool
+	readyTimeout time.Duration
+	errorHandler func(error)
+	idleTimeout  time.Duration
+	maxLifetime  time.Duration
+	onExpired    func()
+	drainTimeout time.Duration
+	attempts     int
+	retryBackoff time.Duration
+	// healthInterval enables the health check of the connection to the pod.
+	healthInterval time.Duration
+	waitTimeout    time.Duration
+	followRollouts bool
+	podStrategy    PodStrategy
+	noStickyPod    bool
+	balance        bool
+	// podRace is the number of candidate pods that are connected at once.
+	podRace int
+	// mirrorTarget receives a copy of the traffic when set.
+	mirrorTarget string
+	strictPorts  bool
+	relayImage   string
+	jumpHost     string
+	jumpCommand  []string
+	// portRangeFirst and portRangeLast are the range for busy and ephemeral
+	// local ports.
+	portRangeFirst int
+	portRangeLast  int
+	// keepAlive is the keepalive period of local connections, zero keeps the
+	// default.
+	keepAlive time.Duration
+	logLevel  LogLevel
+	logPrefix string
+	logOutput io.Writer
+	// tls serves the local ports over TLS, with a self-signed certificate
+	// without files.
+	tls         bool
+	tlsCertFile string
+	tlsKeyFile  string
+	// tlsClientCAFile requires client certificates signed by its CAs.
+	tlsClientCAFile string
+	allowedClients  []string
+	// uploadLimit and downloadLimit are in bytes per second, zero is unlimited.
+	uploadLimit   int
+	downloadLimit int
+	// chaos injects faults into the local connections when set.
+	chaos       *Chaos
+	capturePath string
+	httpLogging bool
+	// maxConnections limits the open local connections, excess connections
+	// wait up to connectionWait.
+	maxConnections int
+	connectionWait time.Duration
+	streamPoolSize int
+	accessLog      io.Writer
+
+	// Only used by ForwardWithOptions.
+	ports         []PortMapping
+	config        *Config
+	configPath    string
+	kubeContext   string
+	configOptions []ConfigOption
+	ctx           context.Context
+
+	onReady            func([]PortMapping)
+	onConnectionOpened func(ConnectionInfo)
+	onConnectionClosed func(ConnectionInfo)
+	onHTTPRequest      func(HTTPRequestInfo)
+	onStop             func(error)
+	onStopEvent        func(StopEvent)
+
+	conflictPolicy ConflictPolicy
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		addresses:  []string{"localhost"},
+		attempts:   1,
+		relayImage: DefaultRelayImage,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithPorts sets the ports of ForwardWithOptions.
+func WithPorts(ports ...PortMapping) Option {
+	return func(o *options) {
+		o.ports = append(o.ports, ports...)
+	}
+}
+
+// WithConfig lets ForwardWithOptions reuse an already loaded config.
+func WithConfig(config *Config) Option {
+	return func(o *options) {
+		o.config = config
+	}
+}
+
+// WithKubeconfig lets ForwardWithOptions load the config like LoadConfig. An
+// empty path and context use the defaults of kubectl.
+func WithKubeconfig(configPath, kubeContext string, opts ...ConfigOption) Option {
+	return func(o *options) {
+		o.configPath, o.kubeContext, o.configOptions = configPath, kubeContext, opts
+	}
+}
+
+// WithContext stops the forward of ForwardWithOptions when the context is
+// cancelled like ForwardWithContext.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithAddress binds the local listener to the given addresses instead of
+// localhost, e.g. "0.0.0.0" to expose the port to other machines or "::1".
+// Several addresses, e.g. "127.0.0.1" and a docker bridge IP, bind the same
+// port and share the connection to the pod.
+func WithAddress(addresses ...string) Option {
+	return func(o *options) {
+		o.addresses = addresses
+	}
+}
+
+// WithPortRange binds a free port of the range, e.g. 30000 to 32000, when a
+// local port is busy or 0. The chosen ports are returned like ephemeral ports.
+func WithPortRange(first, last int) Option {
+	return func(o *options) {
+		o.portRangeFirst, o.portRangeLast = first, last
+	}
+}
+
+// WithAutoReconnect keeps the local listeners open when the connection to the
+// pod is lost, e.g. because the pod restarted. The target is resolved again
+// and reconnected with a backoff until the forward is stopped.
+func WithAutoReconnect() Option {
+	return func(o *options) {
+		o.reconnect = true
+	}
+}
+
+// WithReadyTimeout fails the forward when it is not ready within the timeout,
+// i.e. the target was not resolved, connected and listened on in time.
+// Without it the connection to the pod must be set up within two minutes, a
+// timeout of zero or less waits forever.
+func WithReadyTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readyTimeout = timeout
+		if timeout <= 0 {
+			o.readyTimeout = -1
+		}
+	}
+}
+
+// WithErrorHandler receives the errors that happen while forwarding, e.g. of
+// single connections, reconnects or a lost connection to the pod. By default
+// they are logged by the forward. The handler is called from the goroutines of
+// the forward like the other callbacks.
+func WithErrorHandler(handler func(error)) Option {
+	return func(o *options) {
+		o.errorHandler = handler
+	}
+}
+
+// WithIdleTimeout stops the forward when no local connection was open for the
+// timeout. Err delivers an error for the idle forward.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxLifetime stops the forward when it was ready for the lifetime,
+// regardless of its activity. Err delivers an error for the expired forward
+// and the optional callback is called after it was stopped.
+func WithMaxLifetime(lifetime time.Duration, onExpired func()) Option {
+	return func(o *options) {
+		o.maxLifetime = lifetime
+		o.onExpired = onExpired
+	}
+}
+
+// WithDrain lets open local connections finish when the forward is stopped.
+// The listeners are closed right away, the connection to the pod is closed
+// when all local connections were closed or after the timeout.
+func WithDrain(timeout time.Duration) Option {
+	return func(o *options) {
+		o.drainTimeout = timeout
+	}
+}
+
+// WithStrictPorts fails the forward with ErrPortNotDeclared when the pod
+// declares container ports but not the remote port, instead of logging a
+// warning. Pods that declare no ports are not checked.
+func WithStrictPorts() Option {
+	return func(o *options) {
+		o.strictPorts = true
+	}
+}
+
+// WithRetry connects up to the given attempts when the forward is set up, e.g.
+// while the pod is starting. The backoff between the attempts doubles. When
+// all attempts fail the errors of all attempts are returned.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.attempts = attempts
+		o.retryBackoff = backoff
+	}
+}
+
+// WithHealthCheck probes the connection to the pod every interval and
+// replaces it when it stopped answering, e.g. dropped by a firewall.
+func WithHealthCheck(interval time.Duration) Option {
+	return func(o *options) {
+		o.healthInterval = interval
+	}
+}
+
+// WithWaitForTarget waits up to the timeout for the target to appear with a
+// ready pod instead of failing, e.g. while its chart is installed.
+func WithWaitForTarget(timeout time.Duration) Option {
+	return func(o *options) {
+		o.waitTimeout = timeout
+	}
+}
+
+// WithFollowRollouts moves the forward of a workload or service to another
+// ready pod when its pod is replaced, e.g. during a rollout.
+func WithFollowRollouts() Option {
+	return func(o *options) {
+		o.followRollouts = true
+	}
+}
+
+// ConnectionInfo describes a local connection of a forward.
+type ConnectionInfo struct {
+	Port PortMapping
+	// Client is the address of the local client.
+	Client net.Addr
+}
+
+// WithOnReady is called with the bound ports when the forward is ready.
+func WithOnReady(callback func([]PortMapping)) Option {
+	return func(o *options) {
+		o.onReady = callback
+	}
+}
+
+// WithOnConnectionOpened is called for every accepted local connection.
+func WithOnConnectionOpened(callback func(ConnectionInfo)) Option {
+	return func(o *options) {
+		o.onConnectionOpened = callback
+	}
+}
+
+// WithOnConnectionClosed is called when a local connection was closed.
+func WithOnConnectionClosed(callback func(ConnectionInfo)) Option {
+	return func(o *options) {
+		o.onConnectionClosed = callback
+	}
+}
+
+// WithOnStop is called when the forward ended with the error that failed or
+// ended it, nil for a stopped forward. The callback is called after Err was
+// closed.
+func WithOnStop(callback func(error)) Option {
+	return func(o *options) {
+		o.onStop = callback
+	}
+}
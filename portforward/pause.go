@@ -0,0 +1,126 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+)
+
+// ===== Pause and resume =====
+
+/*
+During maintenance windows of the cluster a forward can be paused instead of
+stopped, so it keeps its local ports and its registration. A paused forward
+closes new local connections right away, open connections are not affected.
+Pausing can also close the connection to the pod, resuming dials the target
+again, possibly another pod of it.
+*/
+
+// Pause closes new local connections until Resume. With disconnect the
+// connection to the pod is closed as well.
+func (f *Forwarder) Pause(disconnect bool) {
+	f.tunnel.pause(disconnect)
+}
+
+// Resume accepts local connections again and reconnects a forward that was
+// paused with disconnect. The forward stays paused when reconnecting fails.
+func (f *Forwarder) Resume() error {
+	return f.tunnel.resume()
+}
+
+// Paused reports whether the forward is paused.
+func (f *Forwarder) Paused() bool {
+	paused, _ := f.tunnel.pauseState()
+	return paused
+}
+
+// PauseForwarding pauses the registered forward to the target like Pause.
+func PauseForwarding(namespace, target string, disconnect bool) error {
+	forwarder, err := registeredForwarder(namespace, target)
+	if err != nil {
+		return err
+	}
+
+	forwarder.Pause(disconnect)
+	return nil
+}
+
+// ResumeForwarding resumes the registered forward to the target like Resume.
+func ResumeForwarding(namespace, target string) error {
+	forwarder, err := registeredForwarder(namespace, target)
+	if err != nil {
+		return err
+	}
+
+	return forwarder.Resume()
+}
+
+// registeredForwarder returns the forwarder of a registered forward.
+func registeredForwarder(namespace, target string) (*Forwarder, error) {
+	key := fmt.Sprintf("%s/%s", namespace, target)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// The latest forward to the target.
+	forwards := activeForwards[key]
+	if len(forwards) == 0 || forwards[len(forwards)-1].forwarder == nil {
+		return nil, fmt.Errorf("no active forward to %s", key)
+	}
+
+	return forwards[len(forwards)-1].forwarder, nil
+}
+
+func (t *tunnel) pause(disconnect bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.paused {
+		t.logf(LogInfo, "paused")
+	}
+	t.paused = true
+
+	if disconnect && !t.disconnected && t.conn != nil {
+		t.disconnected = true
+		t.conn.Close()
+		t.replaceExtras(nil, false)
+		t.closeRetired()
+	}
+}
+
+func (t *tunnel) resume() error {
+	paused, disconnected := t.pauseState()
+	if !paused {
+		return nil
+	}
+
+	if disconnected {
+		if err := t.connect(t.ctx); err != nil {
+			return fmt.Errorf("resuming %s/%s: %w", t.namespace, t.target, err)
+		}
+	}
+
+	t.mutex.Lock()
+	t.paused, t.disconnected = false, false
+	t.mutex.Unlock()
+
+	t.logf(LogInfo, "resumed")
+	return nil
+}
+
+func (t *tunnel) pauseState() (bool, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.paused, t.disconnected
+}
+
+// rejectPaused closes the local connection if the forward is paused.
+func (t *tunnel) rejectPaused(conn net.Conn) bool {
+	if paused, _ := t.pauseState(); !paused {
+		return false
+	}
+
+	conn.Close()
+	t.logf(LogDebug, "closed connection from %s: forward is paused", conn.RemoteAddr())
+	return true
+}
@@ -0,0 +1,147 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// assertClosedByForward checks that a new local connection is closed.
+func assertClosedByForward(t *testing.T, port int) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Expected the port to stay bound but got %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the connection to be closed but got %v", err)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "paused-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "paused-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port := forwarder.Ports()[0].Local
+
+	// Act
+	forwarder.Pause(false)
+
+	// Assert
+	if !forwarder.Paused() {
+		t.Errorf("Forward should be paused")
+	}
+
+	assertClosedByForward(t, port)
+
+	if server.streamCount("paused-pod") != 0 {
+		t.Errorf("Expected no streams while paused but got %d", server.streamCount("paused-pod"))
+	}
+
+	if err := forwarder.Resume(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, port)
+
+	if server.dialCount() != 1 {
+		t.Errorf("Expected the connection to be kept but got %d connections", server.dialCount())
+	}
+}
+
+func TestPauseWithDisconnect(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "disconnected-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "disconnected-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port := forwarder.Ports()[0].Local
+
+	// Act
+	forwarder.Pause(true)
+
+	// Assert
+	select {
+	case <-forwarder.done:
+		t.Fatalf("Paused forward should not end")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	assertClosedByForward(t, port)
+
+	if err := forwarder.Resume(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, port)
+
+	if server.dialCount() != 2 {
+		t.Errorf("Expected a new connection after resuming but got %d connections", server.dialCount())
+	}
+}
+
+func TestPauseForwarding(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "registered-paused-pod")
+
+	ports, err := ForwardPorts(config, "default", "registered-paused-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer StopForwarding("default", "registered-paused-pod")
+
+	// Act
+	err = PauseForwarding("default", "registered-paused-pod", true)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !IsActive("default", "registered-paused-pod") {
+		t.Errorf("Paused forward should stay registered")
+	}
+
+	for _, info := range ListActiveForwards() {
+		if info.Target == "registered-paused-pod" && !info.Paused {
+			t.Errorf("Expected the forward to be listed as paused")
+		}
+	}
+
+	if err := ResumeForwarding("default", "registered-paused-pod"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, ports[0].Local)
+}
+
+func TestPauseForwardingOfUnknownForward(t *testing.T) {
+	// Act
+	err := PauseForwarding("default", "unknown-pod", false)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for an unknown forward")
+	}
+}
@@ -0,0 +1,44 @@
+package portforward
+
+import (
+	"net"
+	"strings"
+)
+
+// ===== Windows named pipes =====
+
+/*
+Several Windows database and IPC clients connect to named pipes instead of
+TCP ports. A local socket named like \\.\pipe\<name> is served as a named
+pipe, it only accepts clients of the same machine and user. Other platforms
+fail such forwards. Pipes have no deadlines, the TLS handshake of a pipe
+client is not bounded by a timeout.
+*/
+
+// pipePrefix starts the names of local named pipes.
+const pipePrefix = `\\.\pipe\`
+
+// isNamedPipe reports whether the local socket is a Windows named pipe.
+func isNamedPipe(path string) bool {
+	return strings.HasPrefix(strings.ToLower(path), pipePrefix)
+}
+
+// listenSocket listens on the named pipe or Unix socket of the path.
+func listenSocket(path string) (net.Listener, error) {
+	if isNamedPipe(path) {
+		return listenPipe(path)
+	}
+
+	return listenUnix(path)
+}
+
+// pipeAddr is the address of a named pipe.
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package portforward
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenPipe fails, named pipes only exist on Windows.
+func listenPipe(path string) (net.Listener, error) {
+	return nil, fmt.Errorf("unable to listen on %s: named pipes are only supported on Windows", path)
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package portforward
+
+import (
+	"testing"
+)
+
+func TestForwardOnNamedPipeFailsOutsideWindows(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "pipe-pod")
+
+	// Act
+	_, err := ForwardPorts(server.config, "default", "pipe-pod", []PortMapping{{LocalSocket: `\\.\pipe\pytogo-test`, Remote: 5432}})
+	defer StopForwarding("default", "pipe-pod")
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned for a named pipe")
+	}
+
+	if server.dialCount() != 0 {
+		t.Errorf("Expected no connection to the pod but got %d connections", server.dialCount())
+	}
+}
@@ -0,0 +1,322 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the buffer size of a pipe instance in each direction.
+const pipeBufferSize = 64 * 1024
+
+// pipeListener accepts the clients of a named pipe. Every client is connected
+// to its own instance of the pipe, the next instance waits for the next one.
+type pipeListener struct {
+	path     string
+	security *windows.SecurityAttributes
+	// closing is signaled by Close and cancels a waiting Accept.
+	closing windows.Handle
+
+	mutex  sync.Mutex
+	handle windows.Handle
+	closed bool
+	ops    sync.WaitGroup
+}
+
+// listenPipe creates the first instance of the named pipe, it fails when
+// another process serves the pipe.
+func listenPipe(path string) (net.Listener, error) {
+	security, err := currentUserOnly()
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", path, err)
+	}
+
+	closing, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", path, err)
+	}
+
+	l := &pipeListener{path: path, security: security, closing: closing}
+	if l.handle, err = l.newInstance(true); err != nil {
+		windows.CloseHandle(closing)
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) || errors.Is(err, windows.ERROR_PIPE_BUSY) {
+			return nil, fmt.Errorf("unable to listen on %s: %w", path, ErrLocalPortInUse)
+		}
+		return nil, fmt.Errorf("unable to listen on %s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// currentUserOnly returns security attributes that only grant the current
+// user access to the pipe.
+func currentUserOnly() (*windows.SecurityAttributes, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return nil, err
+	}
+
+	return &windows.SecurityAttributes{
+		Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+		SecurityDescriptor: descriptor,
+	}, nil
+}
+
+func (l *pipeListener) newInstance(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+
+	return windows.CreateNamedPipe(name, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, l.security)
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	for {
+		l.mutex.Lock()
+		if l.closed {
+			l.mutex.Unlock()
+			return nil, net.ErrClosed
+		}
+		handle := l.handle
+		l.ops.Add(1)
+		l.mutex.Unlock()
+
+		_, err := waitIO(handle, l.closing, func(o *windows.Overlapped) error {
+			return windows.ConnectNamedPipe(handle, o)
+		})
+		l.ops.Done()
+
+		switch {
+		case err == windows.ERROR_OPERATION_ABORTED:
+			return nil, net.ErrClosed
+		case err != nil && err != windows.ERROR_PIPE_CONNECTED && err != windows.ERROR_NO_DATA:
+			return nil, err
+		}
+
+		next, nextErr := l.newInstance(false)
+
+		l.mutex.Lock()
+		if l.closed {
+			l.mutex.Unlock()
+			windows.CloseHandle(handle)
+			if nextErr == nil {
+				windows.CloseHandle(next)
+			}
+			return nil, net.ErrClosed
+		}
+		if nextErr == nil {
+			l.handle = next
+		}
+		l.mutex.Unlock()
+
+		if err == windows.ERROR_NO_DATA {
+			// The client was gone before it was accepted.
+			windows.CloseHandle(handle)
+			if nextErr != nil {
+				return nil, nextErr
+			}
+			continue
+		}
+
+		conn, connErr := newPipeConn(handle, l.path)
+		if nextErr != nil || connErr != nil {
+			if conn != nil {
+				conn.Close()
+			} else {
+				windows.CloseHandle(handle)
+			}
+			if nextErr != nil {
+				return nil, nextErr
+			}
+			return nil, connErr
+		}
+
+		return conn, nil
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mutex.Unlock()
+
+	_ = windows.SetEvent(l.closing)
+	l.ops.Wait()
+
+	windows.CloseHandle(l.closing)
+	return windows.CloseHandle(l.handle)
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+// pipeConn is a client connected to an instance of the pipe.
+type pipeConn struct {
+	handle windows.Handle
+	addr   pipeAddr
+	// closing is signaled by Close and cancels waiting reads and writes.
+	closing windows.Handle
+
+	mutex  sync.Mutex
+	closed bool
+	ops    sync.WaitGroup
+}
+
+func newPipeConn(handle windows.Handle, path string) (*pipeConn, error) {
+	closing, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeConn{handle: handle, addr: pipeAddr(path), closing: closing}, nil
+}
+
+// begin registers an operation unless the connection was closed.
+func (c *pipeConn) begin() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.ops.Add(1)
+	return true
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if !c.begin() {
+		return 0, net.ErrClosed
+	}
+	defer c.ops.Done()
+
+	n, err := waitIO(c.handle, c.closing, func(o *windows.Overlapped) error {
+		return windows.ReadFile(c.handle, b, nil, o)
+	})
+
+	switch {
+	case err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED:
+		return int(n), io.EOF
+	case err == windows.ERROR_OPERATION_ABORTED:
+		return int(n), net.ErrClosed
+	}
+
+	return int(n), err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	if !c.begin() {
+		return 0, net.ErrClosed
+	}
+	defer c.ops.Done()
+
+	written := 0
+	for written < len(b) {
+		n, err := waitIO(c.handle, c.closing, func(o *windows.Overlapped) error {
+			return windows.WriteFile(c.handle, b[written:], nil, o)
+		})
+		written += int(n)
+
+		if err == windows.ERROR_OPERATION_ABORTED {
+			return written, net.ErrClosed
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+func (c *pipeConn) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mutex.Unlock()
+
+	_ = windows.SetEvent(c.closing)
+	c.ops.Wait()
+
+	windows.CloseHandle(c.closing)
+	return windows.CloseHandle(c.handle)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline is not supported by pipes and ignored.
+func (c *pipeConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is not supported by pipes and ignored.
+func (c *pipeConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is not supported by pipes and ignored.
+func (c *pipeConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// waitIO starts the overlapped operation and waits until it completed or the
+// closing event cancelled it. It returns the transferred bytes.
+func waitIO(handle, closing windows.Handle, op func(*windows.Overlapped) error) (uint32, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+
+	overlapped := &windows.Overlapped{HEvent: event}
+	err = op(overlapped)
+	if err != nil && err != windows.ERROR_IO_PENDING {
+		return 0, err
+	}
+
+	if err == windows.ERROR_IO_PENDING {
+		signaled, err := windows.WaitForMultipleObjects([]windows.Handle{event, closing}, false, windows.INFINITE)
+		if err != nil {
+			return 0, err
+		}
+		if signaled == windows.WAIT_OBJECT_0+1 {
+			_ = windows.CancelIoEx(handle, overlapped)
+		}
+	}
+
+	var n uint32
+	err = windows.GetOverlappedResult(handle, overlapped, &n, true)
+
+	return n, err
+}
@@ -0,0 +1,80 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// dialPipe connects to the named pipe.
+func dialPipe(t *testing.T, path string) *os.File {
+	t.Helper()
+
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	handle, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		t.Fatalf("Could not connect to the pipe: %v", err)
+	}
+
+	return os.NewFile(uintptr(handle), path)
+}
+
+func TestForwardOnNamedPipe(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "pipe-pod")
+	path := fmt.Sprintf(`\\.\pipe\pytogo-test-%d`, time.Now().UnixNano())
+
+	// Act
+	bound, err := ForwardPorts(config, "default", "pipe-pod", []PortMapping{{LocalSocket: path, Remote: 5432}})
+	defer StopForwarding("default", "pipe-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if bound[0].LocalSocket != path {
+		t.Errorf("Unexpected port mapping %v", bound[0])
+	}
+
+	for i := 0; i < 2; i++ {
+		client := dialPipe(t, path)
+
+		if _, err := client.Write([]byte("ping")); err != nil {
+			t.Fatalf("Could not write to the pipe: %v", err)
+		}
+
+		reply := make([]byte, 4)
+		if _, err := client.Read(reply); err != nil || string(reply) != "ping" {
+			t.Errorf("Expected ping to be echoed but got %q: %v", reply, err)
+		}
+
+		client.Close()
+	}
+}
+
+func TestListenPipeWithPipeInUse(t *testing.T) {
+	// Arrange
+	path := fmt.Sprintf(`\\.\pipe\pytogo-test-%d`, time.Now().UnixNano())
+	listener, err := listenPipe(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	// Act
+	_, err = listenPipe(path)
+
+	// Assert
+	if !errors.Is(err, ErrLocalPortInUse) {
+		t.Errorf("Expected ErrLocalPortInUse but got %v", err)
+	}
+}
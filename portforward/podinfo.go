@@ -0,0 +1,62 @@
+package portforward
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ===== Resolved pods =====
+
+/*
+Services and workloads resolve to one of their pods, reconnects and
+retargeting may land on another one. The pod of the current connection is
+kept with the details that tell replicas apart, so callers can see which
+replica they are talking to. A pod that keeps its name but changes its UID,
+e.g. of a StatefulSet, was replaced, a restarted container keeps the UID.
+*/
+
+// PodInfo describes the pod a forward is connected to.
+type PodInfo struct {
+	Namespace string
+	Name      string
+	UID       string
+	// ResourceVersion is the version of the pod when it was connected.
+	ResourceVersion string
+	// Node is the node the pod is scheduled to.
+	Node string
+	IP   string
+}
+
+func newPodInfo(pod *corev1.Pod) PodInfo {
+	return PodInfo{
+		Namespace:       pod.Namespace,
+		Name:            pod.Name,
+		UID:             string(pod.UID),
+		ResourceVersion: pod.ResourceVersion,
+		Node:            pod.Spec.NodeName,
+		IP:              pod.Status.PodIP,
+	}
+}
+
+// Pod returns the pod the forward is connected to. It is empty before the
+// forward is ready.
+func (f *Forwarder) Pod() PodInfo {
+	return f.tunnel.podInfo()
+}
+
+// GetTarget returns the pod the registered forward to the target is
+// connected to.
+func GetTarget(namespace, target string) (PodInfo, error) {
+	forwarder, err := registeredForwarder(namespace, target)
+	if err != nil {
+		return PodInfo{}, err
+	}
+
+	return forwarder.Pod(), nil
+}
+
+func (t *tunnel) podInfo() PodInfo {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.podDetails
+}
@@ -0,0 +1,111 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newScheduledPodConfig returns a fake API server with a scheduled pod.
+func newScheduledPodConfig(t *testing.T, name string) *Config {
+	t.Helper()
+
+	config := newFakeAPIServer(t)
+	pod := newTestPod(name, map[string]string{"app": "replicas"}, true, time.Now())
+	pod.UID = types.UID(name + "-uid")
+	pod.ResourceVersion = "42"
+	pod.Spec.NodeName = "node-1"
+	pod.Status.PodIP = "10.1.2.3"
+	if _, err := config.clientset.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return config
+}
+
+func TestForwarderPod(t *testing.T) {
+	// Arrange
+	config := newScheduledPodConfig(t, "replica-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "selector/app=replicas", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	pod := forwarder.Pod()
+
+	// Assert
+	expected := PodInfo{Namespace: "default", Name: "replica-pod", UID: "replica-pod-uid", ResourceVersion: "42", Node: "node-1", IP: "10.1.2.3"}
+	if pod != expected {
+		t.Errorf("Expected %+v but got %+v", expected, pod)
+	}
+}
+
+func TestGetTarget(t *testing.T) {
+	// Arrange
+	config := newScheduledPodConfig(t, "registered-replica-pod")
+
+	_, err := ForwardWithContext(context.Background(), config, "default", "selector/app=replicas", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "selector/app=replicas")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	pod, err := GetTarget("default", "selector/app=replicas")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pod.Name != "registered-replica-pod" || pod.UID != "registered-replica-pod-uid" || pod.Node != "node-1" {
+		t.Errorf("Unexpected pod %+v", pod)
+	}
+}
+
+func TestListActiveForwardsWithPodUID(t *testing.T) {
+	// Arrange
+	config := newScheduledPodConfig(t, "listed-replica-pod")
+
+	_, err := ForwardWithContext(context.Background(), config, "default", "listed-replica-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "listed-replica-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	infos := ListActiveForwards()
+
+	// Assert
+	for _, info := range infos {
+		if info.Target != "listed-replica-pod" {
+			continue
+		}
+
+		if info.PodUID != "listed-replica-pod-uid" || info.PodResourceVersion != "42" {
+			t.Errorf("Unexpected pod UID %q and resource version %q", info.PodUID, info.PodResourceVersion)
+		}
+		return
+	}
+
+	t.Errorf("Forward was not listed in %v", infos)
+}
+
+func TestGetTargetWithoutForward(t *testing.T) {
+	// Act
+	_, err := GetTarget("default", "unknown-target")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned without a registered forward")
+	}
+}
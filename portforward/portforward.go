@@ -1,23 +1,23 @@
 package portforward
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/httpstream"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	// Auth plugins - common and cloud provider
 	_ "github.com/Azure/go-autorest/autorest/adal"
@@ -36,163 +36,620 @@ Every space should keep the ownership of its memory allocations.
 Parameters are passed from Python to Go but Go never owns them.
 */
 var (
-	activeForwards = make(map[string]chan struct{})
+	// activeForwards are the registered forwards by namespace and target.
+	activeForwards = make(map[string][]*activeForward)
+	nextForwardID  uint64
 	mutex          sync.Mutex
 )
 
+// activeForward is a registered forward, the forwarder is closed with stopCh.
+type activeForward struct {
+	id        string
+	namespace string
+	target    string
+	stopCh    chan struct{}
+	forwarder *Forwarder
+	// reason is why stopCh was closed.
+	reason StopReason
+}
+
 // registerForwarding adds a forwarding to the active forwards.
 func registerForwarding(namespace, pod string, stopCh chan struct{}) {
+	_, _ = register(namespace, pod, &activeForward{stopCh: stopCh}, ConflictReplace)
+}
+
+// register adds the forward with an ID and returns it. When the policy keeps
+// a forward to the same target, that forward is returned instead.
+func register(namespace, pod string, forward *activeForward, policy ConflictPolicy) (*activeForward, error) {
 	key := fmt.Sprintf("%s/%s", namespace, pod)
+	forward.namespace, forward.target = namespace, pod
 
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	if otherCh, ok := activeForwards[key]; ok {
-		close(otherCh)
+	forwards := activeForwards[key]
+	if len(forwards) > 0 && (policy == ConflictFail || policy == ConflictKeep) {
+		return forwards[len(forwards)-1], nil
+	}
+
+	if err := exceedsForwardLimit(key, policy); err != nil {
+		return nil, err
 	}
 
-	activeForwards[key] = stopCh
+	if policy == ConflictReplace {
+		for _, other := range forwards {
+			closeForward(other, StopReplaced)
+		}
+		delete(activeForwards, key)
+	}
+
+	nextForwardID++
+	forward.id = fmt.Sprintf("forward-%d", nextForwardID)
+	activeForwards[key] = append(activeForwards[key], forward)
+
+	return forward, nil
 }
 
-// StopForwarding closes a port forwarding.
+// closeForward stops the forward for the reason, the caller holds the mutex.
+func closeForward(forward *activeForward, reason StopReason) {
+	forward.reason = reason
+	close(forward.stopCh)
+}
+
+// removeForward removes the forward from the active forwards, the caller
+// holds the mutex.
+func removeForward(key string, forward *activeForward) {
+	forwards := activeForwards[key]
+	for i, other := range forwards {
+		if other == forward {
+			forwards = append(forwards[:i:i], forwards[i+1:]...)
+			break
+		}
+	}
+
+	if len(forwards) == 0 {
+		delete(activeForwards, key)
+	} else {
+		activeForwards[key] = forwards
+	}
+}
+
+// unregisterForwarding closes the forwarding only if it is still registered with stopCh.
+func unregisterForwarding(namespace, pod string, stopCh chan struct{}) bool {
+	key := fmt.Sprintf("%s/%s", namespace, pod)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, other := range activeForwards[key] {
+		if other.stopCh == stopCh {
+			closeForward(other, StopRequested)
+			removeForward(key, other)
+			return true
+		}
+	}
+
+	return false
+}
+
+// StopForwarding closes the port forwardings to the target. The listeners
+// may still be bound when it returns.
 func StopForwarding(namespace, pod string) {
+	stopForwarding(namespace, pod, StopRequested)
+}
+
+// StopForwardingAndWait closes the port forwardings to the target and blocks
+// until their listeners and connections are closed.
+func StopForwardingAndWait(namespace, pod string) {
+	waitStopped(stopForwarding(namespace, pod, StopRequested))
+}
+
+func stopForwarding(namespace, pod string, reason StopReason) []*activeForward {
 	key := fmt.Sprintf("%s/%s", namespace, pod)
 
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	if otherCh, ok := activeForwards[key]; ok {
-		close(otherCh)
+	forwards := activeForwards[key]
+	for _, other := range forwards {
+		closeForward(other, reason)
+	}
+	delete(activeForwards, key)
+
+	return forwards
+}
+
+// StopByID closes the port forwarding with the ID and reports whether it was
+// registered.
+func StopByID(id string) bool {
+	return stopByID(id) != nil
+}
+
+// StopByIDAndWait closes the port forwarding with the ID like StopByID and
+// blocks until its listeners and connections are closed.
+func StopByIDAndWait(id string) bool {
+	forward := stopByID(id)
+	if forward == nil {
+		return false
+	}
+
+	waitStopped([]*activeForward{forward})
+	return true
+}
+
+func stopByID(id string) *activeForward {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for key, forwards := range activeForwards {
+		for _, forward := range forwards {
+			if forward.id == id {
+				closeForward(forward, StopRequested)
+				removeForward(key, forward)
+				return forward
+			}
+		}
+	}
+
+	return nil
+}
+
+// StopAll closes all port forwardings and blocks until their listeners and
+// connections are closed.
+func StopAll() {
+	mutex.Lock()
+	var forwards []*activeForward
+	for _, targetForwards := range activeForwards {
+		for _, forward := range targetForwards {
+			closeForward(forward, StopRequested)
+		}
+		forwards = append(forwards, targetForwards...)
+	}
+	activeForwards = make(map[string][]*activeForward)
+	mutex.Unlock()
+
+	waitStopped(forwards)
+}
+
+// StopAllInNamespace closes the port forwardings to targets in the namespace
+// and blocks until their listeners and connections are closed.
+func StopAllInNamespace(namespace string) {
+	mutex.Lock()
+	var forwards []*activeForward
+	for key, targetForwards := range activeForwards {
+		if targetForwards[0].namespace != namespace {
+			continue
+		}
+
+		for _, forward := range targetForwards {
+			closeForward(forward, StopRequested)
+		}
+		forwards = append(forwards, targetForwards...)
 		delete(activeForwards, key)
 	}
+	mutex.Unlock()
+
+	waitStopped(forwards)
+}
+
+// waitStopped blocks until the closed forwards ended.
+func waitStopped(forwards []*activeForward) {
+	for _, forward := range forwards {
+		if forward.forwarder != nil {
+			<-forward.forwarder.done
+		}
+	}
+}
+
+// IsActive reports whether a forward to the target is still running.
+func IsActive(namespace, target string) bool {
+	key := fmt.Sprintf("%s/%s", namespace, target)
+
+	mutex.Lock()
+	forwards := append([]*activeForward(nil), activeForwards[key]...)
+	mutex.Unlock()
+
+	for _, forward := range forwards {
+		if forward.forwarder == nil {
+			return true
+		}
+
+		select {
+		case <-forward.forwarder.done:
+			// Ended but not unregistered yet.
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// ForwardInfo describes an active forward.
+type ForwardInfo struct {
+	// ID identifies the forward for StopByID.
+	ID        string
+	Namespace string
+	Target    string
+	// Pod is the pod that the target was resolved to.
+	Pod string
+	// PodUID and PodResourceVersion tell a replaced pod of the same name
+	// apart.
+	PodUID             string
+	PodResourceVersion string
+	Ports              []PortMapping
+	Started            time.Time
+	Metrics            Metrics
+	Paused             bool
+}
+
+// ListActiveForwards returns the active forwards sorted by namespace and target.
+func ListActiveForwards() []ForwardInfo {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	infos := make([]ForwardInfo, 0, len(activeForwards))
+	for _, forwards := range activeForwards {
+		for _, forward := range forwards {
+			info := ForwardInfo{ID: forward.id, Namespace: forward.namespace, Target: forward.target}
+			if forward.forwarder != nil {
+				info.Pod, info.Ports, info.Started = forward.forwarder.status()
+				pod := forward.forwarder.Pod()
+				info.PodUID, info.PodResourceVersion = pod.UID, pod.ResourceVersion
+				info.Metrics = forward.forwarder.Metrics()
+				info.Paused = forward.forwarder.Paused()
+			}
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Namespace != infos[j].Namespace {
+			return infos[i].Namespace < infos[j].Namespace
+		}
+		if infos[i].Target != infos[j].Target {
+			return infos[i].Target < infos[j].Target
+		}
+		return infos[i].ID < infos[j].ID
+	})
+
+	return infos
 }
 
 // ===== Port forwarding =====
 
 // Forward connects to a Pod and tunnels traffic from a local port to this pod.
-func Forward(namespace, podName string, fromPort, toPort int, configPath string) error {
-	// Based on example https://github.com/kubernetes/client-go/issues/51#issuecomment-436200428
+// The target is a pod name, a service like "svc/web" or a workload like
+// "deployment/web".
+// An empty namespace uses the namespace of the current kubeconfig context.
+// Another context or a custom User-Agent are selected with
+// WithKubeconfig(path, context, WithUserAgent(agent)) on ForwardWithOptions.
+// Use ForwardPort to learn the port bound for a fromPort of 0.
+func Forward(namespace, target string, fromPort, toPort int, configPath string) error {
+	_, err := ForwardPort(namespace, target, fromPort, toPort, configPath)
+	return err
+}
 
-	// CONFIG
-	var config *rest.Config
+// ForwardPort works like Forward and returns the bound local port, a fromPort
+// of 0 binds an ephemeral port.
+func ForwardPort(namespace, target string, fromPort, toPort int, configPath string) (int, error) {
+	ports, err := ForwardWithOptions(namespace, target,
+		WithPorts(PortMapping{Local: fromPort, Remote: toPort}),
+		WithKubeconfig(configPath, ""),
+	)
+	if err != nil {
+		return 0, err
+	}
 
-	if c, err := loadConfig(configPath); err != nil {
-		return err
-	} else {
-		config = c
+	return ports[0].Local, nil
+}
+
+// ForwardWithOptions works like ForwardWithContext but takes the ports, the
+// config and the context as options, e.g.
+//
+//	ForwardWithOptions("default", "svc/web", WithPorts(PortMapping{Remote: 80}), WithReadyTimeout(time.Minute))
+//
+// Without WithConfig the config is loaded like LoadConfig, without
+// WithContext the forward runs until it is stopped.
+func ForwardWithOptions(namespace, target string, opts ...Option) ([]PortMapping, error) {
+	o := newOptions(opts)
+	if len(o.ports) == 0 {
+		return nil, fmt.Errorf("at least one port mapping is required")
 	}
 
-	// CHECK
-	// PortForward must be started in a go-routine, therefore we have
-	// to check manually if the pod exists and is reachable.
-	if err := checkPodExistence(config, namespace, podName); err != nil {
-		return err
+	config := o.config
+	if config == nil {
+		var err error
+		if config, err = LoadConfig(o.configPath, o.kubeContext, o.configOptions...); err != nil {
+			return nil, err
+		}
 	}
 
-	// DIALER
-	var dialer httpstream.Dialer
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
-	if d, err := newDialer(config, namespace, podName); err != nil {
-		return err
-	} else {
-		dialer = d
+	return ForwardWithContext(ctx, config, namespace, target, o.ports, opts...)
+}
+
+// PortMapping tunnels traffic from a local port to a port of the pod. For
+// service targets the remote port is a port of the service.
+type PortMapping struct {
+	Local  int
+	Remote int
+	// RemoteName is a named port, it is used instead of Remote when set.
+	RemoteName string
+	// LocalSocket is the path of a Unix socket or the name of a Windows named
+	// pipe like `\\.\pipe\db`, it is listened on instead of the local port
+	// when set.
+	LocalSocket string
+}
+
+// String formats the mapping like kubectl.
+func (p PortMapping) String() string {
+	local := strconv.Itoa(p.Local)
+	if p.LocalSocket != "" {
+		local = p.LocalSocket
 	}
 
-	// PORT FORWARD
-	stopChan, readyChan := make(chan struct{}, 1), make(chan struct{}, 1)
+	return fmt.Sprintf("%s:%s", local, p.remoteString())
+}
 
-	ports := fmt.Sprintf("%d:%d", fromPort, toPort)
+func (p PortMapping) remoteString() string {
+	if p.RemoteName != "" {
+		return p.RemoteName
+	}
 
-	if err := startForward(dialer, ports, stopChan, readyChan); err != nil {
-		return err
+	return strconv.Itoa(p.Remote)
+}
+
+// ForwardWithConfig works like Forward but reuses an already loaded config.
+// An empty namespace uses the namespace of the kubeconfig context like kubectl.
+func ForwardWithConfig(config *Config, namespace, target string, fromPort, toPort int, opts ...Option) (int, error) {
+	ports, err := ForwardPorts(config, namespace, target, []PortMapping{{Local: fromPort, Remote: toPort}}, opts...)
+	if err != nil {
+		return 0, err
 	}
 
-	// HANDLE CLOSING
-	registerForwarding(namespace, podName, stopChan)
-	closeOnSigterm(namespace, podName)
+	return ports[0].Local, nil
+}
 
-	return nil
+// ForwardPorts tunnels several ports over a single connection to the pod and
+// returns the mappings with the bound local ports and the remote ports of the
+// pod. A local port of 0 binds an ephemeral port. The forward is ready when
+// it returns, setup failures are returned instead of surfacing later.
+func ForwardPorts(config *Config, namespace, target string, ports []PortMapping, opts ...Option) ([]PortMapping, error) {
+	return ForwardWithContext(context.Background(), config, namespace, target, ports, opts...)
 }
 
-// loadConfig fetches the config from .kube config folder inside the home dir.
-func loadConfig(configPath string) (*rest.Config, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
+// ForwardWithContext works like ForwardPorts but cancelling the context
+// stops the forward like StopForwarding. The context also cancels the
+// requests that set up the forward.
+func ForwardWithContext(ctx context.Context, config *Config, namespace, target string, ports []PortMapping, opts ...Option) ([]PortMapping, error) {
+	_, forwarded, err := forward(ctx, config, namespace, target, ports, ConflictReplace, opts)
+	return forwarded, err
+}
+
+// ForwardWithID forwards like ForwardWithContext but keeps the other forwards
+// to the target running. The returned ID stops the forward with StopByID.
+func ForwardWithID(ctx context.Context, config *Config, namespace, target string, ports []PortMapping, opts ...Option) (string, []PortMapping, error) {
+	registered, forwarded, err := forward(ctx, config, namespace, target, ports, conflictAdd, opts)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	return config, nil
+	return registered.id, forwarded, nil
 }
 
-func checkPodExistence(config *rest.Config, namespace, podName string) error {
-	clientset, err := kubernetes.NewForConfig(config)
+// ForwardAndWait forwards like ForwardWithContext and blocks until the forward
+// ended. It returns the error that failed or ended the forward, nil when it
+// was stopped by StopForwarding, a signal or the context.
+func ForwardAndWait(ctx context.Context, config *Config, namespace, target string, ports []PortMapping, opts ...Option) error {
+	registered, _, err := forward(ctx, config, namespace, target, ports, ConflictReplace, opts)
 	if err != nil {
 		return err
 	}
 
-	_, err = clientset.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if registered.forwarder == nil {
+		// Kept forward without a handle.
+		return nil
+	}
+
+	return registered.forwarder.wait()
+}
+
+// forward starts and registers a forward, the policy of the options overrides
+// the default policy for registered forwards to the target. It returns the
+// registered forward.
+func forward(ctx context.Context, config *Config, namespace, target string, ports []PortMapping, policy ConflictPolicy, opts []Option) (*activeForward, []PortMapping, error) {
+	if configured := newOptions(opts).conflictPolicy; configured != 0 {
+		policy = configured
+	}
+
+	if namespace == "" {
+		namespace = config.defaultNamespace()
+	}
+
+	// CHECK
+	if existing := conflicting(namespace, target, policy); existing != nil {
+		return resolveConflict(existing, policy)
+	}
+	if err := checkForwardLimit(namespace, target, policy); err != nil {
+		return nil, nil, err
+	}
+
+	forwarder, err := NewForwarder(ctx, config, namespace, target, ports, opts...)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	return nil
+	if err := forwarder.waitReady(); err != nil {
+		return nil, nil, err
+	}
+
+	namespace = forwarder.tunnel.namespace
+	stopChan := make(chan struct{})
+	entry := &activeForward{stopCh: stopChan, forwarder: forwarder}
+	registered, err := register(namespace, target, entry, policy)
+	if err != nil {
+		forwarder.Stop()
+		return nil, nil, err
+	}
+	if registered != entry {
+		// Lost against a forward registered in the meantime.
+		forwarder.Stop()
+		return resolveConflict(registered, policy)
+	}
+	forwarder.mutex.Lock()
+	forwarder.id = entry.id
+	forwarder.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-stopChan:
+			mutex.Lock()
+			reason := entry.reason
+			mutex.Unlock()
+
+			forwarder.tunnel.stopWith(reason, nil)
+		case <-forwarder.done:
+			unregisterForwarding(namespace, target, stopChan)
+		}
+	}()
+
+	// HANDLE CLOSING
+	closeOnSigterm(namespace, target)
+
+	return entry, forwarder.Ports(), nil
+}
+
+// ForwardSelector works like ForwardPorts but forwards to a ready pod
+// matching the label selector, e.g. "app=web,tier=frontend". The forward is
+// stopped with StopForwarding(namespace, "selector/"+selector).
+func ForwardSelector(config *Config, namespace, selector string, ports []PortMapping, opts ...Option) ([]PortMapping, error) {
+	if _, err := labels.Parse(selector); err != nil {
+		return nil, err
+	}
+
+	return ForwardPorts(config, namespace, selectorKind+"/"+selector, ports, opts...)
 }
 
-// newDialer creates a dialer that connects to the pod.
-func newDialer(config *rest.Config, namespace, podName string) (httpstream.Dialer, error) {
-	roundTripper, upgrader, err := spdy.RoundTripperFor(config)
+// ForwardAllPorts forwards every TCP port that the target declares and returns
+// the mappings. A service forwards its ports to their target ports, other
+// targets the container ports of their pod. The ports are bound locally with
+// the same number, or as ephemeral ports when ephemeral is set.
+func ForwardAllPorts(ctx context.Context, config *Config, namespace, target string, ephemeral bool, opts ...Option) ([]PortMapping, error) {
+	if namespace == "" {
+		namespace = config.defaultNamespace()
+	}
+
+	_, clientset := config.client()
+
+	requestCtx, cancel := config.requestContextFrom(ctx)
+	defer cancel()
+
+	resolved, err := resolveTarget(requestCtx, clientset, namespace, target)
 	if err != nil {
 		return nil, err
 	}
 
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName)
-	hostIP := strings.TrimLeft(config.Host, "https://")
+	ports := declaredPorts(resolved, ephemeral)
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("%s/%s declares no TCP ports", namespace, target)
+	}
+
+	return ForwardWithContext(ctx, config, namespace, target, ports, opts...)
+}
+
+// prepareForward resolves the pod of the target and its ports and creates the
+// dialer for the pod.
+func prepareForward(parent context.Context, config *Config, namespace, target string, ports []PortMapping, pick podPicker) (httpstream.Dialer, *corev1.Pod, []PortMapping, error) {
+	// The pod is resolved up front, a missing target fails the forward
+	// instead of the first connection.
+	restConfig, clientset := config.client()
 
-	// When there is a "/" in the hostIP, it contains also a path
-	if parts := strings.SplitN(hostIP, "/", 2); len(parts) == 2 {
-		hostIP = parts[0]
-		path = fmt.Sprintf("/%s%s", parts[1], path)
+	ctx, cancel := config.requestContextFrom(parent)
+	defer cancel()
+
+	candidates, err := resolveTargets(ctx, clientset, namespace, target)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	resolvedTarget := pick(candidates)
 
-	serverURL := url.URL{Scheme: "https", Path: path, Host: hostIP}
+	resolved, err := resolvePorts(resolvedTarget, ports)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, &serverURL)
+	dialer, err := newDialer(restConfig, namespace, resolvedTarget.pod.Name, &config.options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	return dialer, nil
+	return dialer, resolvedTarget.pod, resolved, nil
 }
 
-// startForward runs the port-forwarding.
-func startForward(dialer httpstream.Dialer, ports string, stopChan, readyChan chan struct{}) error {
-	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+// newDialer creates a dialer that connects to the pod. With websocket the
+// SPDY upgrade is only the fallback.
+func newDialer(config *rest.Config, namespace, podName string, options *configOptions) (httpstream.Dialer, error) {
+	roundTripper, upgrader, err := roundTripperFor(config, options.pings())
+	if err != nil {
+		return nil, err
+	}
 
-	forwarder, err := portforward.New(dialer, []string{ports}, stopChan, readyChan, out, errOut)
+	serverURL, err := portForwardURL(config, namespace, podName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	go func() {
-		// Kubernetes will close this channel when it has something to tell us.
-		for range readyChan {
-		}
-		if len(errOut.String()) != 0 {
-			panic(errOut.String())
-		} else if len(out.String()) != 0 {
-			fmt.Println(out.String())
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, serverURL)
+
+	if options.websocket {
+		websocketDialer, err := newWebSocketDialer(config, serverURL, options.pings())
+		if err != nil {
+			return nil, err
 		}
-	}()
 
-	// Locks until stopChan is closed.
-	go func() {
-		if err = forwarder.ForwardPorts(); err != nil {
-			panic(err)
+		return &fallbackDialer{primary: websocketDialer, secondary: dialer}, nil
+	}
+
+	return dialer, nil
+}
+
+// portForwardURL builds the URL of the portforward subresource.
+func portForwardURL(config *rest.Config, namespace, podName string) (*url.URL, error) {
+	return podURL(config, namespace, podName, "portforward")
+}
+
+// podURL builds the URL of a subresource of the pod. The scheme, port and
+// path prefix (e.g. of a proxy) of the configured host are kept.
+func podURL(config *rest.Config, namespace, podName, subresource string) (*url.URL, error) {
+	host := config.Host
+
+	// Hosts may be configured without a scheme like "localhost:8080".
+	if !strings.Contains(host, "://") {
+		scheme := "http"
+		if rest.IsConfigTransportTLS(*config) {
+			scheme = "https"
 		}
-	}()
+		host = scheme + "://" + host
+	}
 
-	return nil
+	serverURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server host %q: %w", config.Host, err)
+	}
+
+	resource := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/%s", namespace, podName, subresource)
+	serverURL.Path = strings.TrimSuffix(serverURL.Path, "/") + resource
+
+	return serverURL, nil
 }
 
 // closeOnSigterm cares about closing a channel when the OS sends a SIGTERM.
-func closeOnSigterm(namespace, podName string) {
+func closeOnSigterm(namespace, target string) {
 	sigs := make(chan os.Signal, 1)
 
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
@@ -201,7 +658,6 @@ func closeOnSigterm(namespace, podName string) {
 		// Received kill signal
 		<-sigs
 
-		StopForwarding(namespace, podName)
+		stopForwarding(namespace, target, StopSignal)
 	}()
 }
-
@@ -1,8 +1,23 @@
 package portforward
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
 )
 
 func TestStopForwarding(t *testing.T) {
@@ -36,6 +51,154 @@ func TestStopForwardingWhenPortForwardIsNotRegistered(t *testing.T) {
 	// ... should be reached without any panic
 }
 
+func TestStopAll(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "all-pod-1", "all-pod-2")
+
+	first, err := ForwardWithConfig(config, "default", "all-pod-1", 0, 8080)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, err := ForwardWithConfig(config, "default", "all-pod-2", 0, 8080)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	StopAll()
+
+	// Assert
+	for _, port := range []int{first, second} {
+		if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+			conn.Close()
+			t.Errorf("Port %d should be closed after StopAll returned", port)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(activeForwards) != 0 {
+		t.Errorf("No forwards should be registered after StopAll but got %d", len(activeForwards))
+	}
+}
+
+func TestStopAllInNamespace(t *testing.T) {
+	// Arrange
+	stopped, other := make(chan struct{}), make(chan struct{})
+	registerForwarding("deleted_namespace", "first_pod", stopped)
+	registerForwarding("kept_namespace", "second_pod", other)
+	defer StopForwarding("kept_namespace", "second_pod")
+
+	config := newFakeAPIServer(t)
+	pod := newTestPod("namespaced-pod", nil, true, time.Now())
+	pod.Namespace = "deleted_namespace"
+	if _, err := config.clientset.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ports, err := ForwardWithContext(context.Background(), config, "deleted_namespace", "namespaced-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	StopAllInNamespace("deleted_namespace")
+
+	// Assert
+	select {
+	case <-stopped:
+		// Success
+	default:
+		t.Errorf("Forward in the namespace should be stopped")
+	}
+
+	select {
+	case <-other:
+		t.Errorf("Forward in another namespace should not be stopped")
+	default:
+		// Success
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+	if err != nil {
+		t.Fatalf("Port %d should be free after stopping: %v", ports[0].Local, err)
+	}
+	listener.Close()
+
+	if IsActive("deleted_namespace", "namespaced-pod") {
+		t.Errorf("Forward should not be active after stopping")
+	}
+}
+
+func TestListActiveForwards(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "listed-pod")
+	before := time.Now()
+
+	localPort, err := ForwardWithConfig(config, "default", "pod/listed-pod", 0, 8080)
+	defer StopForwarding("default", "pod/listed-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	infos := ListActiveForwards()
+
+	// Assert
+	var info *ForwardInfo
+	for i := range infos {
+		if infos[i].Namespace == "default" && infos[i].Target == "pod/listed-pod" {
+			info = &infos[i]
+		}
+	}
+
+	if info == nil {
+		t.Fatalf("Forward should be listed in %v", infos)
+	}
+
+	if info.Pod != "listed-pod" {
+		t.Errorf("Expected pod listed-pod but got %s", info.Pod)
+	}
+
+	if len(info.Ports) != 1 || info.Ports[0] != (PortMapping{Local: localPort, Remote: 8080}) {
+		t.Errorf("Unexpected ports %v", info.Ports)
+	}
+
+	if info.Started.Before(before) {
+		t.Errorf("Start time %s should not be before the forward was started", info.Started)
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "active-pod")
+
+	_, err := ForwardWithConfig(config, "default", "active-pod", 0, 8080)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	active := IsActive("default", "active-pod")
+	StopForwarding("default", "active-pod")
+	stopped := IsActive("default", "active-pod")
+
+	// Assert
+	if !active {
+		t.Errorf("Forward should be active after it was started")
+	}
+
+	if stopped {
+		t.Errorf("Forward should not be active after it was stopped")
+	}
+
+	if IsActive("default", "unknown-pod") {
+		t.Errorf("Unknown forward should not be active")
+	}
+}
+
 func TestForwardWithoutValidConfigPath(t *testing.T) {
 	// Arrange
 	namespace := "any_namespace"
@@ -52,3 +215,631 @@ func TestForwardWithoutValidConfigPath(t *testing.T) {
 		t.Errorf("Error should be returned when a not valid config path is provided")
 	}
 }
+
+func TestForwardWithOptions(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "options-pod")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	ports, err := ForwardWithOptions("default", "options-pod", WithConfig(config), WithContext(ctx), WithPorts(PortMapping{Remote: 8080}, PortMapping{Remote: 9090}))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(ports) != 2 {
+		t.Fatalf("Expected two mappings but got %v", ports)
+	}
+
+	assertEcho(t, ports[1].Local)
+
+	cancel()
+	if !waitForClosedPort(ports[0].Local) {
+		t.Errorf("Listener should be closed after the context was cancelled")
+	}
+}
+
+func TestForwardWithOptionsWithoutPorts(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "options-pod")
+
+	// Act
+	_, err := ForwardWithOptions("default", "options-pod", WithConfig(config))
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned without ports")
+	}
+}
+
+func TestForwardWithOptionsWithoutValidConfigPath(t *testing.T) {
+	// Act
+	_, err := ForwardWithOptions("default", "any-pod", WithPorts(PortMapping{Remote: 8080}), WithKubeconfig("foo/bar", ""))
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when a not valid config path is provided")
+	}
+}
+
+func TestUnregisterForwardingOnlyClosesOwnChannel(t *testing.T) {
+	// Arrange
+	oldCh, newCh := make(chan struct{}), make(chan struct{})
+	namespace := "test_namespace"
+	pod := "replaced_pod"
+	registerForwarding(namespace, pod, oldCh)
+	registerForwarding(namespace, pod, newCh)
+
+	// Act
+	unregistered := unregisterForwarding(namespace, pod, oldCh)
+
+	// Assert
+	if unregistered {
+		t.Errorf("Replaced forwarding should not be unregistered")
+	}
+
+	select {
+	case <-newCh:
+		t.Errorf("Channel of the newer forwarding should not be closed")
+	default:
+		// Success
+	}
+
+	StopForwarding(namespace, pod)
+}
+
+func TestForwardWithIDKeepsOtherForwards(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "shared-pod")
+
+	firstID, first, err := ForwardWithID(context.Background(), config, "default", "shared-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "shared-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	secondID, second, err := ForwardWithID(context.Background(), config, "default", "shared-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if firstID == secondID {
+		t.Errorf("Expected different IDs but got %s twice", firstID)
+	}
+
+	assertEcho(t, first[0].Local)
+	assertEcho(t, second[0].Local)
+}
+
+func TestStopByID(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stopped-by-id-pod")
+
+	firstID, first, err := ForwardWithID(context.Background(), config, "default", "stopped-by-id-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "stopped-by-id-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	secondID, second, err := ForwardWithID(context.Background(), config, "default", "stopped-by-id-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	stopped := StopByID(firstID)
+
+	// Assert
+	if !stopped {
+		t.Fatalf("Forward %s should be stopped", firstID)
+	}
+
+	if !waitForClosedPort(first[0].Local) {
+		t.Errorf("Port %d should be closed", first[0].Local)
+	}
+
+	assertEcho(t, second[0].Local)
+
+	var ids []string
+	for _, info := range ListActiveForwards() {
+		if info.Target == "stopped-by-id-pod" {
+			ids = append(ids, info.ID)
+		}
+	}
+	if len(ids) != 1 || ids[0] != secondID {
+		t.Errorf("Expected only %s to be listed but got %v", secondID, ids)
+	}
+
+	if StopByID(firstID) {
+		t.Errorf("Stopped forward %s should not be stopped again", firstID)
+	}
+}
+
+func TestStopForwardingAndWait(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stop-wait-pod")
+
+	ports, err := ForwardWithContext(context.Background(), config, "default", "stop-wait-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	assertEchoRoundTrip(t, conn)
+
+	// Act
+	StopForwardingAndWait("default", "stop-wait-pod")
+
+	// Assert
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+	if err != nil {
+		t.Fatalf("Port %d should be free after stopping: %v", ports[0].Local, err)
+	}
+	listener.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the local connection to be closed but got %v", err)
+	}
+
+	if IsActive("default", "stop-wait-pod") {
+		t.Errorf("Forward should not be active after stopping")
+	}
+}
+
+func TestStopByIDAndWait(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stop-id-wait-pod")
+
+	id, ports, err := ForwardWithID(context.Background(), config, "default", "stop-id-wait-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	stopped := StopByIDAndWait(id)
+
+	// Assert
+	if !stopped {
+		t.Fatalf("Forward %s should be stopped", id)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+	if err != nil {
+		t.Fatalf("Port %d should be free after stopping: %v", ports[0].Local, err)
+	}
+	listener.Close()
+
+	if StopByIDAndWait(id) {
+		t.Errorf("Stopped forward %s should not be stopped again", id)
+	}
+}
+
+func TestPortForwardURL(t *testing.T) {
+	tests := []struct {
+		host       string
+		withoutTLS bool
+		expected   string
+	}{
+		{"https://10.0.0.1:6443", false, "https://10.0.0.1:6443/api/v1/namespaces/ns/pods/pod/portforward"},
+		{"https://hostname.example.com", false, "https://hostname.example.com/api/v1/namespaces/ns/pods/pod/portforward"},
+		{"https://rancher.example.com/k8s/clusters/c-1/", false, "https://rancher.example.com/k8s/clusters/c-1/api/v1/namespaces/ns/pods/pod/portforward"},
+		{"http://localhost:8001", false, "http://localhost:8001/api/v1/namespaces/ns/pods/pod/portforward"},
+		{"localhost:8080", true, "http://localhost:8080/api/v1/namespaces/ns/pods/pod/portforward"},
+	}
+
+	for _, test := range tests {
+		// Arrange
+		config := &rest.Config{Host: test.host}
+		if !test.withoutTLS {
+			config.TLSClientConfig.CAData = []byte("ca")
+		}
+
+		// Act
+		serverURL, err := portForwardURL(config, "ns", "pod")
+
+		// Assert
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.host, err)
+			continue
+		}
+
+		if serverURL.String() != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, serverURL.String())
+		}
+	}
+}
+
+func TestForwardWithConfigOnEphemeralPort(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "echo-pod")
+
+	// Act
+	localPort, err := ForwardWithConfig(config, "default", "echo-pod", 0, 8080)
+	defer StopForwarding("default", "echo-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if localPort == 0 {
+		t.Fatalf("Expected the bound local port to be returned")
+	}
+
+	assertEcho(t, localPort)
+}
+
+// assertEcho sends a message through the forwarded port and expects it back.
+func assertEcho(t *testing.T, localPort int) {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", localPort), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Could not connect to the forwarded port: %v", err)
+	}
+
+	assertEchoConn(t, conn)
+}
+
+// assertEchoConn checks that data sent over the connection is echoed and
+// closes it.
+func assertEchoConn(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+
+	assertEchoRoundTrip(t, conn)
+}
+
+// assertEchoRoundTrip checks that data sent over the connection is echoed
+// and keeps it open.
+func assertEchoRoundTrip(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Could not write to the forwarded port: %v", err)
+	}
+
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("Could not read from the forwarded port: %v", err)
+	}
+
+	if string(reply) != "ping" {
+		t.Errorf("Expected echo of ping but got %q", reply)
+	}
+}
+
+func TestForwardWithConfigOnAddress(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "address-pod")
+
+	// Act
+	localPort, err := ForwardWithConfig(config, "default", "address-pod", 0, 8080, WithAddress("127.0.0.1"))
+	defer StopForwarding("default", "address-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, localPort)
+
+	if conn, err := net.Dial("tcp", fmt.Sprintf("[::1]:%d", localPort)); err == nil {
+		conn.Close()
+		t.Errorf("Port should only be bound on 127.0.0.1")
+	}
+}
+
+func TestForwardOnSeveralAddresses(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "addresses-pod")
+
+	// Act
+	localPort, err := ForwardWithConfig(server.config, "default", "addresses-pod", 0, 8080, WithAddress("127.0.0.1", "127.0.0.2"))
+	defer StopForwarding("default", "addresses-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, host := range []string{"127.0.0.1", "127.0.0.2"} {
+		conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(localPort)))
+		if err != nil {
+			t.Fatalf("Port should be bound on %s: %v", host, err)
+		}
+		assertEchoConn(t, conn)
+	}
+
+	if server.dialCount() != 1 {
+		t.Errorf("Expected the addresses to share one connection but got %d", server.dialCount())
+	}
+}
+
+func TestForwardPorts(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "multi-pod")
+	ports := []PortMapping{{Local: 0, Remote: 8080}, {Local: 0, Remote: 9090}}
+
+	// Act
+	bound, err := ForwardPorts(config, "default", "multi-pod", ports)
+	defer StopForwarding("default", "multi-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(bound) != 2 || bound[0].Remote != 8080 || bound[1].Remote != 9090 {
+		t.Fatalf("Unexpected port mappings %v", bound)
+	}
+
+	for _, port := range bound {
+		assertEcho(t, port.Local)
+	}
+}
+
+func TestForwardSelector(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "selected-pod", "other-pod")
+	ports := []PortMapping{{Local: 0, Remote: 8080}}
+
+	// Act
+	bound, err := ForwardSelector(config, "default", "app=selected-pod", ports)
+	defer StopForwarding("default", "selector/app=selected-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, bound[0].Local)
+}
+
+func TestForwardSelectorWithInvalidSelector(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	_, err := ForwardSelector(config, "default", "app in (", []PortMapping{{Local: 0, Remote: 8080}})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for an invalid selector")
+	}
+}
+
+func TestForwardWithContextStopsOnCancel(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "context-pod")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bound, err := ForwardWithContext(ctx, config, "default", "context-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, bound[0].Local)
+
+	// Act
+	cancel()
+
+	// Assert
+	if !waitForClosedPort(bound[0].Local) {
+		t.Errorf("Listener should be closed after cancelling the context")
+	}
+}
+
+func TestForwardAndWaitReturnsAfterStop(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "waiting-pod")
+
+	returned := make(chan error, 1)
+	go func() {
+		returned <- ForwardAndWait(context.Background(), config, "default", "waiting-pod", []PortMapping{{Remote: 8080}})
+	}()
+
+	if !waitFor(5*time.Second, func() bool { return IsActive("default", "waiting-pod") }) {
+		t.Fatalf("Forward should be active")
+	}
+
+	// Act
+	StopForwarding("default", "waiting-pod")
+
+	// Assert
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Errorf("Stopped forward should not return an error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ForwardAndWait should return after stopping")
+	}
+}
+
+func TestForwardAndWaitReturnsLostConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "waiting-lost-pod")
+
+	returned := make(chan error, 1)
+	go func() {
+		returned <- ForwardAndWait(context.Background(), server.config, "default", "waiting-lost-pod", []PortMapping{{Remote: 8080}}, WithErrorHandler(func(error) {}))
+	}()
+	defer StopForwarding("default", "waiting-lost-pod")
+
+	if !waitFor(5*time.Second, func() bool { return IsActive("default", "waiting-lost-pod") }) {
+		t.Fatalf("Forward should be active")
+	}
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	select {
+	case err := <-returned:
+		if err == nil {
+			t.Errorf("Error should be returned for a lost connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ForwardAndWait should return after the connection was lost")
+	}
+}
+
+func TestForwardAndWaitReturnsSetupError(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	err := ForwardAndWait(context.Background(), config, "default", "missing-waiting-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if !errors.Is(err, ErrPodNotFound) {
+		t.Errorf("Expected ErrPodNotFound but got %v", err)
+	}
+}
+
+func TestForwardWithCancelledContext(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "cancelled-pod")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	_, err := ForwardWithContext(ctx, config, "default", "cancelled-pod", []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for a cancelled context")
+	}
+}
+
+func TestForwardWithReadyTimeout(t *testing.T) {
+	// Arrange
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never upgrades the connection.
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	config := &Config{
+		restConfig: &rest.Config{Host: server.URL},
+		clientset:  fake.NewSimpleClientset(newTestPod("slow-pod", nil, true, time.Now())),
+	}
+
+	// Act
+	start := time.Now()
+	_, err := ForwardWithConfig(config, "default", "slow-pod", 0, 8080, WithReadyTimeout(100*time.Millisecond))
+	defer StopForwarding("default", "slow-pod")
+
+	// Assert
+	if !errors.Is(err, ErrNotReady) {
+		t.Fatalf("Expected ErrNotReady when the forward is not ready in time but got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Forward should fail after the timeout but took %s", elapsed)
+	}
+}
+
+func TestForwardAllPorts(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	pod := newTestPod("all-ports-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{ContainerPort: 8080}, {ContainerPort: 9090}}}}
+	if _, err := config.clientset.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	ports, err := ForwardAllPorts(context.Background(), config, "default", "all-ports-pod", true)
+	defer StopForwarding("default", "all-ports-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(ports) != 2 || ports[0].Remote != 8080 || ports[1].Remote != 9090 {
+		t.Fatalf("Expected the declared ports but got %v", ports)
+	}
+
+	for _, port := range ports {
+		assertEcho(t, port.Local)
+	}
+}
+
+func TestForwardAllPortsWithoutPorts(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "portless-pod")
+
+	// Act
+	_, err := ForwardAllPorts(context.Background(), config, "default", "portless-pod", true)
+
+	// Assert
+	if err == nil {
+		StopForwarding("default", "portless-pod")
+		t.Errorf("Error should be returned for a pod without ports")
+	}
+}
+
+func TestForwardAllPortsOfService(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	ctx := context.Background()
+
+	pod := newTestPod("all-ports-svc-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}}}
+
+	service := newTestService("all-ports-svc")
+	service.Spec.Ports = []corev1.ServicePort{
+		{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+		{Name: "admin", Port: 9000},
+		{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+	}
+
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "all-ports-svc-abc",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "all-ports-svc"},
+		},
+		Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.1"}, TargetRef: podRef("all-ports-svc-pod")}},
+	}
+
+	clientset := config.clientset
+	_, _ = clientset.CoreV1().Pods("default").Create(ctx, pod, metav1.CreateOptions{})
+	_, _ = clientset.CoreV1().Services("default").Create(ctx, service, metav1.CreateOptions{})
+	_, _ = clientset.DiscoveryV1().EndpointSlices("default").Create(ctx, slice, metav1.CreateOptions{})
+
+	// Act
+	ports, err := ForwardAllPorts(ctx, config, "default", "svc/all-ports-svc", true)
+	defer StopForwarding("default", "svc/all-ports-svc")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(ports) != 2 || ports[0].Remote != 8080 || ports[1].Remote != 9000 {
+		t.Fatalf("Expected the target ports 8080 and 9000 but got %v", ports)
+	}
+
+	assertEcho(t, ports[0].Local)
+}
@@ -0,0 +1,194 @@
+package portforward
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ===== Port resolution =====
+
+/*
+Like kubectl the remote port of a service target is a port of the service and
+is translated to the target port of the selected pod. Named ports are looked
+up in the service or in the container ports of the pod.
+*/
+
+// ParsePortMapping parses a mapping like "8080:80", "8080:http" or "http".
+// Without a local port a numeric remote port is bound locally as well and a
+// named port binds an ephemeral port. A local path like "/tmp/db.sock:5432"
+// listens on a Unix socket, `\\.\pipe\db:5432` on a Windows named pipe.
+func ParsePortMapping(spec string) (PortMapping, error) {
+	local, remote := "", spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		local, remote = spec[:i], spec[i+1:]
+	}
+
+	if remote == "" {
+		return PortMapping{}, fmt.Errorf("invalid port mapping %q", spec)
+	}
+
+	mapping := PortMapping{}
+	if port, err := strconv.Atoi(remote); err == nil {
+		mapping.Remote = port
+		mapping.Local = port
+	} else {
+		mapping.RemoteName = remote
+	}
+
+	if strings.Contains(local, "/") || isNamedPipe(local) {
+		mapping.Local = 0
+		mapping.LocalSocket = local
+	} else if local != "" {
+		port, err := strconv.Atoi(local)
+		if err != nil {
+			return PortMapping{}, fmt.Errorf("invalid local port in %q: %w", spec, err)
+		}
+		mapping.Local = port
+	}
+
+	return mapping, nil
+}
+
+// resolvePorts translates the remote ports to numeric ports of the pod.
+func resolvePorts(target resolvedTarget, ports []PortMapping) ([]PortMapping, error) {
+	resolved := make([]PortMapping, 0, len(ports))
+
+	for _, port := range ports {
+		remote, err := resolveRemotePort(target, port)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved = append(resolved, PortMapping{Local: port.Local, Remote: remote})
+	}
+
+	return resolved, nil
+}
+
+func resolveRemotePort(target resolvedTarget, port PortMapping) (int, error) {
+	if target.service != nil {
+		return serviceTargetPort(target.service, target.pod, port)
+	}
+
+	if port.RemoteName != "" {
+		return containerPort(target.pod, port.RemoteName)
+	}
+
+	return port.Remote, nil
+}
+
+// serviceTargetPort returns the pod port behind a port of the service.
+func serviceTargetPort(service *corev1.Service, pod *corev1.Pod, port PortMapping) (int, error) {
+	for _, servicePort := range service.Spec.Ports {
+		if port.RemoteName != "" && servicePort.Name != port.RemoteName {
+			continue
+		}
+		if port.RemoteName == "" && int(servicePort.Port) != port.Remote {
+			continue
+		}
+
+		targetPort := servicePort.TargetPort
+		if targetPort.Type == intstr.String {
+			return containerPort(pod, targetPort.StrVal)
+		}
+
+		if targetPort.IntValue() == 0 {
+			// Defaults to the port of the service.
+			return int(servicePort.Port), nil
+		}
+
+		return targetPort.IntValue(), nil
+	}
+
+	return 0, fmt.Errorf("service %s has no port %s", service.Name, port.remoteString())
+}
+
+// containerPort returns the number of a named port of the containers.
+func containerPort(pod *corev1.Pod, name string) (int, error) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return int(port.ContainerPort), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("pod %s has no port named %s", pod.Name, name)
+}
+
+// undeclaredPorts returns the remote ports that no container of the pod
+// declares. Declaring ports is optional, so pods without any declared port
+// have no undeclared ports.
+func undeclaredPorts(pod *corev1.Pod, remotes []PortMapping) []int {
+	declared := map[int]bool{}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if isTCP(port.Protocol) {
+				declared[int(port.ContainerPort)] = true
+			}
+		}
+	}
+
+	if len(declared) == 0 {
+		return nil
+	}
+
+	var missing []int
+	for _, remote := range remotes {
+		if !declared[remote.Remote] {
+			missing = append(missing, remote.Remote)
+		}
+	}
+
+	return missing
+}
+
+// declaredPorts returns a mapping for every TCP port of the service, or of the
+// containers of the pod for other targets. Service ports are translated to
+// their target ports like any other remote port of a service.
+func declaredPorts(target resolvedTarget, ephemeral bool) []PortMapping {
+	var ports []PortMapping
+	seen := map[int]bool{}
+
+	if target.service != nil {
+		for _, port := range target.service.Spec.Ports {
+			if isTCP(port.Protocol) {
+				ports = append(ports, localMapping(int(port.Port), ephemeral))
+			}
+		}
+
+		return ports
+	}
+
+	for _, container := range target.pod.Spec.Containers {
+		for _, port := range container.Ports {
+			remote := int(port.ContainerPort)
+			if !isTCP(port.Protocol) || seen[remote] {
+				continue
+			}
+			seen[remote] = true
+
+			ports = append(ports, localMapping(remote, ephemeral))
+		}
+	}
+
+	return ports
+}
+
+// localMapping maps the remote port to the same local or an ephemeral port.
+func localMapping(remote int, ephemeral bool) PortMapping {
+	if ephemeral {
+		return PortMapping{Remote: remote}
+	}
+
+	return PortMapping{Local: remote, Remote: remote}
+}
+
+// isTCP reports whether the protocol can be forwarded, it defaults to TCP.
+func isTCP(protocol corev1.Protocol) bool {
+	return protocol == "" || protocol == corev1.ProtocolTCP
+}
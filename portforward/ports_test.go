@@ -0,0 +1,174 @@
+package portforward
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newPortsPod creates a pod with the named container ports http=8080 and metrics=9090.
+func newPortsPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "web", Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}},
+			{Name: "exporter", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}}},
+		}},
+	}
+}
+
+func TestParsePortMapping(t *testing.T) {
+	cases := map[string]PortMapping{
+		"8080:80":           {Local: 8080, Remote: 80},
+		"80":                {Local: 80, Remote: 80},
+		"8080:http":         {Local: 8080, RemoteName: "http"},
+		"http":              {RemoteName: "http"},
+		"0:http":            {RemoteName: "http"},
+		"/tmp/db.sock:5432": {LocalSocket: "/tmp/db.sock", Remote: 5432},
+		`\\.\pipe\db:5432`:  {LocalSocket: `\\.\pipe\db`, Remote: 5432},
+	}
+
+	for spec, expected := range cases {
+		// Act
+		mapping, err := ParsePortMapping(spec)
+
+		// Assert
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", spec, err)
+		} else if mapping != expected {
+			t.Errorf("Expected %+v for %s but got %+v", expected, spec, mapping)
+		}
+	}
+}
+
+func TestParsePortMappingWithInvalidSpec(t *testing.T) {
+	for _, spec := range []string{"", "8080:", "web:80"} {
+		// Act
+		_, err := ParsePortMapping(spec)
+
+		// Assert
+		if err == nil {
+			t.Errorf("Error should be returned for %q", spec)
+		}
+	}
+}
+
+func TestResolvePortsOfPod(t *testing.T) {
+	// Arrange
+	target := resolvedTarget{pod: newPortsPod()}
+	ports := []PortMapping{{Local: 1, RemoteName: "metrics"}, {Local: 2, Remote: 5432}}
+
+	// Act
+	resolved, err := resolvePorts(target, ports)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resolved[0] != (PortMapping{Local: 1, Remote: 9090}) || resolved[1] != (PortMapping{Local: 2, Remote: 5432}) {
+		t.Errorf("Unexpected ports %v", resolved)
+	}
+}
+
+func TestResolvePortsOfPodWithUnknownName(t *testing.T) {
+	// Arrange
+	target := resolvedTarget{pod: newPortsPod()}
+
+	// Act
+	_, err := resolvePorts(target, []PortMapping{{RemoteName: "grpc"}})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for an unknown port name")
+	}
+}
+
+func TestResolvePortsOfService(t *testing.T) {
+	// Arrange
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "web", Port: 80, TargetPort: intstr.FromString("http")},
+			{Name: "metrics", Port: 9000, TargetPort: intstr.FromInt(9090)},
+			{Name: "plain", Port: 7000},
+		}},
+	}
+	target := resolvedTarget{pod: newPortsPod(), service: service}
+	ports := []PortMapping{{Local: 1, Remote: 80}, {Local: 2, RemoteName: "metrics"}, {Local: 3, Remote: 7000}}
+
+	// Act
+	resolved, err := resolvePorts(target, ports)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []PortMapping{{Local: 1, Remote: 8080}, {Local: 2, Remote: 9090}, {Local: 3, Remote: 7000}}
+	for i := range expected {
+		if resolved[i] != expected[i] {
+			t.Errorf("Expected %v but got %v", expected[i], resolved[i])
+		}
+	}
+}
+
+func TestResolvePortsOfServiceWithUnknownPort(t *testing.T) {
+	// Arrange
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	target := resolvedTarget{pod: newPortsPod(), service: service}
+
+	// Act
+	_, err := resolvePorts(target, []PortMapping{{Remote: 8080}})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for a port that the service does not expose")
+	}
+}
+
+func TestDeclaredPorts(t *testing.T) {
+	// Arrange
+	pod := newPortsPod()
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "sidecar", Ports: []corev1.ContainerPort{
+		{ContainerPort: 8080},
+		{ContainerPort: 53, Protocol: corev1.ProtocolUDP},
+	}})
+
+	// Act
+	ports := declaredPorts(resolvedTarget{pod: pod}, false)
+	ephemeral := declaredPorts(resolvedTarget{pod: pod}, true)
+
+	// Assert
+	expected := []PortMapping{{Local: 8080, Remote: 8080}, {Local: 9090, Remote: 9090}}
+	if len(ports) != len(expected) || ports[0] != expected[0] || ports[1] != expected[1] {
+		t.Errorf("Expected %v but got %v", expected, ports)
+	}
+
+	if len(ephemeral) != 2 || ephemeral[0] != (PortMapping{Remote: 8080}) || ephemeral[1] != (PortMapping{Remote: 9090}) {
+		t.Errorf("Expected ephemeral local ports but got %v", ephemeral)
+	}
+}
+
+func TestUndeclaredPorts(t *testing.T) {
+	// Act
+	missing := undeclaredPorts(newPortsPod(), []PortMapping{{Remote: 8080}, {Remote: 5432}, {Remote: 9090}})
+
+	// Assert
+	if len(missing) != 1 || missing[0] != 5432 {
+		t.Errorf("Expected the undeclared port 5432 but got %v", missing)
+	}
+}
+
+func TestUndeclaredPortsOfPodWithoutPorts(t *testing.T) {
+	// Act
+	missing := undeclaredPorts(newTestPod("web-1", nil, true, time.Now()), []PortMapping{{Remote: 5432}})
+
+	// Assert
+	if len(missing) != 0 {
+		t.Errorf("Expected no undeclared ports but got %v", missing)
+	}
+}
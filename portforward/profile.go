@@ -0,0 +1,214 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ===== Profiles =====
+
+/*
+Scripts start the same forwards again and again, a profile names the bundle
+of target, ports, kubeconfig context and options. Profiles are registered in
+code or loaded from a YAML or JSON file like
+
+	profiles:
+	- name: db
+	  namespace: prod
+	  target: svc/postgres
+	  ports: ["15432:5432"]
+	  context: prod-cluster
+	  autoReconnect: true
+
+and started by name. A started profile is a registered forward of its target
+and is stopped like any other forward or by its name.
+*/
+
+// Profile is a named forward.
+type Profile struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	Target    string   `json:"target"`
+	Ports     []string `json:"ports"`
+	// Kubeconfig and Context select the cluster like LoadConfig.
+	Kubeconfig    string   `json:"kubeconfig,omitempty"`
+	Context       string   `json:"context,omitempty"`
+	Addresses     []string `json:"addresses,omitempty"`
+	AutoReconnect bool     `json:"autoReconnect,omitempty"`
+	// ReadyTimeout is a duration like "30s".
+	ReadyTimeout string `json:"readyTimeout,omitempty"`
+
+	// Options are added to the options of the profile, they can only be set
+	// in code.
+	Options []Option `json:"-"`
+}
+
+// profileFile is the content of a profile file.
+type profileFile struct {
+	Profiles []Profile `json:"profiles"`
+}
+
+var (
+	profiles = make(map[string]Profile)
+	// startedProfiles are the IDs of the forwards of the started profiles.
+	startedProfiles = make(map[string]string)
+	profilesMutex   sync.Mutex
+)
+
+// RegisterProfile adds the profile or replaces the profile of its name.
+func RegisterProfile(profile Profile) error {
+	if _, err := profile.options(); err != nil {
+		return err
+	}
+
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+
+	profiles[profile.Name] = profile
+	return nil
+}
+
+// LoadProfiles registers the profiles of a YAML or JSON file.
+func LoadProfiles(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading profiles: %w", err)
+	}
+
+	var file profileFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return fmt.Errorf("parsing profiles %s: %w", path, err)
+	}
+
+	for _, profile := range file.Profiles {
+		if err := RegisterProfile(profile); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// StartProfile starts the forward of the profile and returns the bound ports.
+func StartProfile(name string) ([]PortMapping, error) {
+	profilesMutex.Lock()
+	profile, ok := profiles[name]
+	profilesMutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+
+	opts, err := profile.options()
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	config := o.config
+	if config == nil {
+		if config, err = LoadConfig(o.configPath, o.kubeContext, o.configOptions...); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	namespace := profile.Namespace
+	if namespace == "" {
+		namespace = config.defaultNamespace()
+	}
+
+	// A profile that runs already is replaced, other forwards to the target
+	// keep running.
+	StopProfile(name)
+
+	id, ports, err := ForwardWithID(ctx, config, namespace, profile.Target, o.ports, append(opts, forgetOnStop(name))...)
+	if err != nil {
+		return nil, fmt.Errorf("starting profile %s: %w", name, err)
+	}
+
+	profilesMutex.Lock()
+	startedProfiles[name] = id
+	profilesMutex.Unlock()
+
+	return ports, nil
+}
+
+// StopProfile stops the forward of a started profile.
+func StopProfile(name string) {
+	profilesMutex.Lock()
+	id, ok := startedProfiles[name]
+	delete(startedProfiles, name)
+	profilesMutex.Unlock()
+
+	if ok {
+		StopByID(id)
+	}
+}
+
+// forgetOnStop removes the started profile when its forward ended by itself,
+// the stop callback of the profile is still called.
+func forgetOnStop(name string) Option {
+	return func(o *options) {
+		callback := o.onStopEvent
+		o.onStopEvent = func(event StopEvent) {
+			profilesMutex.Lock()
+			if startedProfiles[name] == event.ID {
+				delete(startedProfiles, name)
+			}
+			profilesMutex.Unlock()
+
+			if callback != nil {
+				callback(event)
+			}
+		}
+	}
+}
+
+// options translates the profile to forward options.
+func (p Profile) options() ([]Option, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("profile without name")
+	}
+	if p.Target == "" {
+		return nil, fmt.Errorf("profile %s has no target", p.Name)
+	}
+	if len(p.Ports) == 0 {
+		return nil, fmt.Errorf("profile %s has no ports", p.Name)
+	}
+
+	ports := make([]PortMapping, 0, len(p.Ports))
+	for _, spec := range p.Ports {
+		port, err := ParsePortMapping(spec)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		ports = append(ports, port)
+	}
+
+	opts := []Option{WithPorts(ports...), WithKubeconfig(p.Kubeconfig, p.Context)}
+	if len(p.Addresses) > 0 {
+		opts = append(opts, WithAddress(p.Addresses...))
+	}
+	if p.AutoReconnect {
+		opts = append(opts, WithAutoReconnect())
+	}
+	if p.ReadyTimeout != "" {
+		timeout, err := time.ParseDuration(p.ReadyTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: invalid ready timeout: %w", p.Name, err)
+		}
+		opts = append(opts, WithReadyTimeout(timeout))
+	}
+
+	return append(opts, p.Options...), nil
+}
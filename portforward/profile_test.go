@@ -0,0 +1,173 @@
+package portforward
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	content := `profiles:
+- name: loaded-db
+  namespace: prod
+  target: svc/postgres
+  ports: ["15432:5432"]
+  context: prod-cluster
+  autoReconnect: true
+  readyTimeout: 30s
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	err := LoadProfiles(path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	profilesMutex.Lock()
+	profile := profiles["loaded-db"]
+	profilesMutex.Unlock()
+
+	expected := Profile{
+		Name: "loaded-db", Namespace: "prod", Target: "svc/postgres", Ports: []string{"15432:5432"},
+		Context: "prod-cluster", AutoReconnect: true, ReadyTimeout: "30s",
+	}
+	if !reflect.DeepEqual(profile, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, profile)
+	}
+}
+
+func TestLoadProfilesWithInvalidProfile(t *testing.T) {
+	for _, content := range []string{
+		"profiles:\n- name: no-ports\n  target: svc/web\n",
+		"profiles:\n- name: bad-port\n  target: svc/web\n  ports: [\"x:80\"]\n",
+		"profiles:\n- name: typo\n  target: svc/web\n  prots: [\"80\"]\n",
+	} {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "profiles.yaml")
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Act
+		err := LoadProfiles(path)
+
+		// Assert
+		if err == nil {
+			t.Errorf("Error should be returned for %q", content)
+		}
+	}
+}
+
+func TestStartProfile(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "profile-pod")
+
+	err := RegisterProfile(Profile{Name: "web", Target: "profile-pod", Ports: []string{"0:8080"}, Options: []Option{WithConfig(config)}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	ports, err := StartProfile("web")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !IsActive("default", "profile-pod") {
+		t.Errorf("Profile should be registered as a forward of its target")
+	}
+
+	assertEcho(t, ports[0].Local)
+
+	StopProfile("web")
+	if !waitForClosedPort(ports[0].Local) {
+		t.Errorf("Port should be closed after stopping the profile")
+	}
+}
+
+func TestStartUnknownProfile(t *testing.T) {
+	// Act
+	_, err := StartProfile("unknown")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for an unknown profile")
+	}
+}
+
+func TestStopProfileKeepsOtherForwards(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "shared-profile-pod")
+
+	err := RegisterProfile(Profile{Name: "shared", Target: "shared-profile-pod", Ports: []string{"0:8080"}, Options: []Option{WithConfig(config)}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id, other, err := ForwardWithID(context.Background(), config, "default", "shared-profile-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer StopByID(id)
+
+	ports, err := StartProfile("shared")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	StopProfile("shared")
+
+	// Assert
+	if !waitForClosedPort(ports[0].Local) {
+		t.Errorf("Port of the profile should be closed")
+	}
+
+	assertEcho(t, other[0].Local)
+}
+
+func TestProfileIsForgottenWhenItsForwardEnds(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "ending-profile-pod")
+	stopped := make(chan StopEvent, 1)
+
+	err := RegisterProfile(Profile{Name: "ending", Target: "ending-profile-pod", Ports: []string{"0:8080"},
+		Options: []Option{WithConfig(server.config), WithOnStopEvent(func(event StopEvent) { stopped <- event })}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := StartProfile("ending"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Forward of the profile did not end")
+	}
+
+	profilesMutex.Lock()
+	_, started := startedProfiles["ending"]
+	profilesMutex.Unlock()
+
+	if started {
+		t.Errorf("Ended profile should not be tracked as started")
+	}
+}
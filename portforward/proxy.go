@@ -0,0 +1,206 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Cluster proxies =====
+
+/*
+A proxy gives tools a single local endpoint for the whole cluster instead of
+one forward per service. The clients name the service by its cluster DNS
+name, every proxied connection dials its own stream to a ready pod of the
+service:
+
+    web.shop.svc.cluster.local:80  ->  svc/web in the namespace shop
+    web.shop.svc:80, web.shop:80   ->  svc/web in the namespace shop
+    web:80                         ->  svc/web in the namespace of the config
+    db-0.db.shop.svc:5432          ->  pod db-0 of a StatefulSet in shop
+
+The proxy protocols only differ in the handshake that names the target.
+*/
+
+const (
+	// clusterDomain is the DNS suffix of the cluster that is removed from hosts.
+	clusterDomain = "cluster.local"
+	// proxyHandshakeTimeout bounds the handshake of a proxy client.
+	proxyHandshakeTimeout = 10 * time.Second
+)
+
+// ProxyOption customizes a proxy.
+type ProxyOption func(*proxyOptions)
+
+type proxyOptions struct {
+	errorHandler func(error)
+}
+
+// WithProxyErrorHandler receives the errors of the proxied connections, by
+// default they are logged.
+func WithProxyErrorHandler(handler func(error)) ProxyOption {
+	return func(o *proxyOptions) {
+		o.errorHandler = handler
+	}
+}
+
+// Proxy is a running proxy into the cluster.
+type Proxy struct {
+	config   *Config
+	listener net.Listener
+	options  proxyOptions
+	// handshake reads the target of a client connection and answers it.
+	handshake func(p *Proxy, client net.Conn) (net.Conn, error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+// startProxy listens on the address and serves the clients with the handshake.
+func startProxy(ctx context.Context, config *Config, address string, handshake func(*Proxy, net.Conn) (net.Conn, error), opts []ProxyOption) (*Proxy, error) {
+	options := proxyOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", address, err)
+	}
+
+	proxyCtx, cancel := context.WithCancel(ctx)
+	p := &Proxy{
+		config:    config,
+		listener:  listener,
+		options:   options,
+		handshake: handshake,
+		ctx:       proxyCtx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	go p.accept()
+
+	go func() {
+		<-p.ctx.Done()
+		listener.Close()
+		p.wg.Wait()
+		close(p.done)
+	}()
+
+	return p, nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// Stop closes the proxy and all proxied connections. It returns when they
+// were closed.
+func (p *Proxy) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Done is closed when the proxy stopped.
+func (p *Proxy) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *Proxy) accept() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			// Closed by stopping the proxy.
+			return
+		}
+
+		p.wg.Add(1)
+		go p.serve(client)
+	}
+}
+
+// serve does the handshake of the client and relays its connection.
+func (p *Proxy) serve(client net.Conn) {
+	defer p.wg.Done()
+	defer client.Close()
+
+	upstream, err := p.handshake(p, client)
+	if err != nil {
+		p.reportError(err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+	case <-p.ctx.Done():
+	}
+}
+
+// dial opens a connection to the port of the service or pod named by the host.
+func (p *Proxy) dial(host string, port int) (net.Conn, error) {
+	namespace, target, err := clusterTarget(host, p.config.defaultNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.config.DialPod(p.ctx, namespace, target, port)
+	if err != nil {
+		return nil, fmt.Errorf("proxying to %s:%d: %w", host, port, err)
+	}
+
+	return conn, nil
+}
+
+func (p *Proxy) reportError(err error) {
+	if p.options.errorHandler != nil {
+		p.options.errorHandler(err)
+		return
+	}
+
+	errorLogger.Printf("[proxy %s] %v", p.listener.Addr(), err)
+}
+
+// clusterTarget translates the cluster DNS name of a service or a StatefulSet
+// pod to the namespace and the target.
+func clusterTarget(host, defaultNamespace string) (string, string, error) {
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	name = strings.TrimSuffix(name, "."+clusterDomain)
+
+	parts := strings.Split(name, ".")
+	if parts[len(parts)-1] == "svc" {
+		parts = parts[:len(parts)-1]
+	}
+
+	switch {
+	case net.ParseIP(host) != nil:
+		return "", "", fmt.Errorf("proxying to IP %s: %w", host, ErrUnknownHost)
+	case len(parts) == 1 && parts[0] != "":
+		return defaultNamespace, "svc/" + parts[0], nil
+	case len(parts) == 2:
+		return parts[1], "svc/" + parts[0], nil
+	case len(parts) == 3 && strings.HasSuffix(name, ".svc"):
+		// The pod of a StatefulSet behind its headless service.
+		return parts[2], parts[0], nil
+	default:
+		return "", "", fmt.Errorf("proxying to %s: %w", host, ErrUnknownHost)
+	}
+}
@@ -0,0 +1,105 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newProxyCluster returns a fake API server with the service web on port 80
+// in front of the pod web-pod.
+func newProxyCluster(t *testing.T) *fakeAPIServer {
+	t.Helper()
+
+	server := startFakeAPIServer(t)
+	ctx := context.Background()
+
+	service := newTestService("web")
+	service.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)}}
+
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abc",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+		},
+		Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.1"}, TargetRef: podRef("web-pod")}},
+	}
+
+	clientset := server.config.clientset
+	_, _ = clientset.CoreV1().Pods("default").Create(ctx, newTestPod("web-pod", nil, true, time.Now()), metav1.CreateOptions{})
+	_, _ = clientset.CoreV1().Services("default").Create(ctx, service, metav1.CreateOptions{})
+	_, _ = clientset.DiscoveryV1().EndpointSlices("default").Create(ctx, slice, metav1.CreateOptions{})
+
+	return server
+}
+
+func TestProxyStop(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeSOCKS5(context.Background(), server.config, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	proxy.Stop()
+
+	// Assert
+	select {
+	case <-proxy.Done():
+	default:
+		t.Errorf("Proxy should be done after Stop")
+	}
+
+	if !waitForClosedPort(proxy.Addr().(*net.TCPAddr).Port) {
+		t.Errorf("Proxy port should be closed")
+	}
+}
+
+func TestClusterTarget(t *testing.T) {
+	cases := []struct {
+		host, namespace, target string
+	}{
+		{"web", "dev", "svc/web"},
+		{"web.shop", "shop", "svc/web"},
+		{"web.shop.svc", "shop", "svc/web"},
+		{"Web.Shop.svc.cluster.local.", "shop", "svc/web"},
+		{"db-0.db.shop.svc.cluster.local", "shop", "db-0"},
+	}
+
+	for _, c := range cases {
+		// Act
+		namespace, target, err := clusterTarget(c.host, "dev")
+
+		// Assert
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", c.host, err)
+			continue
+		}
+
+		if namespace != c.namespace || target != c.target {
+			t.Errorf("Expected %s/%s for %q but got %s/%s", c.namespace, c.target, c.host, namespace, target)
+		}
+	}
+}
+
+func TestClusterTargetWithUnknownHost(t *testing.T) {
+	for _, host := range []string{"", "10.0.0.1", "::1", "a.b.c", "example.com.org.net"} {
+		// Act
+		_, _, err := clusterTarget(host, "dev")
+
+		// Assert
+		if !errors.Is(err, ErrUnknownHost) {
+			t.Errorf("Expected ErrUnknownHost for %q but got %v", host, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+)
+
+// ===== Racing pods =====
+
+/*
+A flaky node or kubelet fails the setup of a forward although other ready pods
+of the service could serve it. A racing forward connects to the pod picked by
+the strategy first and starts the next candidate when the attempt failed or
+did not finish within raceDelay, like happy eyeballs does for addresses. The
+first connection wins and the others are closed, so a healthy pinned pod
+keeps winning.
+*/
+
+// raceDelay is the head start of an attempt before the next candidate is
+// tried.
+const raceDelay = 250 * time.Millisecond
+
+// WithPodRace connects to up to the given number of ready pods of a service or
+// workload when the forward connects and keeps the first connection.
+func WithPodRace(candidates int) Option {
+	return func(o *options) {
+		o.podRace = candidates
+	}
+}
+
+// racePods connects to the first of the candidates of the target that
+// answers.
+func (t *tunnel) racePods(parent context.Context, target string) (httpstream.Connection, *corev1.Pod, []PortMapping, error) {
+	restConfig, clientset := t.config.client()
+
+	ctx, cancel := t.config.requestContextFrom(parent)
+	candidates, err := resolveTargets(ctx, clientset, t.namespace, target)
+	cancel()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	winner, pod, err := t.raceCandidates(parent, restConfig, target, raceOrder(candidates, t.picker(target), t.options.podRace))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return winner.conn, pod, winner.remotes, nil
+}
+
+// raceOrder returns up to limit candidates, the picked candidate first.
+func raceOrder(candidates []resolvedTarget, pick podPicker, limit int) []resolvedTarget {
+	picked := pick(candidates)
+
+	ordered := []resolvedTarget{picked}
+	for _, candidate := range candidates {
+		if len(ordered) >= limit {
+			break
+		}
+		if candidate.pod.Name != picked.pod.Name {
+			ordered = append(ordered, candidate)
+		}
+	}
+
+	return ordered
+}
+
+// raceCandidates connects to the candidates in order, the next one starts
+// when the attempts so far failed or got their head start.
+func (t *tunnel) raceCandidates(parent context.Context, restConfig *rest.Config, target string, candidates []resolvedTarget) (backend, *corev1.Pod, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	type result struct {
+		backend backend
+		pod     *corev1.Pod
+		err     error
+	}
+	results := make(chan result, len(candidates))
+
+	next, pending := 0, 0
+	var headStart <-chan time.Time
+	startNext := func() {
+		if next == len(candidates) {
+			headStart = nil
+			return
+		}
+
+		candidate := candidates[next]
+		go func() {
+			connected, err := t.connectBackend(ctx, restConfig, candidate)
+			results <- result{backend: connected, pod: candidate.pod, err: err}
+		}()
+		next, pending = next+1, pending+1
+		headStart = time.After(raceDelay)
+	}
+
+	var errs []error
+	startNext()
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Closes the connections of the losers that still succeed.
+				go func(losers int) {
+					for i := 0; i < losers; i++ {
+						if lost := <-results; lost.err == nil {
+							lost.backend.conn.Close()
+						}
+					}
+				}(pending)
+				return r.backend, r.pod, nil
+			}
+			errs = append(errs, fmt.Errorf("pod %s: %w", r.pod.Name, r.err))
+			startNext()
+		case <-headStart:
+			startNext()
+		}
+	}
+
+	if len(errs) == 1 {
+		return backend{}, nil, errs[0]
+	}
+
+	return backend{}, nil, fmt.Errorf("none of %d pods of %s/%s could be connected: %w", len(errs), t.namespace, target, utilerrors.NewAggregate(errs))
+}
@@ -0,0 +1,122 @@
+package portforward
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newRaceCluster returns a fake API server with the ready pods race-new and
+// race-old of the selector app=race, race-new is picked first.
+func newRaceCluster(t *testing.T) *fakeAPIServer {
+	t.Helper()
+
+	server := startFakeAPIServer(t)
+	pods := server.config.clientset.CoreV1().Pods("default")
+	for _, pod := range []string{"race-new", "race-old"} {
+		created := time.Now()
+		if pod == "race-old" {
+			created = created.Add(-time.Hour)
+		}
+		if _, err := pods.Create(context.Background(), newTestPod(pod, map[string]string{"app": "race"}, true, created), metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	return server
+}
+
+func TestForwardWithPodRaceSkipsStalledPod(t *testing.T) {
+	// Arrange
+	server := newRaceCluster(t)
+	server.stalledPods["race-new"] = true
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "selector/app=race", []PortMapping{{Remote: 8080}}, WithPodRace(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Act
+	err = forwarder.waitReady()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pod := forwarder.Pod().Name; pod != "race-old" {
+		t.Errorf("Expected the pod race-old but got %s", pod)
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestForwardWithPodRaceKeepsPickedPod(t *testing.T) {
+	// Arrange
+	server := newRaceCluster(t)
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "selector/app=race", []PortMapping{{Remote: 8080}}, WithPodRace(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Act
+	err = forwarder.waitReady()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pod := forwarder.Pod().Name; pod != "race-new" {
+		t.Errorf("Expected the picked pod race-new but got %s", pod)
+	}
+}
+
+func TestForwardWithPodRaceFailsForAllPods(t *testing.T) {
+	// Arrange
+	server := newRaceCluster(t)
+	server.failedPods["race-new"] = true
+	server.failedPods["race-old"] = true
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "selector/app=race", []PortMapping{{Remote: 8080}}, WithPodRace(3))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Act
+	err = forwarder.waitReady()
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned when no pod could be connected")
+	}
+
+	if !strings.Contains(err.Error(), "race-new") || !strings.Contains(err.Error(), "race-old") {
+		t.Errorf("Expected the errors of both pods but got %v", err)
+	}
+}
+
+func TestRaceOrder(t *testing.T) {
+	// Arrange
+	candidates := []resolvedTarget{
+		{pod: newTestPod("pod-a", nil, true, time.Now())},
+		{pod: newTestPod("pod-b", nil, true, time.Now())},
+		{pod: newTestPod("pod-c", nil, true, time.Now())},
+	}
+	pickB := func(candidates []resolvedTarget) resolvedTarget { return candidates[1] }
+
+	// Act
+	ordered := raceOrder(candidates, pickB, 2)
+
+	// Assert
+	if len(ordered) != 2 || ordered[0].pod.Name != "pod-b" || ordered[1].pod.Name != "pod-a" {
+		t.Errorf("Expected pod-b and pod-a but got %v", ordered)
+	}
+}
@@ -0,0 +1,225 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ===== Relays to hosts =====
+
+/*
+Some hosts are only reachable from inside the cluster, e.g. a ClusterIP, the
+DNS name of a headless service or a database in the network of the cluster.
+A temporary relay pod connects to them with socat and the forward goes to the
+relay. The relay pod is deleted when the forward ended. The relay must be
+ready within the ready timeout of the forward, a relay that cannot start,
+e.g. because its image cannot be pulled, fails the forward right away.
+*/
+
+// ForwardToHost forwards the local ports to the remote ports of a host that
+// is reachable from the namespace through a temporary relay pod. It returns
+// when the relay is ready, the relay pod is deleted when the forward ended.
+func ForwardToHost(ctx context.Context, config *Config, namespace, host string, ports []PortMapping, opts ...Option) (*Forwarder, error) {
+	if net.ParseIP(host) == nil && len(validation.IsDNS1123Subdomain(host)) > 0 {
+		return nil, fmt.Errorf("invalid host %q", host)
+	}
+
+	if namespace == "" {
+		namespace = config.defaultNamespace()
+	}
+
+	remotes := make([]int, 0, len(ports))
+	for _, port := range ports {
+		if port.RemoteName != "" || port.Remote <= 0 {
+			return nil, fmt.Errorf("port %s of a host must be a number", port.remoteString())
+		}
+		remotes = append(remotes, port.Remote)
+	}
+
+	name := "pytogo-relay-" + utilrand.String(5)
+	options := newOptions(opts)
+	pod := relayPod(namespace, name, options.relayImage, hostRelayCommand(host, remotes), map[string]string{relayLabel: name}, remotes)
+
+	_, clientset := config.client()
+
+	requestCtx, cancel := config.requestContextFrom(ctx)
+	_, err := clientset.CoreV1().Pods(namespace).Create(requestCtx, pod, metav1.CreateOptions{})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("creating relay pod: %w", err)
+	}
+
+	forwarder, err := forwardToRelay(ctx, config, namespace, name, ports, opts)
+	if err != nil {
+		_ = deletePod(config, namespace, name)
+		return nil, err
+	}
+
+	go func() {
+		<-forwarder.done
+		if err := deletePod(config, namespace, name); err != nil {
+			forwarder.tunnel.reportError(err)
+		}
+	}()
+
+	return forwarder, nil
+}
+
+func forwardToRelay(ctx context.Context, config *Config, namespace, name string, ports []PortMapping, opts []Option) (*Forwarder, error) {
+	if err := waitForPod(ctx, config, namespace, name, newOptions(opts).readyTimeout); err != nil {
+		return nil, err
+	}
+
+	forwarder, err := NewForwarder(ctx, config, namespace, name, ports, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := forwarder.waitReady(); err != nil {
+		return nil, err
+	}
+
+	return forwarder, nil
+}
+
+// WithHostRelayImage runs the relay pods of ForwardToHost with another image,
+// it needs sh and socat.
+func WithHostRelayImage(image string) Option {
+	return func(o *options) {
+		o.relayImage = image
+	}
+}
+
+// hostRelayCommand relays every port of the relay pod to the same port of
+// the host.
+func hostRelayCommand(host string, ports []int) string {
+	if strings.Contains(host, ":") {
+		// socat expects IPv6 addresses in brackets.
+		host = "[" + host + "]"
+	}
+
+	commands := make([]string, 0, len(ports)+1)
+	for _, port := range ports {
+		commands = append(commands, fmt.Sprintf("socat TCP-LISTEN:%d,fork,reuseaddr TCP:%s:%d &", port, host, port))
+	}
+
+	return strings.Join(append(commands, "wait"), "\n")
+}
+
+// relayPod returns a pod that runs the shell command in the relay image.
+func relayPod(namespace, name, image, command string, labels map[string]string, ports []int) *corev1.Pod {
+	containerPorts := make([]corev1.ContainerPort, 0, len(ports))
+	for _, port := range ports {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: int32(port)})
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "relay",
+				Image:   image,
+				Command: []string{"sh", "-c", command},
+				Ports:   containerPorts,
+			}},
+		},
+	}
+}
+
+// waitForPod polls the relay pod until it is ready. Like the connection to a
+// pod the wait is limited by the ready timeout, zero means two minutes and a
+// negative timeout waits until the context is done.
+func waitForPod(ctx context.Context, config *Config, namespace, name string, readyTimeout time.Duration) error {
+	_, clientset := config.client()
+
+	timeout := readyTimeout
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	waitCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for {
+		requestCtx, cancel := config.requestContextFrom(waitCtx)
+		pod, err := clientset.CoreV1().Pods(namespace).Get(requestCtx, name, metav1.GetOptions{})
+		cancel()
+
+		if err == nil && isPodReady(pod) {
+			return nil
+		}
+		if err == nil {
+			if reason := podStartFailure(pod); reason != "" {
+				return fmt.Errorf("relay pod %s/%s cannot start: %s", namespace, name, reason)
+			}
+		}
+
+		if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return fmt.Errorf("relay pod %s/%s was not ready within %s: %w", namespace, name, timeout, withKind(ErrNotReady, waitCtx.Err()))
+		}
+		if err != nil {
+			return fmt.Errorf("waiting for relay pod: %w", err)
+		}
+
+		select {
+		case <-waitCtx.Done():
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// podStartFailure returns why the pod will not become ready, e.g. an image
+// that cannot be pulled or a crashing container. It is empty while the pod
+// is still starting.
+func podStartFailure(pod *corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+		return fmt.Sprintf("pod is %s", strings.ToLower(string(pod.Status.Phase)))
+	}
+
+	statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		waiting := status.State.Waiting
+		if waiting == nil {
+			continue
+		}
+
+		switch waiting.Reason {
+		case "ErrImagePull", "ImagePullBackOff", "ErrImageNeverPull", "InvalidImageName",
+			"CrashLoopBackOff", "CreateContainerConfigError", "CreateContainerError", "RunContainerError":
+			if waiting.Message == "" {
+				return fmt.Sprintf("container %s is waiting: %s", status.Name, waiting.Reason)
+			}
+			return fmt.Sprintf("container %s is waiting: %s: %s", status.Name, waiting.Reason, waiting.Message)
+		}
+	}
+
+	return ""
+}
+
+// deletePod deletes the relay pod, a pod that is already gone is fine.
+func deletePod(config *Config, namespace, name string) error {
+	_, clientset := config.client()
+
+	ctx, cancel := config.requestContext()
+	defer cancel()
+
+	err := clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting relay pod %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
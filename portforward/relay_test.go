@@ -0,0 +1,122 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestForwardToHost(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	readyRelays(t, server.config)
+
+	// Act
+	forwarder, err := ForwardToHost(context.Background(), server.config, "default", "db.internal.example.com", []PortMapping{{Remote: 5432}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	pod := forwarder.tunnel.podName()
+	relay, err := server.config.clientset.CoreV1().Pods("default").Get(context.Background(), pod, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if command := relay.Spec.Containers[0].Command[2]; command != hostRelayCommand("db.internal.example.com", []int{5432}) {
+		t.Errorf("Unexpected relay command %q", command)
+	}
+
+	forwarder.Stop()
+
+	deleted := waitFor(5*time.Second, func() bool {
+		_, err := server.config.clientset.CoreV1().Pods("default").Get(context.Background(), pod, metav1.GetOptions{})
+		return apierrors.IsNotFound(err)
+	})
+	if !deleted {
+		t.Errorf("Relay pod should be deleted after stopping")
+	}
+}
+
+func TestForwardToHostWithUnpullableImage(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	updateRelays(t, server.config, func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "relay",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+		}}
+	})
+
+	// Act
+	_, err := ForwardToHost(context.Background(), server.config, "default", "db.internal.example.com", []PortMapping{{Remote: 5432}})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "ImagePullBackOff") {
+		t.Errorf("Expected an error about ImagePullBackOff but got %v", err)
+	}
+
+	assertNoRelayPods(t, server.config)
+}
+
+func TestForwardToHostWithReadyTimeout(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+
+	// Act
+	_, err := ForwardToHost(context.Background(), server.config, "default", "db.internal.example.com", []PortMapping{{Remote: 5432}}, WithReadyTimeout(200*time.Millisecond))
+
+	// Assert
+	if !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected ErrNotReady but got %v", err)
+	}
+
+	assertNoRelayPods(t, server.config)
+}
+
+// assertNoRelayPods checks that all relay pods were deleted.
+func assertNoRelayPods(t *testing.T, config *Config) {
+	t.Helper()
+
+	pods, err := config.clientset.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{LabelSelector: relayLabel})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected the relay pod to be deleted but got %d pods", len(pods.Items))
+	}
+}
+
+func TestForwardToHostWithInvalidHost(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	for _, host := range []string{"db; rm -rf /", "", "Upper_Case"} {
+		// Act
+		_, err := ForwardToHost(context.Background(), config, "default", host, []PortMapping{{Remote: 5432}})
+
+		// Assert
+		if err == nil {
+			t.Errorf("Error should be returned for host %q", host)
+		}
+	}
+}
+
+func TestHostRelayCommand(t *testing.T) {
+	// Act
+	command := hostRelayCommand("fd00::1", []int{80, 443})
+
+	// Assert
+	expected := "socat TCP-LISTEN:80,fork,reuseaddr TCP:[fd00::1]:80 &\nsocat TCP-LISTEN:443,fork,reuseaddr TCP:[fd00::1]:443 &\nwait"
+	if command != expected {
+		t.Errorf("Expected %q but got %q", expected, command)
+	}
+}
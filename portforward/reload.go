@@ -0,0 +1,153 @@
+package portforward
+
+import (
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// ===== Kubeconfig hot-reload =====
+
+/*
+Tokens in kubeconfigs are often refreshed by external tools and contexts
+get rotated while forwards are running. Instead of fsnotify, the files are
+polled which also works for files that are replaced instead of written.
+*/
+
+// watcher keeps track of the forwards that have to be re-established.
+type watcher struct {
+	reloadMutex sync.Mutex
+	subscribers map[chan struct{}]func()
+	stopWatch   chan struct{}
+}
+
+// WithReload polls the kubeconfig files in the given interval and reloads
+// the config when they change. Active forwards are re-established with
+// the new config, their open local connections end on the old connection.
+func WithReload(interval time.Duration) ConfigOption {
+	return func(o *configOptions) {
+		o.reloadInterval = interval
+	}
+}
+
+// Close stops watching the kubeconfig files. Active forwards keep running.
+func (c *Config) Close() {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+
+	if c.stopWatch != nil {
+		close(c.stopWatch)
+		c.stopWatch = nil
+	}
+}
+
+// onReload registers a function that is called once when the config changed
+// and the forward of stopCh is still running.
+func (c *Config) onReload(stopCh chan struct{}, fn func()) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+
+	select {
+	case <-stopCh:
+		// Stopped while reloading, offReload already ran.
+		return
+	default:
+	}
+
+	if c.subscribers == nil {
+		c.subscribers = make(map[chan struct{}]func())
+	}
+
+	c.subscribers[stopCh] = fn
+}
+
+// offReload removes the function of the stopped forward of stopCh, so the
+// config does not keep the forward.
+func (c *Config) offReload(stopCh chan struct{}) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+
+	delete(c.subscribers, stopCh)
+}
+
+func (c *Config) startWatching(interval time.Duration) {
+	c.reloadMutex.Lock()
+	stopWatch := make(chan struct{})
+	c.stopWatch = stopWatch
+	c.reloadMutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := c.filesDigest()
+
+		for {
+			select {
+			case <-stopWatch:
+				return
+			case <-ticker.C:
+			}
+
+			digest := c.filesDigest()
+			if digest == last {
+				continue
+			}
+
+			last = digest
+			c.reload()
+		}
+	}()
+}
+
+// reload loads the config again and notifies the forwards when it changed.
+func (c *Config) reload() {
+	// A broken kubeconfig (e.g. while being written) keeps the old config.
+	changed, err := c.load()
+	if err != nil || !changed {
+		return
+	}
+
+	c.reloadMutex.Lock()
+	subscribers := c.subscribers
+	c.subscribers = nil
+	c.reloadMutex.Unlock()
+
+	for stopCh, fn := range subscribers {
+		select {
+		case <-stopCh:
+			// Forward was already stopped.
+		default:
+			go fn()
+		}
+	}
+}
+
+// filesDigest hashes the content of all files of the config source.
+func (c *Config) filesDigest() [sha256.Size]byte {
+	hash := sha256.New()
+
+	for _, path := range c.source.files() {
+		// Missing files are part of the state as well.
+		content, _ := os.ReadFile(path)
+		hash.Write([]byte(path))
+		hash.Write(content)
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], hash.Sum(nil))
+
+	return digest
+}
+
+// sameConfig compares two loaded configs while ignoring runtime state.
+func sameConfig(a, b *rest.Config) bool {
+	a, b = rest.CopyConfig(a), rest.CopyConfig(b)
+	a.AuthConfigPersister, b.AuthConfigPersister = nil, nil
+
+	return reflect.DeepEqual(a, b)
+}
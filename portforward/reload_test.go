@@ -0,0 +1,201 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadNotifiesForwardsWhenConfigChanged(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	config, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	called := make(chan struct{})
+	config.onReload(make(chan struct{}), func() { close(called) })
+
+	changed := strings.Replace(testKubeconfig, "https://dev.example.com:6443", "https://dev2.example.com:6443", 1)
+	if err := os.WriteFile(path, []byte(changed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	config.reload()
+
+	// Assert
+	select {
+	case <-called:
+		// Success
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Forward was not notified about the changed config")
+	}
+
+	if restConfig, _ := config.client(); restConfig.Host != "https://dev2.example.com:6443" {
+		t.Errorf("Config was not reloaded, host is %s", restConfig.Host)
+	}
+}
+
+func TestReloadSkipsUnchangedConfig(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	config, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	called := make(chan struct{})
+	config.onReload(make(chan struct{}), func() { close(called) })
+
+	// Act
+	config.reload()
+
+	// Assert
+	select {
+	case <-called:
+		t.Errorf("Forward should not be notified when the config did not change")
+	case <-time.After(100 * time.Millisecond):
+		// Success
+	}
+}
+
+func TestReloadSkipsStoppedForwards(t *testing.T) {
+	// Arrange
+	path := writeKubeconfig(t, testKubeconfig)
+
+	config, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	called := make(chan struct{})
+	config.onReload(stopCh, func() { close(called) })
+
+	changed := strings.Replace(testKubeconfig, "dev-token", "rotated-token", 1)
+	if err := os.WriteFile(path, []byte(changed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	config.reload()
+
+	// Assert
+	select {
+	case <-called:
+		t.Errorf("Stopped forwards should not be re-established")
+	case <-time.After(100 * time.Millisecond):
+		// Success
+	}
+}
+
+// subscriberCount returns the number of forwards that wait for a reload.
+func subscriberCount(config *Config) int {
+	config.reloadMutex.Lock()
+	defer config.reloadMutex.Unlock()
+
+	return len(config.subscribers)
+}
+
+func TestForwardWithoutReloadDoesNotSubscribe(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "unreloaded-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "unreloaded-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Act
+	err = forwarder.waitReady()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if count := subscriberCount(config); count != 0 {
+		t.Errorf("Expected no subscribers without reload but got %d", count)
+	}
+}
+
+func TestStoppedForwardUnsubscribesFromReload(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "reloaded-pod")
+	config.options.reloadInterval = time.Hour
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "reloaded-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count := subscriberCount(config); count != 1 {
+		t.Fatalf("Expected the forward to subscribe but got %d subscribers", count)
+	}
+
+	// Act
+	forwarder.Stop()
+
+	// Assert
+	if count := subscriberCount(config); count != 0 {
+		t.Errorf("Expected no subscribers after the stop but got %d", count)
+	}
+}
+
+func TestReloadKeepsOpenConnections(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "drained-pod")
+	server.config.options.reloadInterval = time.Hour
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "drained-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	held, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertEchoRoundTrip(t, held)
+
+	server.mutex.Lock()
+	old := server.conns[0]
+	server.mutex.Unlock()
+
+	// Act
+	forwarder.tunnel.reload()
+
+	// Assert
+	if dials := server.dialCount(); dials != 2 {
+		t.Fatalf("Expected a new connection after the reload but got %d dials", dials)
+	}
+
+	assertEchoRoundTrip(t, held)
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	held.Close()
+
+	select {
+	case <-old.CloseChan():
+		// Success
+	case <-time.After(5 * time.Second):
+		t.Errorf("Old connection should be closed with its last local connection")
+	}
+}
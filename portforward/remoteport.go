@@ -0,0 +1,81 @@
+package portforward
+
+import "fmt"
+
+// ===== Changing remote ports =====
+
+/*
+A debugged process may restart on another port. Changing the remote port of a
+mapping keeps its local listener bound, so local clients keep their address,
+and dials a new connection to the pod that forwards to the new port. The open
+local connections of the old connection are closed. The old port is kept when
+the new connection fails.
+*/
+
+// SetRemotePort forwards the bound local port to another remote port of the
+// pod.
+func (f *Forwarder) SetRemotePort(local, remote int) error {
+	index, err := f.tunnel.setRemotePort(local, remote)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if index < len(f.ports) {
+		f.ports[index].Remote = remote
+	}
+
+	return nil
+}
+
+// SetRemotePortForwarding changes the remote port of the registered forward
+// like SetRemotePort.
+func SetRemotePortForwarding(namespace, target string, local, remote int) error {
+	forwarder, err := registeredForwarder(namespace, target)
+	if err != nil {
+		return err
+	}
+
+	return forwarder.SetRemotePort(local, remote)
+}
+
+// setRemotePort changes the mapping of the local port and reconnects, it
+// returns the index of the mapping.
+func (t *tunnel) setRemotePort(local, remote int) (int, error) {
+	t.mutex.Lock()
+	index := -1
+	for i, port := range t.ports {
+		if port.LocalSocket == "" && port.Local == local {
+			index = i
+		}
+	}
+	if index < 0 {
+		t.mutex.Unlock()
+		return 0, fmt.Errorf("no mapping of the local port %d", local)
+	}
+
+	oldRemote, oldName := t.ports[index].Remote, t.ports[index].RemoteName
+	t.ports[index].Remote, t.ports[index].RemoteName = remote, ""
+	t.mutex.Unlock()
+
+	if err := t.connect(t.ctx); err != nil {
+		t.mutex.Lock()
+		t.ports[index].Remote, t.ports[index].RemoteName = oldRemote, oldName
+		t.mutex.Unlock()
+
+		return 0, fmt.Errorf("changing the remote port of %d to %d: %w", local, remote, err)
+	}
+
+	t.logf(LogInfo, "forwarding %d to remote port %d", local, remote)
+	return index, nil
+}
+
+// requestedPorts returns the mappings the pod ports are resolved from.
+func (t *tunnel) requestedPorts() []PortMapping {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]PortMapping(nil), t.ports...)
+}
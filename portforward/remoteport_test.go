@@ -0,0 +1,199 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestForwarderSetRemotePort(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "remote-port-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "remote-port-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	local := forwarder.Ports()[0].Local
+	assertEcho(t, local)
+
+	// Act
+	err = forwarder.SetRemotePort(local, httpTestPort)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if ports := forwarder.Ports(); ports[0] != (PortMapping{Local: local, Remote: httpTestPort}) {
+		t.Errorf("Unexpected ports %v", ports)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	response, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	if string(body) != "ok" {
+		t.Errorf("Expected the HTTP port to answer but got %q", body)
+	}
+}
+
+func TestForwarderSetRemotePortOfUnknownLocalPort(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "unknown-local-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "unknown-local-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	err = forwarder.SetRemotePort(forwarder.Ports()[0].Local+1, httpTestPort)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for an unknown local port")
+	}
+}
+
+func TestForwarderSetRemotePortKeepsOldPortOnFailure(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	pod := newTestPod("declared-port-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "app", Ports: []corev1.ContainerPort{{ContainerPort: 8080}}}}
+	if _, err := config.clientset.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "declared-port-pod", []PortMapping{{Remote: 8080}}, WithStrictPorts())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	local := forwarder.Ports()[0].Local
+
+	// Act
+	err = forwarder.SetRemotePort(local, 9090)
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned for an undeclared port")
+	}
+
+	if ports := forwarder.Ports(); ports[0].Remote != 8080 {
+		t.Errorf("Expected the remote port 8080 to be kept but got %v", ports)
+	}
+
+	assertEcho(t, local)
+}
+
+func TestSetRemotePortForwarding(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "registered-remote-pod")
+
+	ports, err := ForwardWithContext(context.Background(), config, "default", "registered-remote-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "registered-remote-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	err = SetRemotePortForwarding("default", "registered-remote-pod", ports[0].Local, 8081)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	infos := ListActiveForwards()
+	for _, info := range infos {
+		if info.Target == "registered-remote-pod" && info.Ports[0].Remote != 8081 {
+			t.Errorf("Expected the remote port 8081 but got %v", info.Ports)
+		}
+	}
+
+	assertEcho(t, ports[0].Local)
+}
+
+func TestFailedSetRemotePortWithOpenConnections(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	pod := newTestPod("busy-declared-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "app", Ports: []corev1.ContainerPort{{ContainerPort: 8080}}}}
+	if _, err := config.clientset.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "busy-declared-pod", []PortMapping{{Remote: 8080}}, WithStrictPorts())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	local := forwarder.Ports()[0].Local
+
+	done := make(chan struct{})
+	var clients sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", local))
+				if err != nil {
+					continue
+				}
+				_, _ = conn.Write([]byte("ping"))
+				conn.Close()
+			}
+		}()
+	}
+
+	// Act
+	for forwarder.Metrics().Connections < 100 {
+		if err := forwarder.SetRemotePort(local, 9090); err == nil {
+			t.Fatalf("Error should be returned for an undeclared port")
+		}
+	}
+	close(done)
+	clients.Wait()
+
+	// Assert
+	if ports := forwarder.Ports(); ports[0].Local != local || ports[0].Remote != 8080 {
+		t.Errorf("Expected the mapping %d:8080 to be kept but got %v", local, ports)
+	}
+
+	assertEcho(t, local)
+}
@@ -0,0 +1,52 @@
+package portforward
+
+import "fmt"
+
+// ===== Retargeting =====
+
+/*
+Switching to another pod, e.g. from a canary to the stable deployment, would
+otherwise need a new forward and local clients would see refused connections
+in between. Retargeting keeps the local listeners and only replaces the
+connection to the pod, the open local connections of the old pod are closed.
+Later reconnects resolve the new target. A registered forward stays
+registered with its original target.
+*/
+
+// Retarget connects the forward to a pod of another target in its namespace,
+// e.g. "pod/web-2" or "deployment/web-canary". The forward keeps its old pod
+// when the new target cannot be connected.
+func (f *Forwarder) Retarget(target string) error {
+	return f.tunnel.retarget(target)
+}
+
+// RetargetForwarding retargets the registered forward like Retarget.
+func RetargetForwarding(namespace, target, newTarget string) error {
+	forwarder, err := registeredForwarder(namespace, target)
+	if err != nil {
+		return err
+	}
+
+	return forwarder.Retarget(newTarget)
+}
+
+func (t *tunnel) retarget(target string) error {
+	if err := t.connectTo(t.ctx, target, false); err != nil {
+		return fmt.Errorf("retargeting %s/%s to %s: %w", t.namespace, t.target, target, err)
+	}
+
+	t.logf(LogInfo, "retargeted to %s, pod %s", target, t.podName())
+	return nil
+}
+
+// currentTarget returns the target of the connection to the pod.
+func (t *tunnel) currentTarget() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.retargeted == "" {
+		return t.target
+	}
+
+	return t.retargeted
+}
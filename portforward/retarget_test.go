@@ -0,0 +1,93 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRetarget(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "old-pod", "new-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "old-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port := forwarder.Ports()[0].Local
+
+	// Act
+	err = forwarder.Retarget("pod/new-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, port)
+
+	if server.streamCount("new-pod") != 1 || server.streamCount("old-pod") != 0 {
+		t.Errorf("Expected the stream to go to new-pod but got %d to new-pod and %d to old-pod", server.streamCount("new-pod"), server.streamCount("old-pod"))
+	}
+
+	if forwarder.tunnel.podName() != "new-pod" {
+		t.Errorf("Expected the pod new-pod but got %s", forwarder.tunnel.podName())
+	}
+}
+
+func TestRetargetToMissingPod(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "kept-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "kept-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	err = forwarder.Retarget("missing-pod")
+
+	// Assert
+	if !errors.Is(err, ErrPodNotFound) {
+		t.Fatalf("Expected ErrPodNotFound but got %v", err)
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	if server.streamCount("kept-pod") != 1 {
+		t.Errorf("Expected the forward to keep its pod")
+	}
+}
+
+func TestRetargetForwarding(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "registered-old-pod", "registered-new-pod")
+
+	ports, err := ForwardPorts(server.config, "default", "registered-old-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer StopForwarding("default", "registered-old-pod")
+
+	// Act
+	err = RetargetForwarding("default", "registered-old-pod", "registered-new-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, ports[0].Local)
+
+	if server.streamCount("registered-new-pod") != 1 {
+		t.Errorf("Expected a stream to registered-new-pod")
+	}
+}
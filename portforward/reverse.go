@@ -0,0 +1,358 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ===== Reverse forwarding =====
+
+/*
+A reverse forward makes a local address reachable in the cluster. A relay pod
+and a service of the same name are created, in-cluster clients connect to the
+service. Port forwards only open connections from here to the cluster, so the
+relay pairs every in-cluster connection with a control connection that was
+opened to it beforehand:
+
+    client -> service -> relay pod <- control connection <- local address
+
+The relay writes one byte on an idle control connection when a client
+arrived, only then the local address is dialed. A pool of idle control
+connections is kept open. The relay pod and the service are deleted when the
+reverse forward stops.
+*/
+
+const (
+	// DefaultRelayImage provides sh and socat for the relay script.
+	DefaultRelayImage = "alpine/socat"
+
+	// relayControlPort is the port of the relay for the control connections.
+	relayControlPort = 51000
+	// relayReady is written by the relay when a client connected.
+	relayReady = 'R'
+	// relayLabel marks the relay pods and services.
+	relayLabel = "pytogo.io/relay"
+)
+
+// relayScript listens on the control port and lets every control connection
+// wait for one client on the service port with SO_REUSEPORT. The control
+// connection is passed to the client as fd 3. The nested commands are
+// written to files because socat splits its addresses at commas and colons.
+const relayScript = `cat > /tmp/pair.sh <<'END'
+printf %[3]c >&3
+exec socat FD:3 STDIO
+END
+cat > /tmp/wait.sh <<'END'
+exec 3<&0
+exec socat TCP-LISTEN:%[1]d,reuseaddr,reuseport EXEC:"sh /tmp/pair.sh"
+END
+exec socat TCP-LISTEN:%[2]d,fork,reuseaddr EXEC:"sh /tmp/wait.sh"`
+
+// ReverseOption customizes a reverse forward.
+type ReverseOption func(*reverseOptions)
+
+type reverseOptions struct {
+	image        string
+	poolSize     int
+	readyTimeout time.Duration
+	errorHandler func(error)
+}
+
+// WithRelayImage runs the relay with another image, it needs sh and socat.
+func WithRelayImage(image string) ReverseOption {
+	return func(o *reverseOptions) {
+		o.image = image
+	}
+}
+
+// WithRelayPoolSize sets how many clients can connect to the relay at once
+// before they wait for a new control connection. The default is 4.
+func WithRelayPoolSize(size int) ReverseOption {
+	return func(o *reverseOptions) {
+		o.poolSize = size
+	}
+}
+
+// WithReverseReadyTimeout fails the reverse forward when the relay pod is not
+// ready within the timeout. Without it the relay must be ready within two
+// minutes, a timeout of zero or less waits forever.
+func WithReverseReadyTimeout(timeout time.Duration) ReverseOption {
+	return func(o *reverseOptions) {
+		o.readyTimeout = timeout
+		if timeout <= 0 {
+			o.readyTimeout = -1
+		}
+	}
+}
+
+// WithReverseErrorHandler receives the errors of single connections and of
+// the control connections, by default they are logged.
+func WithReverseErrorHandler(handler func(error)) ReverseOption {
+	return func(o *reverseOptions) {
+		o.errorHandler = handler
+	}
+}
+
+// ReverseForwarder is a running reverse forward.
+type ReverseForwarder struct {
+	config       *Config
+	namespace    string
+	name         string
+	port         int
+	localAddress string
+	options      reverseOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+
+	// The relay objects that were created and are deleted again.
+	createdPod     bool
+	createdService bool
+}
+
+// ReverseForward creates the relay pod and service with the name and relays
+// the connections to the service port to the local address, e.g.
+// "localhost:3000". It returns when the relay is ready. Cancelling the
+// context stops the reverse forward like Stop.
+func ReverseForward(ctx context.Context, config *Config, namespace, name string, port int, localAddress string, opts ...ReverseOption) (*ReverseForwarder, error) {
+	if port <= 0 || port == relayControlPort {
+		return nil, fmt.Errorf("invalid relay port %d", port)
+	}
+
+	if namespace == "" {
+		namespace = config.defaultNamespace()
+	}
+
+	options := reverseOptions{image: DefaultRelayImage, poolSize: 4}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	forwarderCtx, cancel := context.WithCancel(ctx)
+	r := &ReverseForwarder{
+		config:       config,
+		namespace:    namespace,
+		name:         name,
+		port:         port,
+		localAddress: localAddress,
+		options:      options,
+		ctx:          forwarderCtx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+
+	if err := r.createRelay(); err != nil {
+		cancel()
+		r.deleteRelay()
+		return nil, err
+	}
+
+	for i := 0; i < options.poolSize; i++ {
+		r.wg.Add(1)
+		go r.serve()
+	}
+
+	go func() {
+		<-r.ctx.Done()
+		r.wg.Wait()
+		r.deleteRelay()
+		close(r.done)
+	}()
+
+	return r, nil
+}
+
+// Stop ends the reverse forward and deletes the relay. It returns when the
+// relay was deleted.
+func (r *ReverseForwarder) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Done is closed when the reverse forward stopped and the relay was deleted.
+func (r *ReverseForwarder) Done() <-chan struct{} {
+	return r.done
+}
+
+// Address returns the address of the relay service in the cluster.
+func (r *ReverseForwarder) Address() string {
+	return net.JoinHostPort(fmt.Sprintf("%s.%s.svc", r.name, r.namespace), strconv.Itoa(r.port))
+}
+
+// createRelay creates the relay pod and service and waits for the pod.
+func (r *ReverseForwarder) createRelay() error {
+	_, clientset := r.config.client()
+	labels := map[string]string{relayLabel: r.name}
+
+	command := fmt.Sprintf(relayScript, r.port, relayControlPort, relayReady)
+	pod := relayPod(r.namespace, r.name, r.options.image, command, labels, []int{r.port})
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: r.name, Namespace: r.namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports:    []corev1.ServicePort{{Name: "relay", Port: int32(r.port), TargetPort: intstr.FromInt(r.port)}},
+		},
+	}
+
+	ctx, cancel := r.config.requestContextFrom(r.ctx)
+	defer cancel()
+
+	if _, err := clientset.CoreV1().Pods(r.namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("creating relay pod: %w", err)
+	}
+	r.createdPod = true
+
+	if _, err := clientset.CoreV1().Services(r.namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("creating relay service: %w", err)
+	}
+	r.createdService = true
+
+	return waitForPod(r.ctx, r.config, r.namespace, r.name, r.options.readyTimeout)
+}
+
+// deleteRelay deletes the created relay pod and service, also after the
+// forward was cancelled. Existing objects of the same name are kept.
+func (r *ReverseForwarder) deleteRelay() {
+	_, clientset := r.config.client()
+
+	ctx, cancel := r.config.requestContext()
+	defer cancel()
+
+	if r.createdService {
+		err := clientset.CoreV1().Services(r.namespace).Delete(ctx, r.name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			r.reportError(fmt.Errorf("deleting relay service %s/%s: %w", r.namespace, r.name, err))
+		}
+	}
+
+	if r.createdPod {
+		if err := deletePod(r.config, r.namespace, r.name); err != nil {
+			r.reportError(err)
+		}
+	}
+}
+
+// serve keeps one control connection open until the forward is stopped.
+func (r *ReverseForwarder) serve() {
+	defer r.wg.Done()
+
+	backoff := reconnectBackoff
+
+	for r.ctx.Err() == nil {
+		control, err := r.awaitClient()
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+			r.reportError(fmt.Errorf("relay %s/%s: %w", r.namespace, r.name, err))
+
+			select {
+			case <-r.ctx.Done():
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			continue
+		}
+
+		backoff = reconnectBackoff
+		r.wg.Add(1)
+		go r.relay(control)
+	}
+}
+
+// awaitClient opens a control connection and waits until the relay reports
+// a client on it.
+func (r *ReverseForwarder) awaitClient() (net.Conn, error) {
+	control, err := r.config.DialPod(r.ctx, r.namespace, r.name, relayControlPort)
+	if err != nil {
+		return nil, err
+	}
+
+	// The read does not end with the context.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			control.Close()
+		case <-stop:
+		}
+	}()
+
+	marker := make([]byte, 1)
+	if _, err := io.ReadFull(control, marker); err != nil {
+		control.Close()
+		return nil, err
+	}
+
+	if marker[0] != relayReady {
+		control.Close()
+		return nil, fmt.Errorf("unexpected relay marker %q", marker)
+	}
+
+	return control, nil
+}
+
+// relay copies data between the client behind the control connection and the
+// local address. Stop waits until both copies ended.
+func (r *ReverseForwarder) relay(control net.Conn) {
+	defer r.wg.Done()
+	defer control.Close()
+
+	local, err := net.Dial("tcp", r.localAddress)
+	if err != nil {
+		r.reportError(fmt.Errorf("relay %s/%s: %w", r.namespace, r.name, err))
+		return
+	}
+	defer local.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(local, control)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(control, local)
+		done <- struct{}{}
+	}()
+
+	running := 2
+	select {
+	case <-done:
+		running--
+	case <-r.ctx.Done():
+	}
+
+	// Closing ends the other copy.
+	control.Close()
+	local.Close()
+	for ; running > 0; running-- {
+		<-done
+	}
+}
+
+func (r *ReverseForwarder) reportError(err error) {
+	if r.options.errorHandler != nil {
+		r.options.errorHandler(err)
+		return
+	}
+
+	errorLogger.Printf("[%s/%s] %v", r.namespace, r.name, err)
+}
@@ -0,0 +1,184 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// startEchoServer listens on a local port and echoes all connections.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buffer := make([]byte, 4)
+				n, _ := conn.Read(buffer)
+				_, _ = conn.Write(buffer[:n])
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// readyRelays marks the relay pods as ready like the kubelet until the test
+// ended.
+func readyRelays(t *testing.T, config *Config) {
+	t.Helper()
+
+	updateRelays(t, config, func(pod *corev1.Pod) {
+		pod.Status = newTestPod(pod.Name, nil, true, time.Now()).Status
+	})
+}
+
+// updateRelays sets the status of the relay pods that are not ready until
+// the test ended.
+func updateRelays(t *testing.T, config *Config, update func(pod *corev1.Pod)) {
+	t.Helper()
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		ctx := context.Background()
+		for {
+			pods, _ := config.clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{LabelSelector: relayLabel})
+			for i := range pods.Items {
+				pod := &pods.Items[i]
+				if !isPodReady(pod) {
+					update(pod)
+					_, _ = config.clientset.CoreV1().Pods("default").UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+				}
+			}
+
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+}
+
+func TestReverseForward(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	localAddress := startEchoServer(t)
+	readyRelays(t, server.config)
+
+	// Act
+	reverse, err := ReverseForward(context.Background(), server.config, "default", "dev-relay", 3000, localAddress, WithRelayPoolSize(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	select {
+	case reply := <-server.relayed:
+		if reply != "ping" {
+			t.Errorf("Expected ping from the local address but got %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Client of the relay was not relayed")
+	}
+
+	if address := reverse.Address(); address != "dev-relay.default.svc:3000" {
+		t.Errorf("Unexpected address %s", address)
+	}
+
+	service, err := server.config.clientset.CoreV1().Services("default").Get(context.Background(), "dev-relay", metav1.GetOptions{})
+	if err != nil || service.Spec.Selector[relayLabel] != "dev-relay" {
+		t.Errorf("Relay service should select the relay pod but got %v, %v", service, err)
+	}
+
+	reverse.Stop()
+
+	_, err = server.config.clientset.CoreV1().Pods("default").Get(context.Background(), "dev-relay", metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Relay pod should be deleted after stopping but got %v", err)
+	}
+	_, err = server.config.clientset.CoreV1().Services("default").Get(context.Background(), "dev-relay", metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Relay service should be deleted after stopping but got %v", err)
+	}
+}
+
+func TestReverseForwardKeepsExistingPod(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "taken")
+
+	// Act
+	_, err := ReverseForward(context.Background(), config, "default", "taken", 3000, "127.0.0.1:1")
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned for an existing pod")
+	}
+
+	if _, err := config.clientset.CoreV1().Pods("default").Get(context.Background(), "taken", metav1.GetOptions{}); err != nil {
+		t.Errorf("Existing pod should be kept but got %v", err)
+	}
+}
+
+func TestReverseForwardWithReadyTimeout(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	_, err := ReverseForward(context.Background(), config, "default", "slow-relay", 3000, "127.0.0.1:1", WithReverseReadyTimeout(200*time.Millisecond))
+
+	// Assert
+	if !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected ErrNotReady but got %v", err)
+	}
+
+	if _, err := config.clientset.CoreV1().Pods("default").Get(context.Background(), "slow-relay", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Relay pod should be deleted but got %v", err)
+	}
+	if _, err := config.clientset.CoreV1().Services("default").Get(context.Background(), "slow-relay", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Relay service should be deleted but got %v", err)
+	}
+}
+
+func TestRelayPod(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	readyRelays(t, server.config)
+
+	// Act
+	reverse, err := ReverseForward(context.Background(), server.config, "default", "spec-relay", 3000, "127.0.0.1:1", WithRelayImage("example/socat"), WithRelayPoolSize(0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reverse.Stop()
+
+	// Assert
+	pod, err := server.config.clientset.CoreV1().Pods("default").Get(context.Background(), "spec-relay", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	container := pod.Spec.Containers[0]
+	if container.Image != "example/socat" || container.Ports[0].ContainerPort != 3000 {
+		t.Errorf("Unexpected relay container %v", container)
+	}
+}
@@ -0,0 +1,97 @@
+package portforward
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ===== Following rollouts =====
+
+/*
+A rollout replaces the pods of a workload one by one. The pod of the forward
+is watched and the tunnel moves to another ready pod of the target as soon as
+the pod is terminating or no longer ready, before its connection breaks.
+Local clients only see their open connections closed. Pod targets have no
+other pod to move to and are not followed.
+*/
+
+// followsRollouts reports whether the forward moves between the pods of its
+// target.
+func (t *tunnel) followsRollouts() bool {
+	kind, _ := parseTarget(t.target)
+
+	return t.options.followRollouts && kind != "pod" && kind != "pods" && kind != "po"
+}
+
+// followRollouts watches the pod of the connection until the forward is
+// stopped and reconnects when the pod goes away.
+func (t *tunnel) followRollouts() {
+	for {
+		pod := t.podName()
+
+		leaving, err := t.watchPod(pod)
+		if err != nil {
+			t.reportError(fmt.Errorf("watching pod %s of %s/%s: %w", pod, t.namespace, t.target, err))
+		}
+
+		select {
+		case <-t.stopChan:
+			return
+		default:
+		}
+
+		if leaving && t.podName() == pod {
+			t.reconnect()
+		}
+	}
+}
+
+// watchPod blocks until the pod is terminating, not ready or deleted. It
+// returns false when the watch ended before.
+func (t *tunnel) watchPod(name string) (bool, error) {
+	_, clientset := t.config.client()
+
+	watcher, err := clientset.CoreV1().Pods(t.namespace).Watch(t.ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	})
+	if err != nil {
+		select {
+		case <-t.stopChan:
+		case <-time.After(reconnectBackoff):
+		}
+		return false, err
+	}
+	defer watcher.Stop()
+
+	// The pod may have changed before the watch started.
+	pod, err := clientset.CoreV1().Pods(t.namespace).Get(t.ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || err == nil && !isPodReady(pod) {
+		return true, nil
+	}
+
+	for {
+		select {
+		case <-t.stopChan:
+			return false, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+
+			pod, isPod := event.Object.(*corev1.Pod)
+			if !isPod || pod.Name != name {
+				continue
+			}
+
+			if event.Type == watch.Deleted || !isPodReady(pod) {
+				return true, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestForwardFollowsRollout(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	clientset := server.config.clientset
+	ctx := context.Background()
+	labels := map[string]string{"app": "rolling"}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "rolling", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+	_, _ = clientset.AppsV1().Deployments("default").Create(ctx, deployment, metav1.CreateOptions{})
+	_, _ = clientset.CoreV1().Pods("default").Create(ctx, newTestPod("rolling-old", labels, true, time.Now().Add(-time.Hour)), metav1.CreateOptions{})
+
+	forwarder, err := NewForwarder(ctx, server.config, "default", "deployment/rolling", []PortMapping{{Remote: 8080}}, WithFollowRollouts())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	_, _ = clientset.CoreV1().Pods("default").Create(ctx, newTestPod("rolling-new", labels, true, time.Now()), metav1.CreateOptions{})
+	_ = clientset.CoreV1().Pods("default").Delete(ctx, "rolling-old", metav1.DeleteOptions{})
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return forwarder.tunnel.podName() == "rolling-new" }) {
+		t.Fatalf("Forward should move to the new pod but is on %s", forwarder.tunnel.podName())
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestFollowsRolloutsIgnoresPods(t *testing.T) {
+	// Arrange
+	options := newOptions([]Option{WithFollowRollouts()})
+
+	// Act
+	podTunnel := newTunnel(context.Background(), nil, "default", "pod/web-1", nil, options)
+	deploymentTunnel := newTunnel(context.Background(), nil, "default", "deploy/web", nil, options)
+
+	// Assert
+	if podTunnel.followsRollouts() {
+		t.Errorf("Pod targets should not follow rollouts")
+	}
+	if !deploymentTunnel.followsRollouts() {
+		t.Errorf("Deployment targets should follow rollouts")
+	}
+}
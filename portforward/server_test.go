@@ -0,0 +1,421 @@
+package portforward
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// fakeAPIServer serves the portforward subresource like the kubelet and
+// echoes all data sent over the streams.
+type fakeAPIServer struct {
+	config *Config
+
+	mutex sync.Mutex
+	conns []httpstream.Connection
+	dials int
+	// websocket accepts SPDY tunneled through WebSockets like newer servers.
+	websocket      bool
+	websocketDials int
+	// generation counts broken connections, older connections reset streams.
+	generation int
+	// streams counts the data streams per pod.
+	streams map[string]int
+	// relayOnce sends a single client over the control connections of
+	// relays, the replies are delivered on relayed.
+	relayOnce sync.Once
+	relayed   chan string
+	// execCommands are the commands of the exec requests.
+	execCommands [][]string
+	// stalledPods never answer the upgrade, failedPods reject it.
+	stalledPods map[string]bool
+	failedPods  map[string]bool
+	// stalledStreams accept the connection but never answer its streams.
+	stalledStreams map[string]bool
+	// closed releases the requests of stalled pods.
+	closed chan struct{}
+}
+
+// newFakeAPIServer starts a fake API server with the pods and returns the
+// config to reach it. The pods are ready and labeled with app=<name>.
+func newFakeAPIServer(t *testing.T, pods ...string) *Config {
+	t.Helper()
+
+	return startFakeAPIServer(t, pods...).config
+}
+
+func startFakeAPIServer(t *testing.T, pods ...string) *fakeAPIServer {
+	t.Helper()
+
+	fakeServer := &fakeAPIServer{
+		streams:     map[string]int{},
+		relayed:     make(chan string, 1),
+		stalledPods: map[string]bool{},
+		failedPods:  map[string]bool{},
+		closed:      make(chan struct{}),
+
+		stalledStreams: map[string]bool{},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/exec") {
+			fakeServer.serveExec(w, r)
+			return
+		}
+
+		if !strings.HasSuffix(r.URL.Path, "/portforward") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if fakeServer.unreachable(w, r) {
+			return
+		}
+
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			fakeServer.serveWebSocket(w, r)
+			return
+		}
+
+		if _, err := httpstream.Handshake(r, w, []string{"portforward.k8s.io"}); err != nil {
+			return
+		}
+
+		conn := httpspdy.NewResponseUpgrader().UpgradeResponse(w, r, fakeServer.streamHandler(r))
+		if conn != nil {
+			fakeServer.track(conn)
+			<-conn.CloseChan()
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(fakeServer.closed) })
+
+	objects := make([]runtime.Object, 0, len(pods))
+	for _, pod := range pods {
+		objects = append(objects, newTestPod(pod, map[string]string{"app": pod}, true, time.Now()))
+	}
+
+	fakeServer.config = &Config{
+		restConfig: &rest.Config{Host: server.URL},
+		clientset:  fake.NewSimpleClientset(objects...),
+	}
+
+	return fakeServer
+}
+
+// unreachable answers the requests of stalled and failed pods, it reports
+// whether the request was answered.
+func (f *fakeAPIServer) unreachable(w http.ResponseWriter, r *http.Request) bool {
+	// The path ends with /pods/<pod>/portforward.
+	parts := strings.Split(r.URL.Path, "/")
+	pod := parts[len(parts)-2]
+
+	f.mutex.Lock()
+	stalled, failed := f.stalledPods[pod], f.failedPods[pod]
+	f.mutex.Unlock()
+
+	switch {
+	case stalled:
+		select {
+		case <-r.Context().Done():
+		case <-f.closed:
+		}
+	case failed:
+		http.Error(w, "kubelet is not reachable", http.StatusBadGateway)
+	}
+
+	return stalled || failed
+}
+
+// serveWebSocket accepts the SPDY protocol tunneled through a WebSocket or
+// rejects the upgrade like older servers.
+func (f *fakeAPIServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	enabled := f.websocket
+	f.mutex.Unlock()
+
+	if !enabled {
+		http.Error(w, "websockets are not supported", http.StatusBadRequest)
+		return
+	}
+
+	websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = []string{websocketProtocol}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+
+			conn, err := httpspdy.NewServerConnection(ws, f.streamHandler(r))
+			if err != nil {
+				return
+			}
+
+			f.mutex.Lock()
+			f.websocketDials++
+			f.mutex.Unlock()
+
+			f.track(conn)
+			<-conn.CloseChan()
+		},
+	}.ServeHTTP(w, r)
+}
+
+// streamHandler echoes the streams of the pod in the request until the
+// connection is broken.
+func (f *fakeAPIServer) streamHandler(r *http.Request) httpstream.NewStreamHandler {
+	// The path ends with /pods/<pod>/portforward.
+	parts := strings.Split(r.URL.Path, "/")
+	pod := parts[len(parts)-2]
+
+	f.mutex.Lock()
+	generation := f.generation
+	f.mutex.Unlock()
+
+	pairs := &streamPairs{}
+
+	return func(stream httpstream.Stream, replySent <-chan struct{}) error {
+		f.mutex.Lock()
+		broken := generation < f.generation
+		if !broken && stream.Headers().Get("streamType") == "data" {
+			f.streams[pod]++
+		}
+		stalled := f.stalledStreams[pod]
+		f.mutex.Unlock()
+
+		if stalled {
+			<-f.closed
+			return fmt.Errorf("server is closed")
+		}
+		if broken {
+			return fmt.Errorf("connection is broken")
+		}
+		if stream.Headers().Get("port") == strconv.Itoa(relayControlPort) && stream.Headers().Get("streamType") == "data" {
+			go f.relayClient(stream, replySent)
+			return nil
+		}
+		if stream.Headers().Get("port") == strconv.Itoa(httpTestPort) && stream.Headers().Get("streamType") == "data" {
+			go serveHTTPStream(stream)
+			return nil
+		}
+		return echoStreams(stream, replySent, pairs)
+	}
+}
+
+// relayClient acts like a client of the relay on the first control
+// connection, it sends ping and delivers the reply.
+func (f *fakeAPIServer) relayClient(stream httpstream.Stream, replySent <-chan struct{}) {
+	<-replySent
+
+	f.relayOnce.Do(func() {
+		_, _ = stream.Write([]byte{relayReady})
+		_, _ = stream.Write([]byte("ping"))
+
+		reply := make([]byte, 4)
+		_, _ = io.ReadFull(stream, reply)
+		stream.Close()
+
+		f.relayed <- string(reply)
+	})
+}
+
+// serveExec runs commands like the kubelet, stdin is echoed to stdout until
+// it is closed.
+func (f *fakeAPIServer) serveExec(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.execCommands = append(f.execCommands, r.URL.Query()["command"])
+	f.mutex.Unlock()
+
+	if _, err := httpstream.Handshake(r, w, []string{"v4.channel.k8s.io"}); err != nil {
+		return
+	}
+
+	var mutex sync.Mutex
+	streams := map[string]httpstream.Stream{}
+
+	conn := httpspdy.NewResponseUpgrader().UpgradeResponse(w, r, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		streams[stream.Headers().Get("streamType")] = stream
+		if len(streams) == 4 {
+			go runEcho(streams, replySent)
+		}
+		return nil
+	})
+	if conn != nil {
+		<-conn.CloseChan()
+	}
+}
+
+// runEcho echoes stdin to stdout and reports success on the error stream.
+func runEcho(streams map[string]httpstream.Stream, replySent <-chan struct{}) {
+	<-replySent
+
+	_, _ = io.Copy(streams["stdout"], streams["stdin"])
+	streams["stdout"].Close()
+	streams["stderr"].Close()
+
+	_, _ = streams["error"].Write([]byte(`{"metadata":{},"status":"Success"}`))
+	streams["error"].Close()
+}
+
+// streamCount returns how many data streams were opened to the pod.
+func (f *fakeAPIServer) streamCount(pod string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.streams[pod]
+}
+
+// breakConnections makes the open connections reset all new streams like a
+// connection that went stale without being closed.
+func (f *fakeAPIServer) breakConnections() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.generation++
+}
+
+// httpTestPort is the port of the pod that answers HTTP requests.
+const httpTestPort = 8088
+
+// serveHTTPStream answers the HTTP requests of a data stream with 404 for
+// /missing and 200 otherwise.
+func serveHTTPStream(stream httpstream.Stream) {
+	defer stream.Close()
+
+	reader := bufio.NewReader(stream)
+	for {
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, request.Body)
+
+		status := http.StatusOK
+		if request.URL.Path == "/missing" {
+			status = http.StatusNotFound
+		}
+
+		if _, err := fmt.Fprintf(stream, "HTTP/1.1 %d %s\r\nContent-Length: 2\r\n\r\nok", status, http.StatusText(status)); err != nil {
+			return
+		}
+	}
+}
+
+// streamPairs signals the end of the data streams to the error streams with
+// the same request ID.
+type streamPairs struct {
+	mutex sync.Mutex
+	done  map[string]chan struct{}
+}
+
+func (p *streamPairs) doneChan(stream httpstream.Stream) chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	id := stream.Headers().Get("requestID")
+	if p.done == nil {
+		p.done = map[string]chan struct{}{}
+	}
+	if _, ok := p.done[id]; !ok {
+		p.done[id] = make(chan struct{})
+	}
+
+	return p.done[id]
+}
+
+// echoStreams echoes all data sent over the data streams. The error streams
+// are closed without an error when their data stream ended, like the kubelet
+// does.
+func echoStreams(stream httpstream.Stream, replySent <-chan struct{}, pairs *streamPairs) error {
+	done := pairs.doneChan(stream)
+
+	if stream.Headers().Get("streamType") == "data" {
+		go func() {
+			_, _ = io.Copy(stream, stream)
+			stream.Close()
+			close(done)
+		}()
+		return nil
+	}
+
+	go func() {
+		<-replySent
+		<-done
+		stream.Close()
+	}()
+	return nil
+}
+
+// track records an open portforward connection.
+func (f *fakeAPIServer) track(conn httpstream.Connection) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.conns = append(f.conns, conn)
+	f.dials++
+}
+
+// dropConnections closes all open portforward connections like a restarting pod.
+func (f *fakeAPIServer) dropConnections() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+// dialCount returns how many portforward connections were opened.
+func (f *fakeAPIServer) dialCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.dials
+}
+
+// fakeConnection is a connection to a pod without streams.
+type fakeConnection struct {
+	closeOnce sync.Once
+	closed    chan bool
+}
+
+func newFakeConnection() *fakeConnection {
+	return &fakeConnection{closed: make(chan bool)}
+}
+
+func (c *fakeConnection) CreateStream(http.Header) (httpstream.Stream, error) {
+	return nil, fmt.Errorf("streams are not supported")
+}
+
+func (c *fakeConnection) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeConnection) CloseChan() <-chan bool {
+	return c.closed
+}
+
+func (c *fakeConnection) SetIdleTimeout(time.Duration) {}
+
+func (c *fakeConnection) RemoveStreams(...httpstream.Stream) {}
@@ -0,0 +1,171 @@
+package portforward
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ===== SOCKS5 proxy =====
+
+/*
+Most tools and browsers can connect through a SOCKS5 proxy. The proxy only
+implements CONNECT without authentication (RFC 1928), it listens on a local
+address and the clients must not be able to reach it from other machines.
+The hosts of the requests are resolved by the cluster names of the services,
+see proxy.go. Clients must pass the names to the proxy (socks5h), hosts
+resolved to IPs on the client side are rejected.
+*/
+
+const (
+	socksVersion = 0x05
+
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+
+	socksConnect = 0x01
+
+	socksIPv4   = 0x01
+	socksDomain = 0x03
+	socksIPv6   = 0x04
+
+	socksSucceeded          = 0x00
+	socksGeneralFailure     = 0x01
+	socksHostUnreachable    = 0x04
+	socksCommandUnsupported = 0x07
+	socksAddressUnsupported = 0x08
+)
+
+// ServeSOCKS5 runs a SOCKS5 proxy on the local address, e.g. "127.0.0.1:1080",
+// that dials the services and pods of the cluster on demand. The proxy stops
+// with the context or Stop.
+func ServeSOCKS5(ctx context.Context, config *Config, address string, opts ...ProxyOption) (*Proxy, error) {
+	return startProxy(ctx, config, address, socksHandshake, opts)
+}
+
+// socksHandshake negotiates the method and answers the CONNECT request of the
+// client with the connection to the pod.
+func socksHandshake(p *Proxy, client net.Conn) (net.Conn, error) {
+	if err := client.SetDeadline(time.Now().Add(proxyHandshakeTimeout)); err != nil {
+		return nil, err
+	}
+
+	// METHODS
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(client, header); err != nil {
+		return nil, fmt.Errorf("reading SOCKS methods: %w", err)
+	}
+	if header[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(client, methods); err != nil {
+		return nil, fmt.Errorf("reading SOCKS methods: %w", err)
+	}
+
+	if !containsByte(methods, socksNoAuth) {
+		_, _ = client.Write([]byte{socksVersion, socksNoAcceptable})
+		return nil, errors.New("SOCKS client does not support connecting without authentication")
+	}
+	if _, err := client.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return nil, err
+	}
+
+	// REQUEST
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(client, request); err != nil {
+		return nil, fmt.Errorf("reading SOCKS request: %w", err)
+	}
+	if request[1] != socksConnect {
+		socksReply(client, socksCommandUnsupported)
+		return nil, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	host, err := socksHost(client, request[3])
+	if err != nil {
+		socksReply(client, socksAddressUnsupported)
+		return nil, err
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(client, portBytes); err != nil {
+		return nil, fmt.Errorf("reading SOCKS request: %w", err)
+	}
+	port := int(binary.BigEndian.Uint16(portBytes))
+
+	// DIAL
+	upstream, err := p.dial(host, port)
+	if err != nil {
+		socksReply(client, socksReplyFor(err))
+		return nil, err
+	}
+
+	socksReply(client, socksSucceeded)
+	if err := client.SetDeadline(time.Time{}); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+
+	return upstream, nil
+}
+
+// socksHost reads the address of a request.
+func socksHost(client net.Conn, addressType byte) (string, error) {
+	var address []byte
+
+	switch addressType {
+	case socksIPv4:
+		address = make([]byte, net.IPv4len)
+	case socksIPv6:
+		address = make([]byte, net.IPv6len)
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(client, length); err != nil {
+			return "", fmt.Errorf("reading SOCKS request: %w", err)
+		}
+		address = make([]byte, length[0])
+	default:
+		return "", fmt.Errorf("unsupported SOCKS address type %d", addressType)
+	}
+
+	if _, err := io.ReadFull(client, address); err != nil {
+		return "", fmt.Errorf("reading SOCKS request: %w", err)
+	}
+
+	if addressType == socksDomain {
+		return string(address), nil
+	}
+	return net.IP(address).String(), nil
+}
+
+// socksReplyFor maps the error of dialing to the reply code.
+func socksReplyFor(err error) byte {
+	for _, kind := range []error{ErrUnknownHost, ErrPodNotFound, ErrServiceNotFound, ErrNoReadyPod} {
+		if errors.Is(err, kind) {
+			return socksHostUnreachable
+		}
+	}
+
+	return socksGeneralFailure
+}
+
+// socksReply answers a request. The bound address is not known and always
+// sent as 0.0.0.0:0.
+func socksReply(client net.Conn, code byte) {
+	_, _ = client.Write([]byte{socksVersion, code, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+func containsByte(values []byte, value byte) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package portforward
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// socksDial opens a connection through the proxy to the host.
+func socksDial(t *testing.T, proxy *Proxy, host string, port int) (net.Conn, byte) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if method[1] != 0 {
+		t.Fatalf("Expected no authentication but got method %d", method[1])
+	}
+
+	request := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, reply[1]
+}
+
+func TestSOCKS5ProxyToService(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeSOCKS5(context.Background(), server.config, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	// Act
+	conn, reply := socksDial(t, proxy, "web.default.svc.cluster.local", 80)
+	defer conn.Close()
+
+	// Assert
+	if reply != socksSucceeded {
+		t.Fatalf("Expected success but got reply %d", reply)
+	}
+
+	assertEchoRoundTrip(t, conn)
+
+	if server.streamCount("web-pod") == 0 {
+		t.Errorf("Expected a stream to web-pod")
+	}
+}
+
+func TestSOCKS5ProxyToUnknownService(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeSOCKS5(context.Background(), server.config, "127.0.0.1:0", WithProxyErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	for _, host := range []string{"missing.default.svc", "10.0.0.1"} {
+		// Act
+		conn, reply := socksDial(t, proxy, host, 80)
+		conn.Close()
+
+		// Assert
+		if reply != socksHostUnreachable {
+			t.Errorf("Expected host unreachable for %s but got reply %d", host, reply)
+		}
+	}
+}
+
+func TestSOCKS5ProxyRejectsAuthentication(t *testing.T) {
+	// Arrange
+	server := newProxyCluster(t)
+
+	proxy, err := ServeSOCKS5(context.Background(), server.config, "127.0.0.1:0", WithProxyErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Stop()
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	_, _ = conn.Write([]byte{5, 1, 2})
+	reply := make([]byte, 2)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, reply)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if reply[1] != socksNoAcceptable {
+		t.Errorf("Expected no acceptable methods but got %d", reply[1])
+	}
+}
@@ -0,0 +1,133 @@
+package portforward
+
+import (
+	"sync"
+)
+
+// ===== Stop reasons =====
+
+/*
+Supervisors restart or report tunnels depending on why they disappeared. A
+forward records the reason of the first stop, the callbacks of the forward and
+the global callbacks receive it together with the error once the forward
+ended:
+
+    Stop, StopForwarding, StopByID, a cancelled context  ->  StopRequested
+    SIGINT or SIGTERM                                    ->  StopSignal
+    a newer forward to the same target                   ->  StopReplaced
+    idle timeout or maximum lifetime                     ->  StopExpired
+    failed setup or lost connection to the pod           ->  StopFailed
+*/
+
+// StopReason tells why a forward stopped.
+type StopReason int
+
+const (
+	// StopRequested is a forward stopped by the caller.
+	StopRequested StopReason = iota
+	// StopSignal is a forward stopped by SIGINT or SIGTERM.
+	StopSignal
+	// StopReplaced is a forward replaced by a newer forward to the target.
+	StopReplaced
+	// StopExpired is a forward that was idle or reached its lifetime.
+	StopExpired
+	// StopFailed is a forward that failed to set up or lost its pod.
+	StopFailed
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopRequested:
+		return "requested"
+	case StopSignal:
+		return "signal"
+	case StopReplaced:
+		return "replaced"
+	case StopExpired:
+		return "expired"
+	case StopFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// StopEvent describes a forward that ended.
+type StopEvent struct {
+	// ID is the ID of registered forwards, empty for plain Forwarders.
+	ID        string
+	Namespace string
+	Target    string
+	Reason    StopReason
+	// Err is the error that failed or ended the forward, nil for requested
+	// stops.
+	Err error
+}
+
+var (
+	stopCallbacks      = make(map[int]func(StopEvent))
+	nextStopCallback   int
+	stopCallbacksMutex sync.Mutex
+)
+
+// WithOnStopEvent is called with the reason when the forward ended.
+func WithOnStopEvent(callback func(StopEvent)) Option {
+	return func(o *options) {
+		o.onStopEvent = callback
+	}
+}
+
+// OnForwardStopped registers a callback for all forwards that end from now on.
+// The returned function removes the callback.
+func OnForwardStopped(callback func(StopEvent)) func() {
+	stopCallbacksMutex.Lock()
+	defer stopCallbacksMutex.Unlock()
+
+	id := nextStopCallback
+	nextStopCallback++
+	stopCallbacks[id] = callback
+
+	return func() {
+		stopCallbacksMutex.Lock()
+		defer stopCallbacksMutex.Unlock()
+
+		delete(stopCallbacks, id)
+	}
+}
+
+// notifyStopped calls the callbacks of the forward and the global callbacks.
+func (f *Forwarder) notifyStopped(err error) {
+	f.mutex.Lock()
+	event := StopEvent{ID: f.id, Namespace: f.tunnel.namespace, Target: f.tunnel.target, Err: err}
+	f.mutex.Unlock()
+
+	event.Reason = f.tunnel.stopReason()
+
+	if f.tunnel.options.onStopEvent != nil {
+		f.tunnel.options.onStopEvent(event)
+	}
+
+	stopCallbacksMutex.Lock()
+	callbacks := make([]func(StopEvent), 0, len(stopCallbacks))
+	for _, callback := range stopCallbacks {
+		callbacks = append(callbacks, callback)
+	}
+	stopCallbacksMutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
+
+// stopReason returns why the forward stopped, a forward that was never
+// stopped failed to set up.
+func (t *tunnel) stopReason() StopReason {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.stopped {
+		return StopFailed
+	}
+
+	return t.reason
+}
@@ -0,0 +1,163 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// stopEvents collects the stop events of the target.
+func stopEvents(target string) (chan StopEvent, func(StopEvent)) {
+	events := make(chan StopEvent, 4)
+	return events, func(event StopEvent) {
+		if event.Target != target {
+			// Forwards of other tests.
+			return
+		}
+
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// receiveStopEvent waits for the next stop event.
+func receiveStopEvent(t *testing.T, events chan StopEvent) StopEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No stop event was received in time")
+		return StopEvent{}
+	}
+}
+
+func TestForwarderStopEventForStop(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stop-event-pod")
+	events, callback := stopEvents("stop-event-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "stop-event-pod", []PortMapping{{Remote: 8080}}, WithOnStopEvent(callback))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	forwarder.Stop()
+
+	// Assert
+	event := receiveStopEvent(t, events)
+	if event.Reason != StopRequested || event.Err != nil {
+		t.Errorf("Expected a requested stop without error but got %s: %v", event.Reason, event.Err)
+	}
+
+	if event.Namespace != "default" || event.Target != "stop-event-pod" {
+		t.Errorf("Unexpected target %s/%s", event.Namespace, event.Target)
+	}
+}
+
+func TestForwarderStopEventForLostConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "failed-event-pod")
+	events, callback := stopEvents("failed-event-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "failed-event-pod", []PortMapping{{Remote: 8080}}, WithOnStopEvent(callback), WithErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	event := receiveStopEvent(t, events)
+	if event.Reason != StopFailed || event.Err == nil {
+		t.Errorf("Expected a failed stop with error but got %s: %v", event.Reason, event.Err)
+	}
+}
+
+func TestForwarderStopEventForIdleTimeout(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "expired-event-pod")
+	events, callback := stopEvents("expired-event-pod")
+
+	// Act
+	_, err := NewForwarder(context.Background(), config, "default", "expired-event-pod", []PortMapping{{Remote: 8080}}, WithOnStopEvent(callback), WithIdleTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	event := receiveStopEvent(t, events)
+	if event.Reason != StopExpired || event.Err == nil {
+		t.Errorf("Expected an expired stop with error but got %s: %v", event.Reason, event.Err)
+	}
+}
+
+func TestOnForwardStoppedForReplacedForward(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "replaced-event-pod")
+	events, callback := stopEvents("replaced-event-pod")
+	remove := OnForwardStopped(callback)
+	defer remove()
+
+	id, _, err := ForwardWithID(context.Background(), config, "default", "replaced-event-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "replaced-event-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	_, err = ForwardWithContext(context.Background(), config, "default", "replaced-event-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	event := receiveStopEvent(t, events)
+	if event.ID != id || event.Reason != StopReplaced {
+		t.Errorf("Expected %s to be replaced but got %s for %s", id, event.Reason, event.ID)
+	}
+}
+
+func TestOnForwardStoppedForSignal(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "signal-event-pod")
+	events, callback := stopEvents("signal-event-pod")
+	remove := OnForwardStopped(callback)
+
+	_, err := ForwardWithContext(context.Background(), config, "default", "signal-event-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	stopForwarding("default", "signal-event-pod", StopSignal)
+
+	// Assert
+	event := receiveStopEvent(t, events)
+	if event.Reason != StopSignal || event.Err != nil {
+		t.Errorf("Expected a signal stop without error but got %s: %v", event.Reason, event.Err)
+	}
+
+	remove()
+	forwarder, err := NewForwarder(context.Background(), config, "default", "signal-event-pod", []PortMapping{{Remote: 8080}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+	forwarder.Stop()
+	<-forwarder.Done()
+
+	select {
+	case event := <-events:
+		t.Errorf("Removed callback should not be called but got %v", event)
+	case <-time.After(100 * time.Millisecond):
+		// Success
+	}
+}
@@ -0,0 +1,160 @@
+package portforward
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// ===== Stream pool =====
+
+/*
+Every local connection creates its streams to the pod, which costs a round
+trip to the kubelet before the first byte. A pool keeps streams to every
+remote port opened ahead, a new local connection takes one and the pool is
+refilled in the background. The kubelet connects pooled streams to the port
+right away, so the application sees idle connections. Pooled streams that
+the pod closed in the meantime are dropped. Only the primary pod of a
+forward has a pool.
+*/
+
+// WithStreamPool keeps size streams to every remote port opened ahead.
+func WithStreamPool(size int) Option {
+	return func(o *options) {
+		o.streamPoolSize = size
+	}
+}
+
+// pooledStreams are the data stream and the errors of an opened connection
+// to the pod.
+type pooledStreams struct {
+	data   httpstream.Stream
+	errors <-chan error
+}
+
+// streamPool holds the streams opened ahead on the primary connection.
+type streamPool struct {
+	size int
+
+	mutex   sync.Mutex
+	conn    httpstream.Connection
+	idle    map[int][]pooledStreams
+	filling map[int]bool
+}
+
+func newStreamPool(size int) *streamPool {
+	if size <= 0 {
+		return nil
+	}
+
+	return &streamPool{size: size}
+}
+
+// resetPool drops the streams of the old connection and fills the pool for
+// the remote ports of the new connection.
+func (t *tunnel) resetPool(conn httpstream.Connection, remotes []PortMapping) {
+	if t.pool == nil {
+		return
+	}
+
+	t.pool.mutex.Lock()
+	old := t.pool.idle
+	t.pool.conn = conn
+	t.pool.idle, t.pool.filling = map[int][]pooledStreams{}, map[int]bool{}
+	t.pool.mutex.Unlock()
+
+	for _, streams := range old {
+		for _, s := range streams {
+			s.data.Reset()
+		}
+	}
+
+	for _, remote := range remotes {
+		go t.fillPool(conn, remote.Remote)
+	}
+}
+
+// fillPool opens streams to the remote port until the pool is full.
+func (t *tunnel) fillPool(conn httpstream.Connection, remote int) {
+	p := t.pool
+
+	p.mutex.Lock()
+	if p.conn != conn || p.filling[remote] {
+		p.mutex.Unlock()
+		return
+	}
+	p.filling[remote] = true
+	p.mutex.Unlock()
+
+	for {
+		p.mutex.Lock()
+		if p.conn != conn {
+			p.mutex.Unlock()
+			return
+		}
+		if len(p.idle[remote]) >= p.size {
+			p.filling[remote] = false
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+
+		data, errors, err := createStreams(conn, remote, t.nextRequestID())
+		if err != nil {
+			// The connection broke, it is replaced or the forward ends.
+			p.mutex.Lock()
+			if p.conn == conn {
+				p.filling[remote] = false
+			}
+			p.mutex.Unlock()
+			return
+		}
+
+		p.mutex.Lock()
+		if p.conn != conn {
+			p.mutex.Unlock()
+			data.Reset()
+			return
+		}
+		p.idle[remote] = append(p.idle[remote], pooledStreams{data: data, errors: errors})
+		p.mutex.Unlock()
+	}
+}
+
+// openStreams takes pooled streams to the remote port or creates them.
+func (t *tunnel) openStreams(conn httpstream.Connection, remote int) (httpstream.Stream, <-chan error, error) {
+	if t.pool != nil {
+		if s, ok := t.pool.take(conn, remote); ok {
+			go t.fillPool(conn, remote)
+			return s.data, s.errors, nil
+		}
+		go t.fillPool(conn, remote)
+	}
+
+	return createStreams(conn, remote, t.nextRequestID())
+}
+
+// take returns a pooled stream that the pod did not close yet.
+func (p *streamPool) take(conn httpstream.Connection, remote int) (pooledStreams, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.conn != conn {
+		return pooledStreams{}, false
+	}
+
+	for len(p.idle[remote]) > 0 {
+		s := p.idle[remote][0]
+		p.idle[remote] = p.idle[remote][1:]
+
+		select {
+		case <-s.errors:
+			// Closed or failed by the pod while waiting.
+			s.data.Reset()
+		default:
+			return s, true
+		}
+	}
+
+	return pooledStreams{}, false
+}
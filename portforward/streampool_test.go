@@ -0,0 +1,61 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestForwardWithStreamPool(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "pooled-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "pooled-pod", []PortMapping{{Remote: 8080}}, WithStreamPool(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !waitFor(5*time.Second, func() bool { return server.streamCount("pooled-pod") == 2 }) {
+		t.Fatalf("Expected 2 streams opened ahead but got %d", server.streamCount("pooled-pod"))
+	}
+
+	// Act
+	assertEcho(t, forwarder.Ports()[0].Local)
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return server.streamCount("pooled-pod") == 3 }) {
+		t.Errorf("Expected the pool to be refilled but got %d streams", server.streamCount("pooled-pod"))
+	}
+}
+
+func TestStreamPoolIsRefilledAfterReconnect(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "repooled-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "repooled-pod", []PortMapping{{Remote: 8080}}, WithStreamPool(1), WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !waitFor(5*time.Second, func() bool { return server.streamCount("repooled-pod") == 1 }) {
+		t.Fatalf("Expected a stream opened ahead")
+	}
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	if !waitFor(10*time.Second, func() bool { return server.dialCount() == 2 && server.streamCount("repooled-pod") == 2 }) {
+		t.Fatalf("Expected the pool to be refilled on the new connection")
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
@@ -0,0 +1,309 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ===== Target resolution =====
+
+/*
+Pod names are ephemeral, so targets can also name the workload that owns
+the pods, like kubectl does: "deployment/web" forwards to a ready pod of the
+deployment. StatefulSets, DaemonSets and ReplicaSets work the same way.
+Services resolve to a ready pod of their endpoints.
+A label selector picks a ready pod among all matching pods.
+A target without a kind is a pod name.
+*/
+
+// selectorKind marks targets that are label selectors like "selector/app=web".
+const selectorKind = "selector"
+
+// selectorLookup returns the label selector of a workload.
+type selectorLookup func(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*metav1.LabelSelector, error)
+
+var workloadKinds = map[string]selectorLookup{
+	"deployment":   deploymentSelector,
+	"deployments":  deploymentSelector,
+	"deploy":       deploymentSelector,
+	"statefulset":  statefulSetSelector,
+	"statefulsets": statefulSetSelector,
+	"sts":          statefulSetSelector,
+	"daemonset":    daemonSetSelector,
+	"daemonsets":   daemonSetSelector,
+	"ds":           daemonSetSelector,
+	"replicaset":   replicaSetSelector,
+	"replicasets":  replicaSetSelector,
+	"rs":           replicaSetSelector,
+}
+
+// resolvedTarget is the pod that receives the traffic of a target and, for
+// service targets, the service whose ports are forwarded.
+type resolvedTarget struct {
+	pod     *corev1.Pod
+	service *corev1.Service
+}
+
+// resolveTarget finds the pod that receives the traffic of the target.
+func resolveTarget(ctx context.Context, clientset kubernetes.Interface, namespace, target string) (resolvedTarget, error) {
+	candidates, err := resolveTargets(ctx, clientset, namespace, target)
+	if err != nil {
+		return resolvedTarget{}, err
+	}
+
+	return candidates[0], nil
+}
+
+// resolveTargets finds the pods that may receive the traffic of the target,
+// the ready pods from newest to oldest. A pod target is its only candidate.
+func resolveTargets(ctx context.Context, clientset kubernetes.Interface, namespace, target string) ([]resolvedTarget, error) {
+	kind, name := parseTarget(target)
+
+	if kind == "pod" || kind == "pods" || kind == "po" {
+		// Checks that the pod exists.
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, withKind(ErrPodNotFound, err)
+			}
+			return nil, err
+		}
+
+		return []resolvedTarget{{pod: pod}}, nil
+	}
+
+	if kind == "service" || kind == "services" || kind == "svc" {
+		service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, withKind(ErrServiceNotFound, err)
+			}
+			return nil, err
+		}
+
+		pods, err := readyPodsForService(ctx, clientset, service)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", kind, name, err)
+		}
+
+		return candidatesOf(pods, service), nil
+	}
+
+	selector, err := targetSelector(ctx, clientset, namespace, kind, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := readyPodsForSelector(ctx, clientset, namespace, selector)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", kind, name, err)
+	}
+
+	return candidatesOf(pods, nil), nil
+}
+
+func candidatesOf(pods []corev1.Pod, service *corev1.Service) []resolvedTarget {
+	candidates := make([]resolvedTarget, 0, len(pods))
+	for i := range pods {
+		candidates = append(candidates, resolvedTarget{pod: &pods[i], service: service})
+	}
+
+	return candidates
+}
+
+// targetSelector returns the selector for the pods of a workload or label selector target.
+func targetSelector(ctx context.Context, clientset kubernetes.Interface, namespace, kind, name string) (labels.Selector, error) {
+	if kind == selectorKind {
+		return labels.Parse(name)
+	}
+
+	lookup, ok := workloadKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported target kind %q", kind)
+	}
+
+	labelSelector, err := lookup(ctx, clientset, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return metav1.LabelSelectorAsSelector(labelSelector)
+}
+
+// parseTarget splits "kind/name" and defaults to pods.
+func parseTarget(target string) (string, string) {
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) == 1 {
+		return "pod", target
+	}
+
+	return strings.ToLower(parts[0]), parts[1]
+}
+
+func deploymentSelector(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*metav1.LabelSelector, error) {
+	deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return deployment.Spec.Selector, nil
+}
+
+func statefulSetSelector(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*metav1.LabelSelector, error) {
+	statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return statefulSet.Spec.Selector, nil
+}
+
+func daemonSetSelector(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*metav1.LabelSelector, error) {
+	daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return daemonSet.Spec.Selector, nil
+}
+
+func replicaSetSelector(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*metav1.LabelSelector, error) {
+	replicaSet, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return replicaSet.Spec.Selector, nil
+}
+
+// readyPodsForSelector returns the ready pods matching the selector.
+func readyPodsForSelector(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector) ([]corev1.Pod, error) {
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := readyPods(list.Items)
+	if len(pods) == 0 {
+		return nil, ErrNoReadyPod
+	}
+
+	return pods, nil
+}
+
+// readyPodsForService returns the ready pods among the endpoints of the
+// service. EndpointSlices are preferred, Endpoints are the fallback for
+// clusters without them.
+func readyPodsForService(ctx context.Context, clientset kubernetes.Interface, service *corev1.Service) ([]corev1.Pod, error) {
+	namespace, name := service.Namespace, service.Name
+
+	names, err := endpointSlicePods(ctx, clientset, namespace, name)
+	if err != nil || len(names) == 0 {
+		names, err = endpointsPods(ctx, clientset, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	candidates := make([]corev1.Pod, 0, len(names))
+	for _, podName := range names {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		candidates = append(candidates, *pod)
+	}
+
+	pods := readyPods(candidates)
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w in %d endpoints", ErrNoReadyPod, len(names))
+	}
+
+	return pods, nil
+}
+
+// endpointSlicePods returns the names of the pods in the EndpointSlices of the service.
+func endpointSlicePods(ctx context.Context, clientset kubernetes.Interface, namespace, service string) ([]string, error) {
+	list, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, slice := range list.Items {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				names = append(names, endpoint.TargetRef.Name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// endpointsPods returns the names of the pods in the Endpoints of the service.
+func endpointsPods(ctx context.Context, clientset kubernetes.Interface, namespace, service string) ([]string, error) {
+	endpoints, err := clientset.CoreV1().Endpoints(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, subset := range endpoints.Subsets {
+		addresses := append(subset.Addresses, subset.NotReadyAddresses...)
+		for _, address := range addresses {
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+				names = append(names, address.TargetRef.Name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// readyPods filters the ready pods and sorts them from newest to oldest.
+func readyPods(pods []corev1.Pod) []corev1.Pod {
+	ready := make([]corev1.Pod, 0, len(pods))
+
+	for _, pod := range pods {
+		if isPodReady(&pod) {
+			ready = append(ready, pod)
+		}
+	}
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[j].CreationTimestamp.Before(&ready[i].CreationTimestamp)
+	})
+
+	return ready
+}
+
+// isPodReady reports whether a running pod passes its readiness checks.
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
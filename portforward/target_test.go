@@ -0,0 +1,282 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestPod creates a pod with the labels that is ready if requested.
+func newTestPod(name string, labels map[string]string, ready bool, created time.Time) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestResolveTargetByName(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset(newTestPod("web-1", nil, true, time.Now()))
+
+	for _, target := range []string{"web-1", "pod/web-1", "po/web-1"} {
+		// Act
+		resolved, err := resolveTarget(context.Background(), clientset, "default", target)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", target, err)
+		}
+
+		if resolved.pod.Name != "web-1" {
+			t.Errorf("Expected web-1 for %s but got %s", target, resolved.pod.Name)
+		}
+	}
+}
+
+func TestResolveTargetOfMissingPod(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset()
+
+	// Act
+	_, err := resolveTarget(context.Background(), clientset, "default", "web-1")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when the pod does not exist")
+	}
+}
+
+func TestResolveTargetOfDeployment(t *testing.T) {
+	// Arrange
+	labels := map[string]string{"app": "web"}
+	now := time.Now()
+
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		newTestPod("web-old", labels, true, now.Add(-time.Hour)),
+		newTestPod("web-new", labels, true, now),
+		newTestPod("web-starting", labels, false, now.Add(time.Minute)),
+		newTestPod("other", map[string]string{"app": "other"}, true, now.Add(time.Hour)),
+	)
+
+	// Act
+	resolved, err := resolveTarget(context.Background(), clientset, "default", "deployment/web")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resolved.pod.Name != "web-new" {
+		t.Errorf("Expected the newest ready pod but got %s", resolved.pod.Name)
+	}
+}
+
+func TestResolveTargetOfDeploymentWithoutReadyPods(t *testing.T) {
+	// Arrange
+	labels := map[string]string{"app": "web"}
+
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		newTestPod("web-starting", labels, false, time.Now()),
+	)
+
+	// Act
+	_, err := resolveTarget(context.Background(), clientset, "default", "deploy/web")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when no pod is ready")
+	}
+}
+
+func TestResolveTargetWithUnsupportedKind(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset()
+
+	// Act
+	_, err := resolveTarget(context.Background(), clientset, "default", "cronjob/backup")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for unsupported kinds")
+	}
+}
+
+func TestResolveTargetOfOtherWorkloads(t *testing.T) {
+	// Arrange
+	labels := map[string]string{"app": "db"}
+	selector := &metav1.LabelSelector{MatchLabels: labels}
+	meta := metav1.ObjectMeta{Name: "db", Namespace: "default"}
+
+	clientset := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{ObjectMeta: meta, Spec: appsv1.StatefulSetSpec{Selector: selector}},
+		&appsv1.DaemonSet{ObjectMeta: meta, Spec: appsv1.DaemonSetSpec{Selector: selector}},
+		&appsv1.ReplicaSet{ObjectMeta: meta, Spec: appsv1.ReplicaSetSpec{Selector: selector}},
+		newTestPod("db-0", labels, true, time.Now()),
+	)
+
+	for _, target := range []string{"statefulset/db", "sts/db", "daemonset/db", "ds/db", "replicaset/db", "rs/db"} {
+		// Act
+		resolved, err := resolveTarget(context.Background(), clientset, "default", target)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", target, err)
+		}
+
+		if resolved.pod.Name != "db-0" {
+			t.Errorf("Expected db-0 for %s but got %s", target, resolved.pod.Name)
+		}
+	}
+}
+
+func TestResolveTargetBySelector(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset(
+		newTestPod("web-1", map[string]string{"app": "web", "tier": "frontend"}, true, time.Now()),
+		newTestPod("web-2", map[string]string{"app": "web", "tier": "backend"}, true, time.Now()),
+	)
+
+	// Act
+	resolved, err := resolveTarget(context.Background(), clientset, "default", "selector/app=web,tier=frontend")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resolved.pod.Name != "web-1" {
+		t.Errorf("Expected web-1 but got %s", resolved.pod.Name)
+	}
+}
+
+// newTestService creates a service in the default namespace.
+func newTestService(name string) *corev1.Service {
+	return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+}
+
+// podRef references a pod of the default namespace from an endpoint.
+func podRef(name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: name}
+}
+
+func TestResolveTargetOfServiceWithEndpointSlices(t *testing.T) {
+	// Arrange
+	now := time.Now()
+
+	clientset := fake.NewSimpleClientset(
+		newTestService("web"),
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web-abc",
+				Namespace: "default",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+			},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.1"}, TargetRef: podRef("web-ready")},
+				{Addresses: []string{"10.0.0.2"}, TargetRef: podRef("web-starting")},
+			},
+		},
+		newTestPod("web-ready", nil, true, now),
+		newTestPod("web-starting", nil, false, now.Add(time.Minute)),
+	)
+
+	// Act
+	resolved, err := resolveTarget(context.Background(), clientset, "default", "svc/web")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resolved.pod.Name != "web-ready" {
+		t.Errorf("Expected web-ready but got %s", resolved.pod.Name)
+	}
+}
+
+func TestResolveTargetOfServiceWithEndpoints(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset(
+		newTestService("web"),
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1", TargetRef: podRef("web-1")}},
+			}},
+		},
+		newTestPod("web-1", nil, true, time.Now()),
+	)
+
+	// Act
+	resolved, err := resolveTarget(context.Background(), clientset, "default", "service/web")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if resolved.pod.Name != "web-1" {
+		t.Errorf("Expected web-1 but got %s", resolved.pod.Name)
+	}
+}
+
+func TestResolveTargetOfServiceWithoutReadyPods(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset(
+		newTestService("web"),
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Subsets: []corev1.EndpointSubset{{
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1", TargetRef: podRef("web-1")}},
+			}},
+		},
+		newTestPod("web-1", nil, false, time.Now()),
+	)
+
+	// Act
+	_, err := resolveTarget(context.Background(), clientset, "default", "svc/web")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when no pod of the service is ready")
+	}
+}
+
+func TestResolveTargetOfMissingService(t *testing.T) {
+	// Arrange
+	clientset := fake.NewSimpleClientset()
+
+	// Act
+	_, err := resolveTarget(context.Background(), clientset, "default", "svc/web")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned when the service does not exist")
+	}
+}
@@ -0,0 +1,89 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ===== Target strings =====
+
+/*
+CLI and FFI callers pass a forward as a single string instead of separate
+namespace, target and port parameters:
+
+	pod/web.default:8080        port 8080 of the pod web in default
+	deploy/api.prod:http        the named port http of a pod of api in prod
+	svc/db.prod:15432:5432      local port 15432 to the port 5432 of db
+	svc/web                     all ports of web in the current namespace
+
+The kind is required, so the string never depends on whether a pod or a
+service of the name exists. Namespaces are DNS labels without dots, so the
+namespace is the part after the last dot, pod names with dots must be given
+with their namespace. The ports are port mappings like ParsePortMapping,
+several mappings are separated by commas.
+*/
+
+// TargetSpec is a parsed target string.
+type TargetSpec struct {
+	// Namespace is empty for the namespace of the kubeconfig context.
+	Namespace string
+	// Target is the kind and name like "svc/web", as passed to StopForwarding.
+	Target string
+	// Ports is empty for all ports of the target.
+	Ports []PortMapping
+}
+
+// ParseTargetSpec parses a target string like "svc/web.prod:8080".
+func ParseTargetSpec(spec string) (TargetSpec, error) {
+	target, ports, hasPorts := spec, "", false
+	if i := strings.Index(spec, ":"); i >= 0 {
+		target, ports, hasPorts = spec[:i], spec[i+1:], true
+	}
+
+	i := strings.Index(target, "/")
+	if i <= 0 || i == len(target)-1 {
+		return TargetSpec{}, fmt.Errorf("invalid target %q: expected kind/name[.namespace][:ports]", spec)
+	}
+
+	kind, name := strings.ToLower(target[:i]), target[i+1:]
+	if kind == selectorKind {
+		return TargetSpec{}, fmt.Errorf("invalid target %q: selectors are not supported in target strings", spec)
+	}
+
+	parsed := TargetSpec{}
+	if j := strings.LastIndex(name, "."); j >= 0 {
+		name, parsed.Namespace = name[:j], name[j+1:]
+		if name == "" || parsed.Namespace == "" {
+			return TargetSpec{}, fmt.Errorf("invalid target %q: empty name or namespace", spec)
+		}
+	}
+	parsed.Target = kind + "/" + name
+
+	if hasPorts {
+		for _, port := range strings.Split(ports, ",") {
+			mapping, err := ParsePortMapping(port)
+			if err != nil {
+				return TargetSpec{}, fmt.Errorf("invalid target %q: %w", spec, err)
+			}
+			parsed.Ports = append(parsed.Ports, mapping)
+		}
+	}
+
+	return parsed, nil
+}
+
+// ForwardTarget forwards the target string like ForwardWithContext. Without
+// ports all ports of the target are forwarded like ForwardAllPorts.
+func ForwardTarget(ctx context.Context, config *Config, spec string, opts ...Option) ([]PortMapping, error) {
+	parsed, err := ParseTargetSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsed.Ports) == 0 {
+		return ForwardAllPorts(ctx, config, parsed.Namespace, parsed.Target, false, opts...)
+	}
+
+	return ForwardWithContext(ctx, config, parsed.Namespace, parsed.Target, parsed.Ports, opts...)
+}
@@ -0,0 +1,68 @@
+package portforward
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseTargetSpec(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected TargetSpec
+	}{
+		{"pod/web.default:8080", TargetSpec{Namespace: "default", Target: "pod/web", Ports: []PortMapping{{Local: 8080, Remote: 8080}}}},
+		{"deploy/api.prod:http", TargetSpec{Namespace: "prod", Target: "deploy/api", Ports: []PortMapping{{RemoteName: "http"}}}},
+		{"svc/db.prod:15432:5432", TargetSpec{Namespace: "prod", Target: "svc/db", Ports: []PortMapping{{Local: 15432, Remote: 5432}}}},
+		{"SVC/web:80,443", TargetSpec{Target: "svc/web", Ports: []PortMapping{{Local: 80, Remote: 80}, {Local: 443, Remote: 443}}}},
+		{"pod/web.v2.dev", TargetSpec{Namespace: "dev", Target: "pod/web.v2"}},
+		{"svc/web", TargetSpec{Target: "svc/web"}},
+	}
+
+	for _, c := range cases {
+		// Act
+		parsed, err := ParseTargetSpec(c.spec)
+
+		// Assert
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", c.spec, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(parsed, c.expected) {
+			t.Errorf("Expected %+v for %q but got %+v", c.expected, c.spec, parsed)
+		}
+	}
+}
+
+func TestParseTargetSpecWithInvalidSpec(t *testing.T) {
+	for _, spec := range []string{"web", "/web", "pod/", "pod/web.", "pod/.dev", "svc/web:", "svc/web:abc:80", "selector/app=web"} {
+		// Act
+		_, err := ParseTargetSpec(spec)
+
+		// Assert
+		if err == nil {
+			t.Errorf("Error should be returned for %q", spec)
+		}
+	}
+}
+
+func TestForwardTarget(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "spec-pod")
+
+	// Act
+	ports, err := ForwardTarget(context.Background(), config, "pod/spec-pod.default:0:8080")
+	defer StopForwarding("default", "pod/spec-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(ports) != 1 || ports[0].Remote != 8080 {
+		t.Fatalf("Expected a forward to port 8080 but got %v", ports)
+	}
+
+	assertEcho(t, ports[0].Local)
+}
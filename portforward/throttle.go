@@ -0,0 +1,105 @@
+package portforward
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/time/rate"
+)
+
+// ===== Bandwidth limits =====
+
+/*
+A large copy through a forward can saturate the uplink of the developer or
+the egress of the cluster. The limits are shared by all connections of a
+forward, so parallel transfers do not multiply the bandwidth. The upload is
+the traffic from the local clients to the pod, the download the traffic back.
+The limits apply to the local connections and cover every data path.
+*/
+
+// maxThrottleBurst bounds the bytes that pass a limit at once.
+const maxThrottleBurst = 32 * 1024
+
+// WithBandwidthLimit limits the upload and download of the forward in bytes
+// per second. Zero does not limit the direction.
+func WithBandwidthLimit(upload, download int) Option {
+	return func(o *options) {
+		o.uploadLimit, o.downloadLimit = upload, download
+	}
+}
+
+// newLimiter returns the limiter for the bytes per second or nil.
+func newLimiter(bytesPerSecond int) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := bytesPerSecond
+	if burst > maxThrottleBurst {
+		burst = maxThrottleBurst
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// throttledConn limits the reads and writes of a local connection.
+type throttledConn struct {
+	net.Conn
+	ctx      context.Context
+	upload   *rate.Limiter
+	download *rate.Limiter
+}
+
+// throttle limits the local connection if the forward has limits.
+func (t *tunnel) throttle(local net.Conn) net.Conn {
+	if t.uploadLimiter == nil && t.downloadLimiter == nil {
+		return local
+	}
+
+	return &throttledConn{Conn: local, ctx: t.ctx, upload: t.uploadLimiter, download: t.downloadLimiter}
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if c.upload == nil {
+		return c.Conn.Read(p)
+	}
+
+	if len(p) > c.upload.Burst() {
+		p = p[:c.upload.Burst()]
+	}
+
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if waitErr := c.upload.WaitN(c.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	if c.download == nil {
+		return c.Conn.Write(p)
+	}
+
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > c.download.Burst() {
+			chunk = chunk[:c.download.Burst()]
+		}
+
+		if err := c.download.WaitN(c.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,63 @@
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestForwardWithBandwidthLimit(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "throttled-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "throttled-pod", []PortMapping{{Remote: 8080}}, WithBandwidthLimit(0, 20*1024))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	data := bytes.Repeat([]byte("x"), 40*1024)
+	start := time.Now()
+
+	go func() {
+		_, _ = conn.Write(data)
+	}()
+
+	received := make([]byte, len(data))
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, err = io.ReadFull(conn, received)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first 20 KiB are the burst, the rest takes a second.
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("Expected the download to take about a second but it took %v", elapsed)
+	}
+}
+
+func TestNewLimiterWithoutLimit(t *testing.T) {
+	// Act
+	limiter := newLimiter(0)
+
+	// Assert
+	if limiter != nil {
+		t.Errorf("Expected no limiter without limit")
+	}
+}
@@ -0,0 +1,135 @@
+package portforward
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"time"
+)
+
+// ===== Local TLS =====
+
+/*
+Browser based tools often require https, so the local ports can be served
+over TLS. The connection to the cluster is not affected, the forwarded
+traffic is decrypted locally and sent to the pod as it is. On shared machines
+client certificates can be required, so only the processes holding one can
+use the tunnel into the cluster.
+*/
+
+// tlsHandshakeTimeout bounds the handshake of a local connection.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// WithTLS serves the local ports over TLS with the certificate and key files.
+// Empty paths generate a self-signed certificate for localhost and the
+// addresses of the forward.
+func WithTLS(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.tls = true
+		o.tlsCertFile, o.tlsKeyFile = certFile, keyFile
+	}
+}
+
+// WithClientCA requires local clients to present a certificate signed by a CA
+// of the PEM file. It serves the local ports over TLS like WithTLS, with a
+// self-signed certificate unless WithTLS sets the files.
+func WithClientCA(caFile string) Option {
+	return func(o *options) {
+		o.tls = true
+		o.tlsClientCAFile = caFile
+	}
+}
+
+// localTLSConfig returns the TLS config of the local listeners or nil.
+func (o *options) localTLSConfig() (*tls.Config, error) {
+	if !o.tls {
+		return nil, nil
+	}
+
+	var certificate tls.Certificate
+	var err error
+	if o.tlsCertFile == "" && o.tlsKeyFile == "" {
+		certificate, err = selfSignedCertificate(o.addresses)
+	} else {
+		certificate, err = tls.LoadX509KeyPair(o.tlsCertFile, o.tlsKeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading the local TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+
+	if o.tlsClientCAFile != "" {
+		pem, err := ioutil.ReadFile(o.tlsClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the client CA: %w", err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the client CA %s", o.tlsClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// selfSignedCertificate generates a certificate for localhost and the hosts.
+func selfSignedCertificate(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "localhost" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// handshake does the TLS handshake of a local connection within the timeout.
+func handshake(conn *tls.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout)); err != nil {
+		return err
+	}
+
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
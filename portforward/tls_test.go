@@ -0,0 +1,268 @@
+package portforward
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes the certificate and its key as PEM files.
+func writeCertificate(t *testing.T, certificate tls.Certificate) (string, string) {
+	t.Helper()
+
+	key, err := x509.MarshalECPrivateKey(certificate.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestForwardWithSelfSignedTLS(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "tls-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "tls-pod", []PortMapping{{Remote: 8080}}, WithTLS("", ""))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local), &tls.Config{InsecureSkipVerify: true})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := conn.ConnectionState().PeerCertificates[0].VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected a certificate for localhost but got %v", err)
+	}
+
+	assertEchoConn(t, conn)
+}
+
+func TestForwardWithTLSFiles(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "tls-files-pod")
+
+	certificate, err := selfSignedCertificate(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	certFile, keyFile := writeCertificate(t, certificate)
+
+	parsed, _ := x509.ParseCertificate(certificate.Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "tls-files-pod", []PortMapping{{Remote: 8080}}, WithTLS(certFile, keyFile))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	conn, err := tls.Dial("tcp", fmt.Sprintf("localhost:%d", forwarder.Ports()[0].Local), &tls.Config{RootCAs: roots})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEchoConn(t, conn)
+}
+
+func TestForwardWithTLSRejectsPlainClients(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "plain-pod")
+
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "plain-pod", []PortMapping{{Remote: 8080}}, WithTLS("", ""), WithErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _ = ioutil.ReadAll(conn)
+
+	// Assert
+	if server.streamCount("plain-pod") != 0 {
+		t.Errorf("Expected no streams to the pod but got %d", server.streamCount("plain-pod"))
+	}
+}
+
+func TestForwardWithMissingTLSFiles(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "missing-tls-pod")
+	dir := t.TempDir()
+
+	// Act
+	_, err := ForwardPorts(server.config, "default", "missing-tls-pod", []PortMapping{{Remote: 8080}}, WithTLS(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")))
+	defer StopForwarding("default", "missing-tls-pod")
+
+	// Assert
+	if err == nil {
+		t.Fatalf("Error should be returned for missing certificate files")
+	}
+
+	if server.dialCount() != 0 {
+		t.Errorf("Expected no connection to the pod but got %d connections", server.dialCount())
+	}
+}
+
+// newClientCertificate creates a CA file and a client certificate signed by it.
+func newClientCertificate(t *testing.T) (string, tls.Certificate) {
+	t.Helper()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "local clients"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "tool"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, ca, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return caFile, tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+}
+
+func TestForwardWithClientCA(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "mtls-pod")
+	caFile, clientCertificate := newClientCertificate(t)
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "mtls-pod", []PortMapping{{Remote: 8080}}, WithClientCA(caFile))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local), &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{clientCertificate},
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEchoConn(t, conn)
+}
+
+func TestForwardWithClientCARejectsClientsWithoutCertificate(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "mtls-denied-pod")
+	caFile, _ := newClientCertificate(t)
+
+	rejected := make(chan error, 1)
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "mtls-denied-pod", []PortMapping{{Remote: 8080}},
+		WithClientCA(caFile), WithErrorHandler(func(err error) {
+			select {
+			case rejected <- err:
+			default:
+			}
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local), &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		// TLS 1.3 reports the rejection on the first read.
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+
+	// Assert
+	if err == nil {
+		t.Errorf("Client without certificate should be rejected")
+	}
+
+	select {
+	case <-rejected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Rejected client was not reported")
+	}
+
+	if server.streamCount("mtls-denied-pod") != 0 {
+		t.Errorf("Expected no streams to the pod but got %d", server.streamCount("mtls-denied-pod"))
+	}
+}
@@ -0,0 +1,68 @@
+package portforward
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ===== Service account token files =====
+
+// LoadTokenFileConfig authenticates with a projected service account token
+// instead of a kubeconfig. This covers pods with a non-default token mount
+// that neither a kubeconfig nor the in-cluster config can handle.
+// An empty caFile uses the system certificate pool.
+func LoadTokenFileConfig(host, tokenFile, caFile string, opts ...ConfigOption) (*Config, error) {
+	return loadConfig(&tokenFileSource{host: host, tokenFile: tokenFile, caFile: caFile}, opts)
+}
+
+// tokenFileSource builds the config from the API server host and a token file.
+type tokenFileSource struct {
+	host      string
+	tokenFile string
+	caFile    string
+}
+
+const tokenFileContext = "token-file"
+
+func (t *tokenFileSource) clientConfig() clientcmd.ClientConfig {
+	config := clientcmdapi.NewConfig()
+
+	config.Clusters[tokenFileContext] = &clientcmdapi.Cluster{
+		Server:               t.host,
+		CertificateAuthority: t.caFile,
+	}
+	config.AuthInfos[tokenFileContext] = &clientcmdapi.AuthInfo{
+		TokenFile: t.tokenFile,
+	}
+	config.Contexts[tokenFileContext] = &clientcmdapi.Context{
+		Cluster:   tokenFileContext,
+		AuthInfo:  tokenFileContext,
+		Namespace: t.namespace(),
+	}
+	config.CurrentContext = tokenFileContext
+
+	return clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
+}
+
+// namespace reads the namespace file that is mounted next to service account tokens.
+func (t *tokenFileSource) namespace() string {
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(t.tokenFile), "namespace"))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+func (t *tokenFileSource) files() []string {
+	// client-go re-reads the token file by itself.
+	if t.caFile == "" {
+		return nil
+	}
+
+	return []string{t.caFile}
+}
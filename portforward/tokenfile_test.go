@@ -0,0 +1,37 @@
+package portforward
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTokenFileConfig(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "namespace"), []byte("team-a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	config, err := LoadTokenFileConfig("https://10.0.0.1:443", tokenFile, "")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restConfig, _ := config.client()
+
+	if restConfig.Host != "https://10.0.0.1:443" || restConfig.BearerTokenFile != tokenFile {
+		t.Errorf("Unexpected config %+v", restConfig)
+	}
+
+	if namespace := config.defaultNamespace(); namespace != "team-a" {
+		t.Errorf("Expected namespace team-a but got %s", namespace)
+	}
+}
@@ -0,0 +1,1211 @@
+package portforward
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+)
+
+// ===== Tunnel =====
+
+/*
+The tunnel owns the local listeners of a forward and sends every accepted
+connection as a pair of streams over one connection to the pod, like the
+client-go PortForwarder. Unlike it the connection to the pod can be replaced
+while the listeners stay open, e.g. after the config was reloaded or the pod
+restarted.
+*/
+
+// errStopped is returned when the forward is stopped during its setup.
+var errStopped = errors.New("forward was stopped")
+
+// wsaeaddrinuse is the error of Windows for an address in use.
+const wsaeaddrinuse = syscall.Errno(10048)
+
+// reconnectBackoff is the first delay between reconnect attempts, it doubles
+// up to maxReconnectBackoff.
+const (
+	reconnectBackoff    = 500 * time.Millisecond
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// defaultReadyTimeout limits the connection to the pod of forwards without a
+// ready timeout.
+var defaultReadyTimeout = 2 * time.Minute
+
+// drainPollInterval is how often a draining forward checks for open
+// connections.
+const drainPollInterval = 50 * time.Millisecond
+
+type tunnel struct {
+	ctx       context.Context
+	config    *Config
+	namespace string
+	target    string
+	ports     []PortMapping
+	options   options
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	err       error
+	listeners []net.Listener
+	// handlers are the accept loops and the local connections they handle.
+	handlers sync.WaitGroup
+	metrics  *metrics
+	// warnings are the latest errors that did not stop the forward.
+	warnings *warnings
+	logger   *log.Logger
+	// indexes are the port indexes of the listeners.
+	indexes []int
+	// tlsConfig serves the local connections over TLS when set.
+	tlsConfig *tls.Config
+	// allowedClients are the networks of the accepted clients, all when empty.
+	allowedClients []*net.IPNet
+	// uploadLimiter and downloadLimiter are shared by the local connections.
+	uploadLimiter   *rate.Limiter
+	downloadLimiter *rate.Limiter
+	// chaos draws the faults of chaos mode when set.
+	chaos *chaosSource
+	// capture records the local connections when set.
+	capture *capture
+	// slots are taken by the open local connections of a limited forward.
+	slots chan struct{}
+	// pool holds streams opened ahead on the primary connection.
+	pool *streamPool
+	// accessLog has an entry per closed local connection when set.
+	accessLog *accessLog
+
+	mutex     sync.Mutex
+	conn      httpstream.Connection
+	pod       string
+	remotes   []PortMapping
+	changed   chan struct{}
+	requestID int
+	// extras are the connections to the other pods of a balanced forward.
+	extras []backend
+	// mirror is the connection to the shadow pod of a mirrored forward.
+	mirror backend
+	// inUse counts the local connections per connection to a pod. Retired
+	// connections were replaced by a reload and are closed when unused.
+	inUse   map[httpstream.Connection]int
+	retired map[httpstream.Connection]bool
+	next    int
+	// paused closes new local connections, disconnected closed the
+	// connection to the pod until resuming.
+	paused       bool
+	disconnected bool
+	// retargeted is the target of the connection, it differs from target
+	// after Retarget.
+	retargeted string
+	// podDetails describe the pod of conn.
+	podDetails PodInfo
+	// reason is why the forward was stopped.
+	stopped bool
+	reason  StopReason
+}
+
+// backend is a connection to a pod of the target.
+type backend struct {
+	conn    httpstream.Connection
+	pod     string
+	remotes []PortMapping
+}
+
+func newTunnel(ctx context.Context, config *Config, namespace, target string, ports []PortMapping, options options) *tunnel {
+	return &tunnel{
+		ctx:       ctx,
+		config:    config,
+		namespace: namespace,
+		target:    target,
+		ports:     append([]PortMapping(nil), ports...),
+		options:   options,
+		stopChan:  make(chan struct{}),
+		changed:   make(chan struct{}),
+		metrics:   &metrics{},
+		warnings:  &warnings{},
+		logger:    newLogger(options, namespace, target),
+
+		uploadLimiter:   newLimiter(options.uploadLimit),
+		downloadLimiter: newLimiter(options.downloadLimit),
+		chaos:           newChaosSource(options.chaos),
+		slots:           newSlots(options.maxConnections),
+		pool:            newStreamPool(options.streamPoolSize),
+		accessLog:       newAccessLog(options.accessLog),
+	}
+}
+
+// start connects to the pod and listens on the local ports. The setup must
+// be finished within the ready timeout.
+func (t *tunnel) start() ([]PortMapping, error) {
+	ctx := t.ctx
+	if t.options.readyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.options.readyTimeout)
+		defer cancel()
+	}
+
+	// LOCAL PORTS
+	// Bound first, so a taken port fails before the cluster is dialed.
+	if err := t.listen(); err != nil {
+		return nil, err
+	}
+
+	// CHECK + DIALER
+	err := t.waitForTarget(ctx)
+	if err == nil {
+		err = t.connectInTime(ctx)
+	}
+	if err != nil {
+		t.closeListeners()
+		t.closeCapture()
+		if ctx.Err() == context.DeadlineExceeded && t.ctx.Err() == nil {
+			return nil, fmt.Errorf("forward was not ready within %s: %w", t.options.readyTimeout, withKind(ErrNotReady, err))
+		}
+		return nil, err
+	}
+
+	// PORT FORWARD
+	bound := t.serve()
+
+	if t.options.logPrefix == "" {
+		t.logger.SetPrefix(logPrefix(t.namespace, t.target, bound))
+	}
+	t.logf(LogInfo, "forwarding to pod %s", t.podName())
+
+	t.watchReload()
+
+	if t.options.idleTimeout > 0 {
+		t.metrics.active()
+		go t.stopWhenIdle()
+	}
+
+	if t.options.maxLifetime > 0 {
+		go t.stopWhenExpired()
+	}
+
+	if t.options.healthInterval > 0 {
+		go t.checkHealth()
+	}
+
+	if t.followsRollouts() {
+		go t.followRollouts()
+	}
+
+	return bound, nil
+}
+
+// stop ends the forward, the first error is kept.
+func (t *tunnel) stop(err error) {
+	reason := StopRequested
+	if err != nil {
+		reason = StopFailed
+	}
+
+	t.stopWith(reason, err)
+}
+
+// stopWith ends the forward, the first reason and error are kept.
+func (t *tunnel) stopWith(reason StopReason, err error) {
+	t.stopOnce.Do(func() {
+		t.mutex.Lock()
+		t.err = err
+		t.stopped, t.reason = true, reason
+		t.mutex.Unlock()
+
+		close(t.stopChan)
+		t.config.offReload(t.stopChan)
+	})
+}
+
+// connectInTime connects within the default ready timeout unless the forward
+// has its own, so a pod that never answers does not hang the setup. Waiting
+// for the target is limited by its own timeout.
+func (t *tunnel) connectInTime(ctx context.Context) error {
+	if t.options.readyTimeout != 0 {
+		return t.connectWithRetry(ctx)
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, defaultReadyTimeout)
+	defer cancel()
+
+	err := t.connectWithRetry(connectCtx)
+	if err != nil && connectCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return fmt.Errorf("pod of %s/%s was not connected within %s: %w", t.namespace, t.target, defaultReadyTimeout, withKind(ErrNotReady, err))
+	}
+
+	return err
+}
+
+// connectWithRetry connects for the configured attempts and aggregates the
+// errors of all failed attempts.
+func (t *tunnel) connectWithRetry(ctx context.Context) error {
+	backoff := t.options.retryBackoff
+	var errs []error
+
+	for attempt := 1; ; attempt++ {
+		err := t.connect(ctx)
+		if err == nil {
+			return nil
+		}
+		if err == errStopped || ctx.Err() != nil {
+			return err
+		}
+
+		errs = append(errs, err)
+		if attempt >= t.options.attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.stopChan:
+			return errStopped
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return fmt.Errorf("forward failed after %d attempts: %w", len(errs), utilerrors.NewAggregate(errs))
+}
+
+// connect resolves the target again and replaces the connection to the pod.
+// The context bounds the requests and the upgrade of the connection.
+func (t *tunnel) connect(ctx context.Context) error {
+	return t.connectTo(ctx, t.currentTarget(), false)
+}
+
+// connectTo replaces the connection with a connection to a pod of the target.
+// Draining keeps the replaced connections open for their local connections.
+func (t *tunnel) connectTo(ctx context.Context, target string, drain bool) error {
+	conn, pod, resolved, err := t.dialTarget(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	var extras []backend
+	if t.options.balance {
+		extras = t.connectExtras(ctx, target, pod.Name)
+	}
+
+	var mirror backend
+	if t.options.mirrorTarget != "" {
+		mirror = t.connectMirror(ctx)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	select {
+	case <-t.stopChan:
+		// Stopped while connecting.
+		conn.Close()
+		closeBackends(extras)
+		if mirror.conn != nil {
+			mirror.conn.Close()
+		}
+		return errStopped
+	default:
+	}
+
+	if t.conn != nil {
+		if drain {
+			t.retire(t.conn)
+		} else {
+			t.conn.Close()
+		}
+	}
+
+	addLoad(t.namespace, t.pod, -1)
+	addLoad(t.namespace, pod.Name, 1)
+
+	if t.conn != nil {
+		if pod.Name == t.podDetails.Name && string(pod.UID) != t.podDetails.UID {
+			t.logf(LogInfo, "connected to replaced pod %s", pod.Name)
+		} else {
+			t.logf(LogInfo, "connected to pod %s", pod.Name)
+		}
+	}
+
+	t.conn, t.pod, t.remotes = conn, pod.Name, resolved
+	t.podDetails = newPodInfo(pod)
+	t.retargeted = target
+	t.resetPool(conn, resolved)
+	t.replaceExtras(extras, drain)
+	t.replaceMirror(mirror)
+	close(t.changed)
+	t.changed = make(chan struct{})
+
+	return nil
+}
+
+// dialTarget connects to the picked pod of the target, or to the first of
+// several candidates when the forward races pods.
+func (t *tunnel) dialTarget(ctx context.Context, target string) (httpstream.Connection, *corev1.Pod, []PortMapping, error) {
+	if t.options.podRace > 1 {
+		return t.racePods(ctx, target)
+	}
+
+	dialer, pod, resolved, err := prepareForward(ctx, t.config, t.namespace, target, t.requestedPorts(), t.picker(target))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := t.checkDeclaredPorts(pod, resolved); err != nil {
+		return nil, nil, nil, err
+	}
+
+	conn, err := dialPod(ctx, dialer, t.config.options.dialTimeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return conn, pod, resolved, nil
+}
+
+// checkDeclaredPorts fails strict forwards to undeclared ports of the pod and
+// warns about them otherwise, connections to them are usually reset.
+func (t *tunnel) checkDeclaredPorts(pod *corev1.Pod, remotes []PortMapping) error {
+	missing := undeclaredPorts(pod, remotes)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("pod %s does not declare the ports %v: %w", pod.Name, missing, ErrPortNotDeclared)
+	if t.options.strictPorts {
+		return err
+	}
+
+	t.warnings.add(err)
+	t.logf(LogError, "warning: %v", err)
+	return nil
+}
+
+// dialPod upgrades the connection to the pod unless the context is done first.
+func dialPod(ctx context.Context, dialer httpstream.Dialer, timeout time.Duration) (httpstream.Connection, error) {
+	dialCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		conn httpstream.Connection
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+		results <- result{conn, err}
+	}()
+
+	select {
+	case r := <-results:
+		if r.err != nil {
+			kind := ErrUpgradeFailed
+			if apierrors.IsForbidden(r.err) {
+				kind = ErrPortForwardForbidden
+			}
+			return nil, fmt.Errorf("error upgrading connection: %w", withKind(kind, r.err))
+		}
+		return r.conn, nil
+	case <-dialCtx.Done():
+		// Closes the connection when the upgrade finishes after all.
+		go func() {
+			if r := <-results; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("error upgrading connection: no response within %s: %w", timeout, withKind(ErrUpgradeFailed, dialCtx.Err()))
+	}
+}
+
+// podName returns the pod of the current connection.
+func (t *tunnel) podName() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.pod
+}
+
+// replaced reports whether the connection is no longer the current one.
+func (t *tunnel) replaced(conn httpstream.Connection) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.conn != conn
+}
+
+// connection returns the current connection to the pod and waits while it is
+// being replaced. Balanced forwards rotate over the connections to all pods.
+// It returns false when the forward was stopped, a returned connection must
+// be released.
+func (t *tunnel) connection() (backend, bool) {
+	for {
+		t.mutex.Lock()
+		backends := append([]backend{{t.conn, t.pod, t.remotes}}, t.extras...)
+		next, changed := t.next, t.changed
+		t.next++
+		t.mutex.Unlock()
+
+		for i := range backends {
+			candidate := backends[(next+i)%len(backends)]
+
+			select {
+			case <-candidate.conn.CloseChan():
+			default:
+				if t.use(candidate.conn) {
+					return candidate, true
+				}
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-t.stopChan:
+			return backend{}, false
+		}
+	}
+}
+
+// use counts a local connection on the connection to a pod unless it was
+// replaced meanwhile.
+func (t *tunnel) use(conn httpstream.Connection) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	current := conn == t.conn
+	for _, extra := range t.extras {
+		current = current || conn == extra.conn
+	}
+	if !current {
+		return false
+	}
+
+	if t.inUse == nil {
+		t.inUse = map[httpstream.Connection]int{}
+	}
+	t.inUse[conn]++
+
+	return true
+}
+
+// release ends a use of the connection, a retired connection is closed with
+// its last local connection.
+func (t *tunnel) release(conn httpstream.Connection) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.inUse[conn]--
+	if t.inUse[conn] > 0 {
+		return
+	}
+
+	delete(t.inUse, conn)
+	if t.retired[conn] {
+		delete(t.retired, conn)
+		conn.Close()
+	}
+}
+
+// retire closes the replaced connection once its local connections ended,
+// at the latest after the drain timeout. The mutex must be held.
+func (t *tunnel) retire(conn httpstream.Connection) {
+	if t.inUse[conn] == 0 {
+		conn.Close()
+		return
+	}
+
+	if t.retired == nil {
+		t.retired = map[httpstream.Connection]bool{}
+	}
+	t.retired[conn] = true
+
+	if t.options.drainTimeout > 0 {
+		time.AfterFunc(t.options.drainTimeout, func() { conn.Close() })
+	}
+}
+
+// closeRetired closes the retired connections without waiting for their
+// local connections. The mutex must be held.
+func (t *tunnel) closeRetired() {
+	for conn := range t.retired {
+		conn.Close()
+	}
+	t.retired = nil
+}
+
+// listen binds the local ports, the bound ports replace the ephemeral ones.
+func (t *tunnel) listen() error {
+	addresses, err := listenAddresses(t.options.addresses)
+	if err != nil {
+		return err
+	}
+
+	if t.tlsConfig, err = t.options.localTLSConfig(); err != nil {
+		return err
+	}
+
+	if t.allowedClients, err = parseNetworks(t.options.allowedClients); err != nil {
+		return err
+	}
+
+	for i := range t.ports {
+		if t.ports[i].LocalSocket != "" {
+			listener, err := listenSocket(t.ports[i].LocalSocket)
+			if err != nil {
+				t.closeListeners()
+				return err
+			}
+
+			t.listeners = append(t.listeners, listener)
+			t.indexes = append(t.indexes, i)
+			continue
+		}
+
+		var listeners []net.Listener
+		var bound int
+
+		port := t.ports[i].Local
+		first, last := t.options.portRangeFirst, t.options.portRangeLast
+		if port == 0 && first > 0 {
+			listeners, bound, err = listenInRange(addresses, first, last)
+		} else {
+			listeners, bound, err = listenPort(addresses, port)
+			if errors.Is(err, ErrLocalPortInUse) && first > 0 {
+				listeners, bound, err = listenInRange(addresses, first, last)
+			}
+		}
+		if err != nil {
+			t.closeListeners()
+			return err
+		}
+
+		for range listeners {
+			t.indexes = append(t.indexes, i)
+		}
+		t.listeners = append(t.listeners, listeners...)
+		t.ports[i].Local = bound
+	}
+
+	if t.options.capturePath != "" {
+		if t.capture, err = openCapture(t.options.capturePath); err != nil {
+			t.closeListeners()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listenPort listens on the port on all addresses and returns the bound port.
+func listenPort(addresses []listenAddress, port int) ([]net.Listener, int, error) {
+	var listeners []net.Listener
+	bound := 0
+
+	for _, address := range addresses {
+		if bound != 0 {
+			// An ephemeral port is bound on every address with the same number.
+			port = bound
+		}
+
+		hostPort := net.JoinHostPort(address.host, strconv.Itoa(port))
+		listener, err := net.Listen(address.network, hostPort)
+		if err != nil {
+			if address.optional {
+				continue
+			}
+			closeAll(listeners)
+			if isAddrInUse(err) {
+				return nil, 0, fmt.Errorf("unable to listen on %s: %w", hostPort, ErrLocalPortInUse)
+			}
+			return nil, 0, fmt.Errorf("unable to listen on %s: %w", address.host, err)
+		}
+
+		bound = listener.Addr().(*net.TCPAddr).Port
+		listeners = append(listeners, listener)
+	}
+
+	if bound == 0 {
+		return nil, 0, fmt.Errorf("unable to listen on port %d", port)
+	}
+
+	return listeners, bound, nil
+}
+
+// listenInRange listens on the first port of the range that is free on all
+// addresses.
+func listenInRange(addresses []listenAddress, first, last int) ([]net.Listener, int, error) {
+	if first > last || last > 65535 {
+		return nil, 0, fmt.Errorf("invalid local port range %d-%d", first, last)
+	}
+
+	for port := first; port <= last; port++ {
+		listeners, bound, err := listenPort(addresses, port)
+		if err == nil {
+			return listeners, bound, nil
+		}
+		if !errors.Is(err, ErrLocalPortInUse) {
+			return nil, 0, err
+		}
+	}
+
+	return nil, 0, fmt.Errorf("no free local port in %d-%d: %w", first, last, ErrLocalPortInUse)
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// isAddrInUse reports whether listening failed because the address is used.
+func isAddrInUse(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+
+	return errno == syscall.EADDRINUSE || errno == wsaeaddrinuse
+}
+
+// serve accepts the connections of the listeners and returns the mappings
+// with the bound local ports and the remote ports of the pod.
+func (t *tunnel) serve() []PortMapping {
+	for i, listener := range t.listeners {
+		t.handlers.Add(1)
+		go t.accept(listener, t.indexes[i])
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	mappings := make([]PortMapping, 0, len(t.ports))
+	for i, port := range t.ports {
+		mappings = append(mappings, PortMapping{Local: port.Local, LocalSocket: port.LocalSocket, Remote: t.remotes[i].Remote})
+	}
+
+	return mappings
+}
+
+// listenUnix listens on the socket path. A stale socket of an earlier run is
+// removed, a socket that is still served is not.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to listen on %s: %w", path, ErrLocalPortInUse)
+		}
+		_ = os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", path, err)
+	}
+
+	return listener, nil
+}
+
+// run keeps the tunnel open until the forward is stopped. A lost connection
+// stops the forward unless it reconnects automatically.
+func (t *tunnel) run() {
+	for {
+		t.mutex.Lock()
+		conn, changed := t.conn, t.changed
+		t.mutex.Unlock()
+
+		select {
+		case <-t.stopChan:
+			if t.options.drainTimeout > 0 {
+				t.drain()
+			}
+			t.close()
+			t.handlers.Wait()
+			t.logf(LogInfo, "stopped")
+			return
+		case <-changed:
+			continue
+		case <-conn.CloseChan():
+		}
+
+		if t.replaced(conn) {
+			// Closed by connect.
+			continue
+		}
+
+		if _, disconnected := t.pauseState(); disconnected {
+			// Closed by pause, resuming connects again.
+			select {
+			case <-t.stopChan:
+			case <-changed:
+			}
+			continue
+		}
+
+		err := fmt.Errorf("lost connection to pod of %s/%s", t.namespace, t.target)
+		if !t.options.reconnect {
+			t.reportError(err)
+			t.stop(err)
+			continue
+		}
+
+		// Only kept as a warning, the reconnect reports when it fails.
+		t.warnings.add(err)
+		t.reconnect()
+	}
+}
+
+// drain closes the listeners and waits until the open local connections were
+// closed or the drain timeout passed.
+func (t *tunnel) drain() {
+	t.closeListeners()
+
+	deadline := time.Now().Add(t.options.drainTimeout)
+	for t.metrics.snapshot().OpenConnections > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+}
+
+// stopWhenIdle stops the forward when no local connection was open for the
+// idle timeout.
+func (t *tunnel) stopWhenIdle() {
+	timer := time.NewTimer(t.options.idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case <-timer.C:
+		}
+
+		idle := t.metrics.idle()
+		if idle >= t.options.idleTimeout {
+			t.stopWith(StopExpired, fmt.Errorf("forward of %s/%s was idle for %s", t.namespace, t.target, t.options.idleTimeout))
+			return
+		}
+
+		timer.Reset(t.options.idleTimeout - idle)
+	}
+}
+
+// stopWhenExpired stops the forward when it reached its maximum lifetime.
+func (t *tunnel) stopWhenExpired() {
+	timer := time.NewTimer(t.options.maxLifetime)
+	defer timer.Stop()
+
+	select {
+	case <-t.stopChan:
+		return
+	case <-timer.C:
+	}
+
+	t.stopWith(StopExpired, fmt.Errorf("forward of %s/%s reached its lifetime of %s", t.namespace, t.target, t.options.maxLifetime))
+
+	if t.options.onExpired != nil {
+		t.options.onExpired()
+	}
+}
+
+// reconnect connects to the pod of the target until it succeeds or the
+// forward is stopped.
+func (t *tunnel) reconnect() {
+	backoff := reconnectBackoff
+
+	for {
+		err := t.connect(t.ctx)
+		if err == nil {
+			return
+		}
+		t.reportError(fmt.Errorf("reconnecting to %s/%s: %w", t.namespace, t.target, err))
+
+		select {
+		case <-t.stopChan:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// reload reconnects with the reloaded config. The old connection is kept when
+// the pod cannot be reached with the new config, otherwise it drains: new
+// local connections use the new connection while the open ones are kept.
+func (t *tunnel) reload() {
+	if err := t.connectTo(t.ctx, t.currentTarget(), true); err != nil {
+		t.reportError(fmt.Errorf("reloading %s/%s: %w", t.namespace, t.target, err))
+	}
+
+	t.watchReload()
+}
+
+// watchReload reconnects the forward once the config was reloaded. Configs
+// without WithReload are never reloaded.
+func (t *tunnel) watchReload() {
+	if t.config.options.reloadInterval > 0 {
+		t.config.onReload(t.stopChan, t.reload)
+	}
+}
+
+// reportError keeps errors that happen while forwarding as warnings and
+// passes them to the error handler of the forward.
+func (t *tunnel) reportError(err error) {
+	t.warnings.add(err)
+
+	if t.options.errorHandler != nil {
+		t.options.errorHandler(err)
+		return
+	}
+
+	t.logf(LogError, "%v", err)
+}
+
+// close releases the listeners and the connection to the pod.
+func (t *tunnel) close() {
+	t.closeListeners()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.conn != nil {
+		t.conn.Close()
+	}
+
+	t.closeRetired()
+
+	addLoad(t.namespace, t.pod, -1)
+	t.replaceExtras(nil, false)
+	t.replaceMirror(backend{})
+	t.closeCapture()
+}
+
+func (t *tunnel) closeCapture() {
+	if t.capture == nil {
+		return
+	}
+
+	if err := t.capture.close(); err != nil {
+		t.reportError(fmt.Errorf("closing capture file: %w", err))
+	}
+}
+
+func (t *tunnel) closeListeners() {
+	closeAll(t.listeners)
+}
+
+// accept handles the connections of the listener for the port with the index.
+func (t *tunnel) accept(listener net.Listener, index int) {
+	defer t.handlers.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Closed by stopping the forward.
+			return
+		}
+
+		if t.rejectPaused(conn) {
+			continue
+		}
+
+		if !t.allowed(conn) {
+			conn.Close()
+			t.reportError(fmt.Errorf("rejected connection from %s: client is not allowed", conn.RemoteAddr()))
+			continue
+		}
+
+		if t.options.keepAlive != 0 {
+			if err := setKeepAlive(conn, t.options.keepAlive); err != nil {
+				t.reportError(fmt.Errorf("setting keepalive: %w", err))
+			}
+		}
+
+		if t.tlsConfig != nil {
+			conn = tls.Server(conn, t.tlsConfig)
+		}
+
+		t.handlers.Add(1)
+		go t.handle(conn, index)
+	}
+}
+
+func (t *tunnel) nextRequestID() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	id := t.requestID
+	t.requestID++
+
+	return id
+}
+
+// handle copies data between the local connection and a stream to the pod.
+func (t *tunnel) handle(local net.Conn, index int) {
+	defer t.handlers.Done()
+
+	if !t.acquireSlot(local) {
+		return
+	}
+	defer t.releaseSlot()
+
+	// Rejected clients never reach the pod.
+	if tlsConn, ok := local.(*tls.Conn); ok {
+		if err := handshake(tlsConn); err != nil {
+			local.Close()
+			t.reportError(fmt.Errorf("TLS handshake with %s: %w", local.RemoteAddr(), err))
+			return
+		}
+	}
+
+	local = t.chaotic(t.throttle(local))
+
+	t.metrics.opened()
+	defer t.metrics.closed()
+	defer local.Close()
+
+	current, ok := t.connection()
+	if !ok {
+		return
+	}
+	conn := current.conn
+	defer t.release(conn)
+
+	// The remote port of the mapping may change meanwhile.
+	t.mutex.Lock()
+	mapping := t.ports[index]
+	t.mutex.Unlock()
+	port := PortMapping{Local: mapping.Local, LocalSocket: mapping.LocalSocket, Remote: current.remotes[index].Remote}
+
+	local = t.httpLogged(t.captured(local, port.Remote))
+	defer local.Close()
+
+	addLoad(t.namespace, current.pod, 1)
+	defer addLoad(t.namespace, current.pod, -1)
+
+	if t.accessLog != nil {
+		counted := &accessConn{Conn: local}
+		local = counted
+		defer t.logAccess(counted, current.pod, port, time.Now())
+	}
+
+	info := ConnectionInfo{Port: port, Client: local.RemoteAddr()}
+	t.logf(LogDebug, "connection from %s to %s", info.Client, current.pod)
+	defer t.logf(LogDebug, "connection from %s closed", info.Client)
+	if t.options.onConnectionOpened != nil {
+		t.options.onConnectionOpened(info)
+	}
+	if t.options.onConnectionClosed != nil {
+		defer func() {
+			local.Close()
+			t.options.onConnectionClosed(info)
+		}()
+	}
+
+	if t.options.jumpHost != "" {
+		// The exec session only ends with the local connection.
+		jumped := make(chan struct{})
+		defer close(jumped)
+		go func() {
+			select {
+			case <-t.stopChan:
+				local.Close()
+			case <-jumped:
+			}
+		}()
+
+		if err := t.handleJump(local, current.pod, port.Remote); err != nil {
+			t.reportError(fmt.Errorf("forwarding %s through %s: %w", port, current.pod, err))
+		}
+		return
+	}
+
+	dataStream, errorChan, err := t.openStreams(conn, port.Remote)
+	if err != nil {
+		t.streamFailed(conn, fmt.Errorf("forwarding %s: %w", port, err))
+		return
+	}
+
+	local = t.mirrored(local, index)
+	defer local.Close()
+
+	remoteDone := make(chan struct{})
+	go func() {
+		// Copy from the pod to the local connection.
+		_, _ = io.Copy(countingWriter{local, &t.metrics.bytesReceived}, dataStream)
+		close(remoteDone)
+	}()
+
+	localError := make(chan struct{})
+	go func() {
+		// Tell the pod that no more data is sent.
+		defer dataStream.Close()
+
+		if _, err := io.Copy(countingWriter{dataStream, &t.metrics.bytesSent}, local); err != nil {
+			close(localError)
+		}
+	}()
+
+	// Wait for the pod to finish or for a broken local connection.
+	select {
+	case <-remoteDone:
+	case <-localError:
+	}
+
+	if err := <-errorChan; err != nil {
+		t.streamFailed(conn, fmt.Errorf("forwarding %s: %w", port, err))
+	}
+}
+
+// createStreams creates the error and the data stream for a connection to the
+// remote port. The channel delivers the error reported by the pod and is
+// closed when the error stream ends.
+func createStreams(conn httpstream.Connection, remote, requestID int) (httpstream.Stream, <-chan error, error) {
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(remote))
+	headers.Set(corev1.PortForwardRequestIDHeader, strconv.Itoa(requestID))
+
+	errorStream, err := createStream(conn, headers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating error stream: %w", err)
+	}
+	// We're not writing to this stream.
+	errorStream.Close()
+
+	errorChan := make(chan error, 1)
+	go func() {
+		message, err := ioutil.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errorChan <- fmt.Errorf("error reading from error stream: %w", err)
+		case len(message) > 0:
+			errorChan <- fmt.Errorf("an error occurred: %s", message)
+		}
+		close(errorChan)
+	}()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := createStream(conn, headers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating data stream: %w", err)
+	}
+
+	return dataStream, errorChan, nil
+}
+
+// createStream creates a stream unless the connection closes first. Streams
+// of broken connections wait for a reply until the timeout of spdystream,
+// this would delay stopping the forward.
+func createStream(conn httpstream.Connection, headers http.Header) (httpstream.Stream, error) {
+	type result struct {
+		stream httpstream.Stream
+		err    error
+	}
+
+	created := make(chan result, 1)
+	go func() {
+		stream, err := conn.CreateStream(headers)
+		created <- result{stream, err}
+	}()
+
+	select {
+	case r := <-created:
+		return r.stream, r.err
+	case <-conn.CloseChan():
+		go func() {
+			if r := <-created; r.stream != nil {
+				r.stream.Reset()
+			}
+		}()
+		return nil, fmt.Errorf("connection closed")
+	}
+}
+
+// streamFailed reports the error. When reconnecting the connection is closed
+// because the pod may be gone, its replacement resolves the target again.
+func (t *tunnel) streamFailed(conn httpstream.Connection, err error) {
+	t.reportError(err)
+
+	if t.options.reconnect {
+		conn.Close()
+	}
+}
+
+// listenAddress is a local address to bind. Optional addresses may fail as
+// long as one address of the port is bound, e.g. IPv6 on localhost.
+type listenAddress struct {
+	network  string
+	host     string
+	optional bool
+}
+
+// listenAddresses parses the addresses like kubectl, localhost binds the IPv4
+// and the IPv6 loopback address.
+func listenAddresses(addresses []string) ([]listenAddress, error) {
+	parsed := make([]listenAddress, 0, len(addresses)+1)
+	seen := make(map[string]bool, len(addresses)+1)
+
+	add := func(address listenAddress) {
+		if !seen[address.host] {
+			seen[address.host] = true
+			parsed = append(parsed, address)
+		}
+	}
+
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+
+		switch {
+		case address == "localhost":
+			add(listenAddress{network: "tcp4", host: "127.0.0.1", optional: true})
+			add(listenAddress{network: "tcp6", host: "::1", optional: true})
+		case ip == nil:
+			return nil, fmt.Errorf("%s is not a valid IP", address)
+		case ip.To4() != nil:
+			add(listenAddress{network: "tcp4", host: address})
+		default:
+			add(listenAddress{network: "tcp6", host: address})
+		}
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("at least one address is required")
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,696 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// waitFor polls the condition until it holds or the timeout expires.
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return condition()
+}
+
+// waitForClosedPort reports whether the local port stops accepting connections.
+func waitForClosedPort(localPort int) bool {
+	return waitFor(5*time.Second, func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	})
+}
+
+func TestForwardReconnectsAfterLostConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "restart-pod")
+
+	localPort, err := ForwardWithConfig(server.config, "default", "restart-pod", 0, 8080, WithAutoReconnect())
+	defer StopForwarding("default", "restart-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, localPort)
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return server.dialCount() == 2 }) {
+		t.Fatalf("Expected a reconnect but got %d connections", server.dialCount())
+	}
+
+	assertEcho(t, localPort)
+}
+
+func TestForwardStopsAfterLostConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "lost-pod")
+
+	localPort, err := ForwardWithConfig(server.config, "default", "lost-pod", 0, 8080)
+	defer StopForwarding("default", "lost-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	if !waitForClosedPort(localPort) {
+		t.Errorf("Listener should be closed after the connection was lost")
+	}
+
+	unregistered := waitFor(5*time.Second, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		_, active := activeForwards["default/lost-pod"]
+		return !active
+	})
+	if !unregistered {
+		t.Errorf("Forward should be unregistered after the connection was lost")
+	}
+}
+
+func TestForwardReportsErrorsToHandler(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "handler-pod")
+	errs := make(chan error, 10)
+
+	_, err := ForwardWithConfig(server.config, "default", "handler-pod", 0, 8080, WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	defer StopForwarding("default", "handler-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("Expected an error for the lost connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Error handler was not called")
+	}
+}
+
+func TestForwardStopClosesListener(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stopped-pod")
+
+	localPort, err := ForwardWithConfig(config, "default", "stopped-pod", 0, 8080)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	StopForwarding("default", "stopped-pod")
+
+	// Assert
+	if !waitForClosedPort(localPort) {
+		t.Errorf("Listener should be closed after stopping the forward")
+	}
+}
+
+func TestForwardDrainsOpenConnections(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "draining-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "draining-pod", []PortMapping{{Remote: 8080}}, WithDrain(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+	localPort := forwarder.Ports()[0].Local
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	assertEchoRoundTrip(t, conn)
+
+	// Act
+	forwarder.Stop()
+
+	// Assert
+	if !waitForClosedPort(localPort) {
+		t.Errorf("Listener should be closed while draining")
+	}
+
+	assertEchoRoundTrip(t, conn)
+
+	select {
+	case <-forwarder.done:
+		t.Fatalf("Forward should wait for the open connection")
+	default:
+	}
+
+	conn.Close()
+
+	select {
+	case <-forwarder.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Forward was not stopped after the connection was closed")
+	}
+}
+
+func TestForwardDrainTimesOut(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "stuck-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "stuck-pod", []PortMapping{{Remote: 8080}}, WithDrain(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	assertEchoRoundTrip(t, conn)
+
+	// Act
+	forwarder.Stop()
+
+	// Assert
+	select {
+	case <-forwarder.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Forward was not stopped after the drain timeout")
+	}
+}
+
+func TestForwardStopsWhenIdle(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "idle-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "idle-pod", []PortMapping{{Remote: 8080}}, WithIdleTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	// Act
+	select {
+	case err := <-forwarder.Err():
+		// Assert
+		if err == nil {
+			t.Errorf("Error should be reported for an idle forward")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Idle forward was not stopped in time")
+	}
+}
+
+func TestForwardIsNotIdleWithOpenConnection(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "busy-pod")
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "busy-pod", []PortMapping{{Remote: 8080}}, WithIdleTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	<-forwarder.Ready()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	time.Sleep(500 * time.Millisecond)
+
+	// Assert
+	select {
+	case err := <-forwarder.Err():
+		t.Fatalf("Forward with an open connection should not be stopped but got %v", err)
+	default:
+	}
+
+	assertEchoConn(t, conn)
+}
+
+func TestForwardStopsAfterMaxLifetime(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "expired-pod")
+	expired := make(chan struct{})
+
+	forwarder, err := NewForwarder(context.Background(), config, "default", "expired-pod", []PortMapping{{Remote: 8080}}, WithMaxLifetime(200*time.Millisecond, func() { close(expired) }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-forwarder.Ready()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", forwarder.Ports()[0].Local))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expiry callback was not called in time")
+	}
+
+	// Assert
+	if err := <-forwarder.Err(); err == nil {
+		t.Errorf("Error should be reported for an expired forward")
+	}
+
+	if !waitForClosedPort(forwarder.Ports()[0].Local) {
+		t.Errorf("Listener should be closed after the lifetime")
+	}
+}
+
+func TestForwardRetriesInitialConnection(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		pod := newTestPod("starting-pod", map[string]string{"app": "starting-pod"}, true, time.Now())
+		_, _ = config.clientset.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{})
+	}()
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "starting-pod", []PortMapping{{Remote: 8080}}, WithRetry(10, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Assert
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Forward should be ready after retrying but got %v", err)
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestForwardAggregatesRetryErrors(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "missing-pod", []PortMapping{{Remote: 8080}}, WithRetry(3, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	err = forwarder.waitReady()
+	if err == nil {
+		t.Fatalf("Error should be returned after all attempts failed")
+	}
+
+	var aggregate utilerrors.Aggregate
+	if !errors.As(err, &aggregate) || len(aggregate.Errors()) != 3 {
+		t.Errorf("Expected the errors of 3 attempts but got %v", err)
+	}
+}
+
+func TestTunnelReloadKeepsListener(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "reload-pod")
+
+	tunnel := newTunnel(context.Background(), server.config, "default", "reload-pod", []PortMapping{{Remote: 8080}}, newOptions(nil))
+	if err := tunnel.connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tunnel.listen(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bound := tunnel.serve()
+	defer close(tunnel.stopChan)
+
+	go tunnel.run()
+
+	// Act
+	tunnel.reload()
+
+	// Assert
+	if server.dialCount() != 2 {
+		t.Errorf("Expected a new connection but got %d connections", server.dialCount())
+	}
+
+	assertEcho(t, bound[0].Local)
+}
+
+func TestForwardOnUnixSocket(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "socket-pod")
+	path := filepath.Join(t.TempDir(), "pod.sock")
+
+	// Act
+	bound, err := ForwardPorts(config, "default", "socket-pod", []PortMapping{{LocalSocket: path, Remote: 5432}})
+	defer StopForwarding("default", "socket-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if bound[0].LocalSocket != path || bound[0].Remote != 5432 {
+		t.Errorf("Unexpected port mapping %v", bound[0])
+	}
+
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Could not connect to the socket: %v", err)
+	}
+
+	assertEchoConn(t, conn)
+}
+
+func TestListenUnixReplacesStaleSocket(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "stale.sock")
+
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Keeps the socket file like a crashed process.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	// Act
+	listener, err := listenUnix(path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Stale socket should be replaced but got %v", err)
+	}
+	listener.Close()
+}
+
+func TestForwardWithLocalPortInUse(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "taken-pod")
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	// Act
+	_, err = ForwardPorts(server.config, "default", "taken-pod", []PortMapping{{Local: port, Remote: 8080}}, WithAddress("127.0.0.1"))
+	defer StopForwarding("default", "taken-pod")
+
+	// Assert
+	if !errors.Is(err, ErrLocalPortInUse) {
+		t.Errorf("Expected ErrLocalPortInUse but got %v", err)
+	}
+
+	if server.dialCount() != 0 {
+		t.Errorf("Expected no connection to the pod but got %d connections", server.dialCount())
+	}
+}
+
+func TestForwardWithPortRangeSkipsBusyPort(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "range-pod")
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	// Act
+	bound, err := ForwardPorts(config, "default", "range-pod", []PortMapping{{Local: port, Remote: 8080}}, WithAddress("127.0.0.1"), WithPortRange(port, port+20))
+	defer StopForwarding("default", "range-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if bound[0].Local <= port || bound[0].Local > port+20 {
+		t.Errorf("Expected a port in %d-%d but got %d", port+1, port+20, bound[0].Local)
+	}
+
+	assertEcho(t, bound[0].Local)
+}
+
+func TestForwardWithExhaustedPortRange(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "exhausted-pod")
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	// Act
+	_, err = ForwardPorts(config, "default", "exhausted-pod", []PortMapping{{Remote: 8080}}, WithAddress("127.0.0.1"), WithPortRange(port, port))
+	defer StopForwarding("default", "exhausted-pod")
+
+	// Assert
+	if !errors.Is(err, ErrLocalPortInUse) {
+		t.Errorf("Expected ErrLocalPortInUse but got %v", err)
+	}
+}
+
+func TestListenUnixWithSocketInUse(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "used.sock")
+
+	used, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer used.Close()
+
+	// Act
+	_, err = listenUnix(path)
+
+	// Assert
+	if !errors.Is(err, ErrLocalPortInUse) {
+		t.Errorf("Expected ErrLocalPortInUse but got %v", err)
+	}
+}
+
+func TestForwardWithStrictPortsToUndeclaredPort(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t)
+	pod := newTestPod("declared-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{ContainerPort: 80}}}}
+	server.config.clientset = fake.NewSimpleClientset(pod)
+
+	// Act
+	_, err := ForwardPorts(server.config, "default", "declared-pod", []PortMapping{{Remote: 8080}}, WithStrictPorts())
+	defer StopForwarding("default", "declared-pod")
+
+	// Assert
+	if !errors.Is(err, ErrPortNotDeclared) {
+		t.Errorf("Expected ErrPortNotDeclared but got %v", err)
+	}
+
+	if server.dialCount() != 0 {
+		t.Errorf("Expected no connection to the pod but got %d connections", server.dialCount())
+	}
+}
+
+func TestForwardWarnsAboutUndeclaredPort(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	pod := newTestPod("undeclared-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{ContainerPort: 80}}}}
+	config.clientset = fake.NewSimpleClientset(pod)
+	var output logBuffer
+
+	// Act
+	bound, err := ForwardPorts(config, "default", "undeclared-pod", []PortMapping{{Remote: 8080}}, WithLogOutput(&output))
+	defer StopForwarding("default", "undeclared-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, bound[0].Local)
+
+	if !strings.Contains(output.String(), "does not declare the ports [8080]") {
+		t.Errorf("Expected a warning about the port in the log but got %q", output.String())
+	}
+}
+
+func TestListenAddresses(t *testing.T) {
+	// Act
+	addresses, err := listenAddresses([]string{"localhost", "127.0.0.1", "0.0.0.0", "::"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []listenAddress{
+		{network: "tcp4", host: "127.0.0.1", optional: true},
+		{network: "tcp6", host: "::1", optional: true},
+		{network: "tcp4", host: "0.0.0.0"},
+		{network: "tcp6", host: "::"},
+	}
+
+	if len(addresses) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, addresses)
+	}
+
+	for i := range expected {
+		if addresses[i] != expected[i] {
+			t.Errorf("Expected %v but got %v", expected[i], addresses[i])
+		}
+	}
+}
+
+func TestListenAddressesWithInvalidAddress(t *testing.T) {
+	// Act
+	_, err := listenAddresses([]string{"example.com"})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned for addresses that are not IPs")
+	}
+}
+
+// newStalledAPIServer returns a config for an API server that never answers
+// the upgrade to the pod.
+func newStalledAPIServer(t *testing.T, pod string, options configOptions) *Config {
+	t.Helper()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	return &Config{
+		restConfig: &rest.Config{Host: server.URL},
+		clientset:  fake.NewSimpleClientset(newTestPod(pod, nil, true, time.Now())),
+		options:    options,
+	}
+}
+
+func TestForwardWithDialTimeout(t *testing.T) {
+	// Arrange
+	config := newStalledAPIServer(t, "stalled-pod", configOptions{dialTimeout: 100 * time.Millisecond})
+	started := time.Now()
+
+	// Act
+	_, err := ForwardPorts(config, "default", "stalled-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "stalled-pod")
+
+	// Assert
+	if !errors.Is(err, ErrUpgradeFailed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a timed out upgrade but got %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Forward should fail after the dial timeout but took %s", elapsed)
+	}
+}
+
+func TestDialPodWithoutTimeoutWaitsForContext(t *testing.T) {
+	// Arrange
+	config := newStalledAPIServer(t, "stalled-context-pod", configOptions{})
+	dialer, err := newDialer(config.restConfig, "default", "stalled-context-pod", &config.options)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Act
+	_, err = dialPod(ctx, dialer, 0)
+
+	// Assert
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the context error but got %v", err)
+	}
+}
+
+func TestForwardWithDefaultReadyTimeout(t *testing.T) {
+	// Arrange
+	config := newStalledAPIServer(t, "stalled-default-pod", configOptions{})
+
+	timeout := defaultReadyTimeout
+	defaultReadyTimeout = 100 * time.Millisecond
+	defer func() { defaultReadyTimeout = timeout }()
+
+	// Act
+	_, err := ForwardPorts(config, "default", "stalled-default-pod", []PortMapping{{Remote: 8080}})
+	defer StopForwarding("default", "stalled-default-pod")
+
+	// Assert
+	if !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected ErrNotReady for a stalled pod but got %v", err)
+	}
+}
+
+func TestForwardWithoutReadyTimeout(t *testing.T) {
+	// Arrange
+	config := newStalledAPIServer(t, "stalled-unlimited-pod", configOptions{})
+
+	timeout := defaultReadyTimeout
+	defaultReadyTimeout = 100 * time.Millisecond
+	defer func() { defaultReadyTimeout = timeout }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	// Act
+	_, err := ForwardWithContext(ctx, config, "default", "stalled-unlimited-pod", []PortMapping{{Remote: 8080}}, WithReadyTimeout(0))
+	defer StopForwarding("default", "stalled-unlimited-pod")
+
+	// Assert
+	if errors.Is(err, ErrNotReady) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the forward to wait for the context but got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ===== Waiting for targets =====
+
+/*
+Forwards started together with an install of their target fail because the
+target does not exist yet. Waiting watches the pods of the namespace and
+resolves the target again on every change until it has a ready pod. Other
+objects like services and endpoints are not watched, the target is resolved
+again periodically for them. The watch only speeds up the wait: a target that
+is ready is not watched at all, and without a watch, e.g. without the
+permission to watch pods, the target is polled.
+*/
+
+// waitPollInterval is the delay between resolutions without pod events.
+const waitPollInterval = time.Second
+
+// waitForTarget blocks until the target has a ready pod when waiting was
+// enabled for the forward.
+func (t *tunnel) waitForTarget(parent context.Context) error {
+	if t.options.waitTimeout <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(parent, t.options.waitTimeout)
+	defer cancel()
+
+	_, clientset := t.config.client()
+
+	err := t.targetReady(ctx, clientset)
+	if !isMissingTarget(err) {
+		return err
+	}
+
+	var events <-chan watch.Event
+	watcher, watchErr := clientset.CoreV1().Pods(t.namespace).Watch(ctx, waitListOptions(t.target))
+	if watchErr == nil {
+		defer watcher.Stop()
+		events = watcher.ResultChan()
+	} else {
+		t.logf(LogDebug, "polling for %s/%s without a watch: %v", t.namespace, t.target, watchErr)
+	}
+
+	for {
+		select {
+		case <-t.stopChan:
+			return errStopped
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return parent.Err()
+			}
+			return fmt.Errorf("target %s/%s did not appear within %s: %w", t.namespace, t.target, t.options.waitTimeout, err)
+		case _, ok := <-events:
+			if !ok {
+				// Polls when the watch ended.
+				events = nil
+			}
+		case <-time.After(waitPollInterval):
+		}
+
+		err = t.targetReady(ctx, clientset)
+		if !isMissingTarget(err) {
+			return err
+		}
+	}
+}
+
+// waitListOptions restricts the watch to the pods of pod and selector
+// targets. The pods of other targets are only known once they resolve.
+func waitListOptions(target string) metav1.ListOptions {
+	kind, name := parseTarget(target)
+
+	switch kind {
+	case "pod", "pods", "po":
+		return metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String()}
+	case selectorKind:
+		return metav1.ListOptions{LabelSelector: name}
+	}
+
+	return metav1.ListOptions{}
+}
+
+// targetReady checks that the target resolves to a ready pod.
+func (t *tunnel) targetReady(parent context.Context, clientset kubernetes.Interface) error {
+	ctx, cancel := t.config.requestContextFrom(parent)
+	defer cancel()
+
+	resolved, err := resolveTarget(ctx, clientset, t.namespace, t.target)
+	if err != nil {
+		return err
+	}
+
+	if !isPodReady(resolved.pod) {
+		return fmt.Errorf("pod %s: %w", resolved.pod.Name, ErrNoReadyPod)
+	}
+
+	return nil
+}
+
+// isMissingTarget reports whether the target may still appear.
+func isMissingTarget(err error) bool {
+	return apierrors.IsNotFound(err) || errors.Is(err, ErrNoReadyPod)
+}
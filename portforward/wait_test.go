@@ -0,0 +1,131 @@
+package portforward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// forbidWatch rejects watching pods like a user without the watch permission.
+func forbidWatch(config *Config) {
+	config.clientset.(*fake.Clientset).PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+	})
+}
+
+func TestForwardWaitsForTarget(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	labels := map[string]string{"app": "installed"}
+
+	go func() {
+		// Installs the deployment before its pod.
+		ctx := context.Background()
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "installed", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		_, _ = config.clientset.AppsV1().Deployments("default").Create(ctx, deployment, metav1.CreateOptions{})
+
+		time.Sleep(100 * time.Millisecond)
+		_, _ = config.clientset.CoreV1().Pods("default").Create(ctx, newTestPod("installed-pod", labels, true, time.Now()), metav1.CreateOptions{})
+	}()
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "deployment/installed", []PortMapping{{Remote: 8080}}, WithWaitForTarget(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Assert
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Forward should be ready when the target appeared but got %v", err)
+	}
+
+	if pod := forwarder.tunnel.podName(); pod != "installed-pod" {
+		t.Errorf("Expected pod installed-pod but got %s", pod)
+	}
+
+	assertEcho(t, forwarder.Ports()[0].Local)
+}
+
+func TestForwardWaitsForReadyTargetWithoutWatch(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t, "unwatched-pod")
+	forbidWatch(config)
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "unwatched-pod", []PortMapping{{Remote: 8080}}, WithWaitForTarget(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Assert
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Forward to a ready target should not need a watch but got %v", err)
+	}
+}
+
+func TestForwardPollsForTargetWithoutWatch(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	forbidWatch(config)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = config.clientset.CoreV1().Pods("default").Create(context.Background(), newTestPod("polled-pod", nil, true, time.Now()), metav1.CreateOptions{})
+	}()
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "polled-pod", []PortMapping{{Remote: 8080}}, WithWaitForTarget(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+
+	// Assert
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Forward should be ready when the polled target appeared but got %v", err)
+	}
+}
+
+func TestWaitListOptions(t *testing.T) {
+	// Act
+	pod := waitListOptions("web-0")
+	selector := waitListOptions("selector/app=web")
+	deployment := waitListOptions("deployment/web")
+
+	// Assert
+	if pod.FieldSelector != "metadata.name=web-0" || selector.LabelSelector != "app=web" || deployment.FieldSelector != "" || deployment.LabelSelector != "" {
+		t.Errorf("Unexpected list options %+v, %+v, %+v", pod, selector, deployment)
+	}
+}
+
+func TestForwardWaitForTargetTimesOut(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+
+	// Act
+	forwarder, err := NewForwarder(context.Background(), config, "default", "never-pod", []PortMapping{{Remote: 8080}}, WithWaitForTarget(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Assert
+	if err := forwarder.waitReady(); err == nil || !isMissingTarget(err) {
+		t.Errorf("Expected an error for the missing target but got %v", err)
+	}
+}
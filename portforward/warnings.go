@@ -0,0 +1,66 @@
+package portforward
+
+import (
+	"sync"
+	"time"
+)
+
+// ===== Warnings =====
+
+/*
+Errors that do not end a forward, e.g. a failed local connection, a lost
+connection to the pod that is reconnected or an undeclared port, are passed to
+the error handler or logged. Callers that poll the forward instead read the
+latest of them from the handle, the oldest are dropped once maxWarnings are
+kept.
+*/
+
+// maxWarnings is the number of warnings a forward keeps.
+const maxWarnings = 100
+
+// Warning is an error that happened while forwarding without stopping the
+// forward.
+type Warning struct {
+	Time time.Time
+	Err  error
+}
+
+// warnings are the latest warnings of a forward.
+type warnings struct {
+	mutex   sync.Mutex
+	entries []Warning
+}
+
+func (w *warnings) add(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.entries) == maxWarnings {
+		w.entries = append(w.entries[:0], w.entries[1:]...)
+	}
+
+	w.entries = append(w.entries, Warning{Time: time.Now(), Err: err})
+}
+
+func (w *warnings) list() []Warning {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return append([]Warning(nil), w.entries...)
+}
+
+// Warnings returns the latest warnings of the forward, the oldest first.
+func (f *Forwarder) Warnings() []Warning {
+	return f.tunnel.warnings.list()
+}
+
+// GetWarnings returns the latest warnings of the registered forward to the
+// target.
+func GetWarnings(namespace, target string) ([]Warning, error) {
+	forwarder, err := registeredForwarder(namespace, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return forwarder.Warnings(), nil
+}
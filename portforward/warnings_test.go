@@ -0,0 +1,96 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestForwarderWarningsForLostConnection(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "warning-pod")
+	forwarder, err := NewForwarder(context.Background(), server.config, "default", "warning-pod", []PortMapping{{Remote: 8080}},
+		WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer forwarder.Stop()
+	if err := forwarder.waitReady(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	server.dropConnections()
+
+	// Assert
+	if !waitFor(5*time.Second, func() bool { return len(forwarder.Warnings()) > 0 }) {
+		t.Fatalf("Expected a warning for the lost connection")
+	}
+
+	warning := forwarder.Warnings()[0]
+	if warning.Err == nil || !strings.Contains(warning.Err.Error(), "lost connection to pod") || warning.Time.IsZero() {
+		t.Errorf("Unexpected warning %+v", warning)
+	}
+}
+
+func TestGetWarningsForUndeclaredPort(t *testing.T) {
+	// Arrange
+	config := newFakeAPIServer(t)
+	pod := newTestPod("undeclared-warning-pod", nil, true, time.Now())
+	pod.Spec.Containers = []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{ContainerPort: 80}}}}
+	config.clientset = fake.NewSimpleClientset(pod)
+
+	_, err := ForwardPorts(config, "default", "undeclared-warning-pod", []PortMapping{{Remote: 8080}}, WithLogLevel(LogSilent))
+	defer StopForwarding("default", "undeclared-warning-pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	warnings, err := GetWarnings("default", "undeclared-warning-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0].Err, ErrPortNotDeclared) {
+		t.Errorf("Expected a warning about the undeclared port but got %v", warnings)
+	}
+}
+
+func TestWarningsKeepTheLatest(t *testing.T) {
+	// Arrange
+	w := &warnings{}
+
+	// Act
+	for i := 0; i < maxWarnings+5; i++ {
+		w.add(fmt.Errorf("warning %d", i))
+	}
+
+	// Assert
+	entries := w.list()
+	if len(entries) != maxWarnings {
+		t.Fatalf("Expected %d warnings but got %d", maxWarnings, len(entries))
+	}
+
+	if entries[0].Err.Error() != "warning 5" || entries[maxWarnings-1].Err.Error() != fmt.Sprintf("warning %d", maxWarnings+4) {
+		t.Errorf("Expected the latest warnings but got %v to %v", entries[0].Err, entries[maxWarnings-1].Err)
+	}
+}
+
+func TestGetWarningsWithoutForward(t *testing.T) {
+	// Act
+	_, err := GetWarnings("default", "unknown-target")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Error should be returned without a registered forward")
+	}
+}
@@ -0,0 +1,164 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+)
+
+// ===== WebSocket transport =====
+
+/*
+Newer API servers accept the SPDY portforward protocol tunneled through a
+WebSocket, which passes proxies and load balancers that drop SPDY upgrades.
+Servers without support reject the WebSocket upgrade, the forward falls back
+to the SPDY upgrade then. Proxies from the environment are not used for the
+WebSocket connection.
+*/
+
+// websocketProtocol is the subprotocol that tunnels SPDY through a WebSocket.
+const websocketProtocol = "SPDY/3.1+" + portforward.PortForwardProtocolV1Name
+
+// WithWebSocket connects to pods through a WebSocket and falls back to SPDY
+// when the API server does not support it.
+func WithWebSocket() ConfigOption {
+	return func(o *configOptions) {
+		o.websocket = true
+	}
+}
+
+// upgradeError marks a failed upgrade of an established connection.
+type upgradeError struct {
+	err error
+}
+
+func (e *upgradeError) Error() string {
+	return fmt.Sprintf("unable to upgrade connection: %v", e.err)
+}
+
+func (e *upgradeError) Unwrap() error {
+	return e.err
+}
+
+// fallbackDialer uses the secondary dialer when the primary cannot upgrade.
+type fallbackDialer struct {
+	primary   httpstream.Dialer
+	secondary httpstream.Dialer
+}
+
+func (d *fallbackDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	conn, protocol, err := d.primary.Dial(protocols...)
+
+	var upgradeErr *upgradeError
+	if errors.As(err, &upgradeErr) {
+		return d.secondary.Dial(protocols...)
+	}
+
+	return conn, protocol, err
+}
+
+// websocketDialer tunnels the SPDY connection through a WebSocket.
+type websocketDialer struct {
+	roundTripper http.RoundTripper
+	upgrader     *websocketUpgrader
+	url          *url.URL
+	pings        time.Duration
+}
+
+func newWebSocketDialer(config *rest.Config, serverURL *url.URL, pings time.Duration) (httpstream.Dialer, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dial := DialContextFunc(config.Dial)
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	upgrader := &websocketUpgrader{dialer: dialUpgrader{dial: dial, tlsConfig: tlsConfig}}
+
+	// The wrappers add the authentication and the User-Agent to the handshake.
+	wrapper, err := rest.HTTPWrappersForConfig(config, upgrader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocketDialer{roundTripper: wrapper, upgrader: upgrader, url: serverURL, pings: pings}, nil
+}
+
+func (d *websocketDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	// WebSockets require GET.
+	req, err := http.NewRequest(http.MethodGet, d.url.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := d.roundTripper.RoundTrip(req); err != nil {
+		return nil, "", err
+	}
+
+	conn, err := httpspdy.NewClientConnectionWithPings(d.upgrader.conn, d.pings)
+	if err != nil {
+		d.upgrader.conn.Close()
+		return nil, "", err
+	}
+
+	return conn, portforward.PortForwardProtocolV1Name, nil
+}
+
+// websocketUpgrader does the WebSocket handshake for a single connection.
+type websocketUpgrader struct {
+	dialer dialUpgrader
+	conn   *websocket.Conn
+}
+
+func (u *websocketUpgrader) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := u.dialer.dialServer(req)
+	if err != nil {
+		return nil, err
+	}
+
+	location := *req.URL
+	origin := *req.URL
+	location.Scheme = "ws"
+	if req.URL.Scheme == "https" {
+		location.Scheme = "wss"
+	}
+	origin.Path, origin.RawQuery = "", ""
+
+	config := &websocket.Config{
+		Location: &location,
+		Origin:   &origin,
+		Protocol: []string{websocketProtocol},
+		Version:  websocket.ProtocolVersionHybi13,
+		Header:   req.Header.Clone(),
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, &upgradeError{err: err}
+	}
+
+	// SPDY frames are binary.
+	ws.PayloadType = websocket.BinaryFrame
+	u.conn = ws
+
+	return &http.Response{
+		Status:     "101 Switching Protocols",
+		StatusCode: http.StatusSwitchingProtocols,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
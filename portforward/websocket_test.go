@@ -0,0 +1,51 @@
+package portforward
+
+import (
+	"testing"
+)
+
+func TestForwardOverWebSocket(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "websocket-pod")
+	server.websocket = true
+	server.config.options.websocket = true
+
+	// Act
+	localPort, err := ForwardWithConfig(server.config, "default", "websocket-pod", 0, 8080)
+	defer StopForwarding("default", "websocket-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, localPort)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.websocketDials != 1 {
+		t.Errorf("Expected a WebSocket connection but got %d", server.websocketDials)
+	}
+}
+
+func TestForwardFallsBackToSPDY(t *testing.T) {
+	// Arrange
+	server := startFakeAPIServer(t, "spdy-pod")
+	server.config.options.websocket = true
+
+	// Act
+	localPort, err := ForwardWithConfig(server.config, "default", "spdy-pod", 0, 8080)
+	defer StopForwarding("default", "spdy-pod")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertEcho(t, localPort)
+
+	if server.dialCount() != 1 {
+		t.Errorf("Expected a SPDY connection but got %d connections", server.dialCount())
+	}
+}